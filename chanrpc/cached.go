@@ -0,0 +1,72 @@
+package chanrpc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type cachedRet struct {
+	ret     interface{}
+	expires time.Time
+}
+
+type retCache struct {
+	mutex     sync.Mutex
+	ttl       time.Duration
+	rets      map[string]cachedRet
+	lastSweep time.Time
+}
+
+// like Register, the result of f is reused by the calls with the same
+// arguments (compared by their %#v format) during ttl, f must be a pure
+// function returning a result (interface{} or []interface{}), a panic
+// is not cached
+// you must call the function before calling Open and Go
+func (s *Server) RegisterCached(id interface{}, ttl time.Duration, f interface{}) {
+	c := &retCache{ttl: ttl, rets: make(map[string]cachedRet)}
+
+	switch f := f.(type) {
+	case func([]interface{}) interface{}:
+		s.Register(id, func(args []interface{}) interface{} {
+			return c.get(args, func() interface{} {
+				return f(args)
+			})
+		})
+	case func([]interface{}) []interface{}:
+		s.Register(id, func(args []interface{}) []interface{} {
+			return assert(c.get(args, func() interface{} {
+				return f(args)
+			}))
+		})
+	default:
+		panic(fmt.Sprintf("function id %v: definition of cached function is invalid", id))
+	}
+}
+
+func (c *retCache) get(args []interface{}, f func() interface{}) interface{} {
+	key := fmt.Sprintf("%#v", args)
+	now := time.Now()
+
+	c.mutex.Lock()
+	r, ok := c.rets[key]
+	c.mutex.Unlock()
+	if ok && now.Before(r.expires) {
+		return r.ret
+	}
+
+	ret := f()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if now.Sub(c.lastSweep) >= c.ttl {
+		for k, r := range c.rets {
+			if !now.Before(r.expires) {
+				delete(c.rets, k)
+			}
+		}
+		c.lastSweep = now
+	}
+	c.rets[key] = cachedRet{ret, now.Add(c.ttl)}
+	return ret
+}
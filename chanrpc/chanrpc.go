@@ -1,11 +1,16 @@
 package chanrpc
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/name5566/leaf/conf"
 	"github.com/name5566/leaf/log"
+	"reflect"
 	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // one server per goroutine (goroutine not safe)
@@ -17,15 +22,54 @@ type Server struct {
 	// func(args []interface{})
 	// func(args []interface{}) interface{}
 	// func(args []interface{}) []interface{}
-	functions map[interface{}]interface{}
-	ChanCall  chan *CallInfo
+	// func(args []interface{}, notify func(msg interface{})) interface{}
+	functions      map[interface{}]interface{}
+	schemas        map[interface{}]Schema
+	limits         map[interface{}]chan struct{}
+	mutexFunctions sync.RWMutex
+	ChanCall       chan *CallInfo
+	ctx            context.Context
+
+	// round-robin between clients instead of FIFO, a flooding client cannot
+	// starve the others at the cost of more work per call, the calls of Go
+	// and GoFrom are queued by the origin given to GoFrom
+	// Exec executes one call, the calls queued are executed by the next
+	// ones, it is called again with a call of the server itself when
+	// ChanCall is empty
+	// you must set it before calling Exec
+	FairScheduling bool
+	fair           fairQueue
+	fairWaking     bool
+
+	// calls taking longer are logged with their trace id, 0 means never
+	// you must set it before calling Exec
+	SlowCallThreshold time.Duration
+
+	deadLetter func(id interface{}, args []interface{}, reason error)
+	observers  []func(id interface{}, args []interface{})
+
+	// clients of the synchronous calls, the result of a call always
+	// arrives before it returns so no result is left on a recycled client
+	clients sync.Pool
+
+	// a synchronous call made by a function to its own server with its
+	// context returns ErrReentrantCall instead of deadlocking
+	execSeq   atomic.Uint64
+	executing atomic.Bool
+	execCtx   context.Context
+
+	// see ServePool
+	pooled bool
 }
 
 type CallInfo struct {
+	id      interface{}
 	f       interface{}
 	args    []interface{}
 	chanRet chan *RetInfo
 	cb      interface{}
+	ctx     context.Context
+	origin  interface{}
 }
 
 type RetInfo struct {
@@ -34,6 +78,8 @@ type RetInfo struct {
 	// []interface{}
 	ret interface{}
 	err error
+	// ret is a message of notify, see CallNotify
+	notification bool
 	// callback:
 	// func(err error)
 	// func(ret interface{}, err error)
@@ -41,11 +87,27 @@ type RetInfo struct {
 	cb interface{}
 }
 
+var (
+	ErrTooManyPendingAsynCall = errors.New("too many calls")
+	ErrServerClosed           = errors.New("chanrpc server closed")
+	ErrChannelFull            = errors.New("chanrpc channel full")
+	ErrNotRegistered          = errors.New("function not registered")
+	// returned by TryGo and GoTimeout, the same error as ErrChannelFull
+	ErrServerBusy = ErrChannelFull
+)
+
 type Client struct {
 	s               *Server
 	chanSyncRet     chan *RetInfo
 	ChanAsynRet     chan *RetInfo
 	pendingAsynCall int
+
+	// unbounded client
+	chanAsynIn chan *RetInfo
+	unbounded  bool
+	mutexPump  sync.Mutex
+	inflight   int
+	pumping    bool
 }
 
 func NewServer(l int) *Server {
@@ -69,10 +131,13 @@ func (s *Server) Register(id interface{}, f interface{}) {
 	case func([]interface{}):
 	case func([]interface{}) interface{}:
 	case func([]interface{}) []interface{}:
+	case func([]interface{}, func(interface{})) interface{}:
 	default:
 		panic(fmt.Sprintf("function id %v: definition of function is invalid", id))
 	}
 
+	s.mutexFunctions.Lock()
+	defer s.mutexFunctions.Unlock()
 	if _, ok := s.functions[id]; ok {
 		panic(fmt.Sprintf("function id %v: already registered", id))
 	}
@@ -80,6 +145,45 @@ func (s *Server) Register(id interface{}, f interface{}) {
 	s.functions[id] = f
 }
 
+// f is called with the calls that are dropped instead of executed,
+// the reason is ErrServerClosed, ErrChannelFull, an error wrapping
+// ErrNotRegistered, ErrReentrantCall or ErrInvalidArgs, or the error of the
+// context of the call
+// f is called on the goroutine dropping the call (must be goroutine safe)
+// you must call the function before calling Open and Go
+func (s *Server) SetDeadLetter(f func(id interface{}, args []interface{}, reason error)) {
+	s.deadLetter = f
+}
+
+func (s *Server) drop(id interface{}, args []interface{}, reason error) {
+	if s.deadLetter != nil {
+		s.deadLetter(id, args, reason)
+	}
+}
+
+func (s *Server) function(id interface{}) interface{} {
+	s.mutexFunctions.RLock()
+	defer s.mutexFunctions.RUnlock()
+	return s.functions[id]
+}
+
+// goroutine safe
+func (s *Server) HasFunction(id interface{}) bool {
+	return s.function(id) != nil
+}
+
+// goroutine safe
+func (s *Server) RegisteredIDs() []interface{} {
+	s.mutexFunctions.RLock()
+	defer s.mutexFunctions.RUnlock()
+
+	ids := make([]interface{}, 0, len(s.functions))
+	for id := range s.functions {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
 func (s *Server) ret(ci *CallInfo, ri *RetInfo) (err error) {
 	if ci.chanRet == nil {
 		return
@@ -97,14 +201,53 @@ func (s *Server) ret(ci *CallInfo, ri *RetInfo) (err error) {
 }
 
 func (s *Server) exec(ci *CallInfo) (err error) {
+	if ci.ctx != nil {
+		// the caller is not waiting any more
+		if err := ci.ctx.Err(); err != nil {
+			s.drop(ci.id, ci.args, err)
+			return s.ret(ci, &RetInfo{err: err})
+		}
+	}
+	if err := s.validate(ci); err != nil {
+		s.drop(ci.id, ci.args, err)
+		return s.ret(ci, &RetInfo{err: err})
+	}
+
+	if !s.pooled {
+		s.ctx = ci.ctx
+		s.enter()
+		defer s.leave()
+	} else if sem := s.limit(ci.id); sem != nil {
+		sem <- struct{}{}
+		defer func() { <-sem }()
+	}
+	s.observe(ci)
+
+	var start time.Time
+	if s.SlowCallThreshold > 0 {
+		start = time.Now()
+	}
+
 	defer func() {
+		var trace string
+		if ci.ctx != nil {
+			trace = TraceID(ci.ctx)
+		}
+		if !s.pooled {
+			s.ctx = nil
+		}
+		if s.SlowCallThreshold > 0 {
+			if d := time.Since(start); d > s.SlowCallThreshold {
+				log.Release("function id %v: slow call %v%v", ci.id, d, traceSuffix(trace))
+			}
+		}
 		if r := recover(); r != nil {
-			if conf.LenStackBuf > 0 {
-				buf := make([]byte, conf.LenStackBuf)
+			if n := conf.Current().LenStackBuf; n > 0 {
+				buf := make([]byte, n)
 				l := runtime.Stack(buf, false)
-				err = fmt.Errorf("%v: %s", r, buf[:l])
+				err = fmt.Errorf("%v%v: %s", r, traceSuffix(trace), buf[:l])
 			} else {
-				err = fmt.Errorf("%v", r)
+				err = fmt.Errorf("%v%v", r, traceSuffix(trace))
 			}
 
 			s.ret(ci, &RetInfo{err: fmt.Errorf("%v", r)})
@@ -122,12 +265,36 @@ func (s *Server) exec(ci *CallInfo) (err error) {
 	case func([]interface{}) []interface{}:
 		ret := ci.f.(func([]interface{}) []interface{})(ci.args)
 		return s.ret(ci, &RetInfo{ret: ret})
+	case func([]interface{}, func(interface{})) interface{}:
+		ret := ci.f.(func([]interface{}, func(interface{})) interface{})(ci.args, func(msg interface{}) {
+			s.notify(ci, msg)
+		})
+		return s.ret(ci, &RetInfo{ret: ret})
 	}
 
 	panic("bug")
 }
 
+// the context of the call being executed, to be passed to the calls made
+// by the function, see ErrReentrantCall
+// only valid inside a function called by Exec (goroutine not safe),
+// always context.Background() with ServePool
+func (s *Server) Context() context.Context {
+	if !s.executing.Load() {
+		return context.Background()
+	}
+	return s.markedContext()
+}
+
 func (s *Server) Exec(ci *CallInfo) {
+	if s.FairScheduling {
+		s.execFair(ci)
+		return
+	}
+	s.exec1(ci)
+}
+
+func (s *Server) exec1(ci *CallInfo) {
 	err := s.exec(ci)
 	if err != nil {
 		log.Error("%v", err)
@@ -136,42 +303,211 @@ func (s *Server) Exec(ci *CallInfo) {
 
 // goroutine safe
 func (s *Server) Go(id interface{}, args ...interface{}) {
-	f := s.functions[id]
+	s.GoChecked(id, args...)
+}
+
+// like Go, returns an error wrapping ErrNotRegistered or ErrServerClosed
+// instead of dropping the call silently
+// goroutine safe
+func (s *Server) GoChecked(id interface{}, args ...interface{}) (err error) {
+	return s.goFrom(nil, id, args...)
+}
+
+// like Go, the calls with the same origin (e.g. the agent of a message) are
+// queued together with FairScheduling, origin must be comparable to be
+// told apart
+// goroutine safe
+func (s *Server) GoFrom(origin interface{}, id interface{}, args ...interface{}) {
+	s.goFrom(origin, id, args...)
+}
+
+func (s *Server) goFrom(origin interface{}, id interface{}, args ...interface{}) (err error) {
+	f := s.function(id)
+	if f == nil {
+		err = fmt.Errorf("function id %v: %w", id, ErrNotRegistered)
+		s.drop(id, args, err)
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrServerClosed
+			s.drop(id, args, err)
+		}
+	}()
+
+	s.ChanCall <- &CallInfo{
+		id:     id,
+		f:      f,
+		args:   args,
+		origin: origin,
+	}
+	return
+}
+
+// like Go, ctx is available to the function through Context
+// goroutine safe
+func (s *Server) GoCtx(ctx context.Context, id interface{}, args ...interface{}) {
+	f := s.function(id)
 	if f == nil {
+		s.drop(id, args, fmt.Errorf("function id %v: %w", id, ErrNotRegistered))
 		return
 	}
 
 	defer func() {
-		recover()
+		if r := recover(); r != nil {
+			s.drop(id, args, ErrServerClosed)
+		}
 	}()
 
 	s.ChanCall <- &CallInfo{
+		id:   id,
 		f:    f,
 		args: args,
+		ctx:  ctx,
+	}
+}
+
+// waits at most d for the server, returns ErrServerBusy after
+// goroutine safe
+func (s *Server) GoTimeout(d time.Duration, id interface{}, args ...interface{}) error {
+	f := s.function(id)
+	if f == nil {
+		err := fmt.Errorf("function id %v: %w", id, ErrNotRegistered)
+		s.drop(id, args, err)
+		return err
+	}
+
+	err := s.goTimeout(d, &CallInfo{
+		id:   id,
+		f:    f,
+		args: args,
+	})
+	if err != nil {
+		s.drop(id, args, err)
+	}
+	return err
+}
+
+func (s *Server) goTimeout(d time.Duration, ci *CallInfo) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrServerClosed
+		}
+	}()
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case s.ChanCall <- ci:
+	case <-t.C:
+		err = ErrServerBusy
 	}
+	return
+}
+
+// returns ErrServerBusy instead of waiting when the server is busy
+// goroutine safe
+func (s *Server) TryGo(id interface{}, args ...interface{}) error {
+	f := s.function(id)
+	if f == nil {
+		err := fmt.Errorf("function id %v: %w", id, ErrNotRegistered)
+		s.drop(id, args, err)
+		return err
+	}
+
+	err := s.tryGo(&CallInfo{
+		id:   id,
+		f:    f,
+		args: args,
+	})
+	if err != nil {
+		s.drop(id, args, err)
+	}
+	return err
+}
+
+func (s *Server) tryGo(ci *CallInfo) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrServerClosed
+		}
+	}()
+
+	select {
+	case s.ChanCall <- ci:
+	default:
+		err = ErrServerBusy
+	}
+	return
+}
+
+func (s *Server) syncClient() *Client {
+	if c, ok := s.clients.Get().(*Client); ok {
+		return c
+	}
+	return s.Open(0)
 }
 
 // goroutine safe
 func (s *Server) Call0(id interface{}, args ...interface{}) error {
-	return s.Open(0).Call0(id, args...)
+	c := s.syncClient()
+	defer s.clients.Put(c)
+	return c.Call0(id, args...)
 }
 
 // goroutine safe
 func (s *Server) Call1(id interface{}, args ...interface{}) (interface{}, error) {
-	return s.Open(0).Call1(id, args...)
+	c := s.syncClient()
+	defer s.clients.Put(c)
+	return c.Call1(id, args...)
 }
 
 // goroutine safe
 func (s *Server) CallN(id interface{}, args ...interface{}) ([]interface{}, error) {
-	return s.Open(0).CallN(id, args...)
+	c := s.syncClient()
+	defer s.clients.Put(c)
+	return c.CallN(id, args...)
+}
+
+// goroutine safe
+func (s *Server) CallNInto(id interface{}, dst []interface{}, args ...interface{}) error {
+	c := s.syncClient()
+	defer s.clients.Put(c)
+	return c.CallNInto(id, dst, args...)
+}
+
+// goroutine safe
+func (s *Server) Call0Ctx(ctx context.Context, id interface{}, args ...interface{}) error {
+	return s.Open(0).Call0Ctx(ctx, id, args...)
+}
+
+// goroutine safe
+func (s *Server) Call1Ctx(ctx context.Context, id interface{}, args ...interface{}) (interface{}, error) {
+	return s.Open(0).Call1Ctx(ctx, id, args...)
+}
+
+// goroutine safe
+func (s *Server) CallNCtx(ctx context.Context, id interface{}, args ...interface{}) ([]interface{}, error) {
+	return s.Open(0).CallNCtx(ctx, id, args...)
 }
 
 func (s *Server) Close() {
 	close(s.ChanCall)
 
 	for ci := range s.ChanCall {
+		if ci == fairWake {
+			continue
+		}
+		s.drop(ci.id, ci.args, ErrServerClosed)
 		s.ret(ci, &RetInfo{
-			err: errors.New("chanrpc server closed"),
+			err: ErrServerClosed,
+		})
+	}
+	for ci := s.fair.pop(); ci != nil; ci = s.fair.pop() {
+		s.drop(ci.id, ci.args, ErrServerClosed)
+		s.ret(ci, &RetInfo{
+			err: ErrServerClosed,
 		})
 	}
 }
@@ -188,6 +524,7 @@ func NewClient(l int) *Client {
 	c := new(Client)
 	c.chanSyncRet = make(chan *RetInfo, 1)
 	c.ChanAsynRet = make(chan *RetInfo, l)
+	c.chanAsynIn = c.ChanAsynRet
 	return c
 }
 
@@ -195,34 +532,57 @@ func (c *Client) Attach(s *Server) {
 	c.s = s
 }
 
-func (c *Client) call(ci *CallInfo, block bool) (err error) {
+// the blocking calls wait for their result
+func (c *Client) call(ci *CallInfo, block bool) error {
+	if block && c.s.reentrant(ci.ctx) {
+		err := fmt.Errorf("function id %v: %w", ci.id, ErrReentrantCall)
+		c.s.drop(ci.id, ci.args, err)
+		return err
+	}
+
+	err := c.send(ci, block)
+	if err != nil {
+		c.s.drop(ci.id, ci.args, err)
+	}
+	return err
+}
+
+func (c *Client) send(ci *CallInfo, block bool) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			err = r.(error)
+			err = ErrServerClosed
 		}
 	}()
 
-	if block {
+	ci.origin = c
+	if block && ci.ctx != nil {
+		select {
+		case c.s.ChanCall <- ci:
+		case <-ci.ctx.Done():
+			err = ci.ctx.Err()
+		}
+	} else if block {
 		c.s.ChanCall <- ci
 	} else {
 		select {
 		case c.s.ChanCall <- ci:
 		default:
-			err = errors.New("chanrpc channel full")
+			err = ErrChannelFull
 		}
 	}
 	return
 }
 
-func (c *Client) f(id interface{}, n int) (f interface{}, err error) {
+func (c *Client) f(id interface{}, n int, args []interface{}) (f interface{}, err error) {
 	if c.s == nil {
 		err = errors.New("server not attached")
 		return
 	}
 
-	f = c.s.functions[id]
+	f = c.s.function(id)
 	if f == nil {
-		err = fmt.Errorf("function id %v: function not registered", id)
+		err = fmt.Errorf("function id %v: %w", id, ErrNotRegistered)
+		c.s.drop(id, args, err)
 		return
 	}
 
@@ -234,23 +594,27 @@ func (c *Client) f(id interface{}, n int) (f interface{}, err error) {
 		_, ok = f.(func([]interface{}) interface{})
 	case 2:
 		_, ok = f.(func([]interface{}) []interface{})
+	case 3:
+		_, ok = f.(func([]interface{}, func(interface{})) interface{})
 	default:
 		panic("bug")
 	}
 
 	if !ok {
 		err = fmt.Errorf("function id %v: return type mismatch", id)
+		c.s.drop(id, args, err)
 	}
 	return
 }
 
 func (c *Client) Call0(id interface{}, args ...interface{}) error {
-	f, err := c.f(id, 0)
+	f, err := c.f(id, 0, args)
 	if err != nil {
 		return err
 	}
 
 	err = c.call(&CallInfo{
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.chanSyncRet,
@@ -264,12 +628,13 @@ func (c *Client) Call0(id interface{}, args ...interface{}) error {
 }
 
 func (c *Client) Call1(id interface{}, args ...interface{}) (interface{}, error) {
-	f, err := c.f(id, 1)
+	f, err := c.f(id, 1, args)
 	if err != nil {
 		return nil, err
 	}
 
 	err = c.call(&CallInfo{
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.chanSyncRet,
@@ -283,12 +648,13 @@ func (c *Client) Call1(id interface{}, args ...interface{}) (interface{}, error)
 }
 
 func (c *Client) CallN(id interface{}, args ...interface{}) ([]interface{}, error) {
-	f, err := c.f(id, 2)
+	f, err := c.f(id, 2, args)
 	if err != nil {
 		return nil, err
 	}
 
 	err = c.call(&CallInfo{
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.chanSyncRet,
@@ -301,26 +667,156 @@ func (c *Client) CallN(id interface{}, args ...interface{}) ([]interface{}, erro
 	return assert(ri.ret), ri.err
 }
 
+// like Server.Go without waiting, the call is tried again after backoff
+// at most retries times while the server is busy (ErrChannelFull)
+func (c *Client) GoRetry(id interface{}, retries int, backoff time.Duration, args ...interface{}) error {
+	if c.s == nil {
+		return errors.New("server not attached")
+	}
+	f := c.s.function(id)
+	if f == nil {
+		err := fmt.Errorf("function id %v: %w", id, ErrNotRegistered)
+		c.s.drop(id, args, err)
+		return err
+	}
+
+	ci := &CallInfo{
+		id:   id,
+		f:    f,
+		args: args,
+	}
+	for i := 0; ; i++ {
+		err := c.send(ci, false)
+		if err == nil {
+			return nil
+		}
+		if err != ErrChannelFull || i >= retries {
+			c.s.drop(id, args, err)
+			return err
+		}
+		time.Sleep(backoff)
+	}
+}
+
+// the result may arrive after ctx is done,
+// so every call gets its own return channel
+func (c *Client) callCtx(ctx context.Context, id interface{}, f interface{}, args []interface{}) (*RetInfo, error) {
+	chanRet := make(chan *RetInfo, 1)
+	err := c.call(&CallInfo{
+		id:      id,
+		f:       f,
+		args:    args,
+		chanRet: chanRet,
+		ctx:     ctx,
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case ri := <-chanRet:
+		return ri, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Client) Call0Ctx(ctx context.Context, id interface{}, args ...interface{}) error {
+	f, err := c.f(id, 0, args)
+	if err != nil {
+		return err
+	}
+
+	ri, err := c.callCtx(ctx, id, f, args)
+	if err != nil {
+		return err
+	}
+	return ri.err
+}
+
+func (c *Client) Call1Ctx(ctx context.Context, id interface{}, args ...interface{}) (interface{}, error) {
+	f, err := c.f(id, 1, args)
+	if err != nil {
+		return nil, err
+	}
+
+	ri, err := c.callCtx(ctx, id, f, args)
+	if err != nil {
+		return nil, err
+	}
+	return ri.ret, ri.err
+}
+
+func (c *Client) CallNCtx(ctx context.Context, id interface{}, args ...interface{}) ([]interface{}, error) {
+	f, err := c.f(id, 2, args)
+	if err != nil {
+		return nil, err
+	}
+
+	ri, err := c.callCtx(ctx, id, f, args)
+	if err != nil {
+		return nil, err
+	}
+	return assert(ri.ret), ri.err
+}
+
+// dst holds one pointer per return value
+func (c *Client) CallNInto(id interface{}, dst []interface{}, args ...interface{}) error {
+	ret, err := c.CallN(id, args...)
+	if err != nil {
+		return err
+	}
+	return scan(id, ret, dst)
+}
+
+func scan(id interface{}, ret []interface{}, dst []interface{}) error {
+	if len(ret) != len(dst) {
+		return fmt.Errorf("function id %v: %v return values, %v destinations", id, len(ret), len(dst))
+	}
+
+	for i := 0; i < len(dst); i++ {
+		v := reflect.ValueOf(dst[i])
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			return fmt.Errorf("function id %v: destination %v must be a non-nil pointer", id, i)
+		}
+		elem := v.Elem()
+		if ret[i] == nil {
+			elem.Set(reflect.Zero(elem.Type()))
+			continue
+		}
+		r := reflect.ValueOf(ret[i])
+		if !r.Type().AssignableTo(elem.Type()) {
+			return fmt.Errorf("function id %v: cannot assign return value %v of type %v to %v",
+				id, i, r.Type(), elem.Type())
+		}
+		elem.Set(r)
+	}
+	return nil
+}
+
 func (c *Client) asynCall(id interface{}, args []interface{}, cb interface{}, n int) {
-	f, err := c.f(id, n)
+	f, err := c.f(id, n, args)
 	if err != nil {
-		c.ChanAsynRet <- &RetInfo{err: err, cb: cb}
+		c.chanAsynIn <- &RetInfo{err: err, cb: cb}
 		return
 	}
 
 	err = c.call(&CallInfo{
+		id:      id,
 		f:       f,
 		args:    args,
-		chanRet: c.ChanAsynRet,
+		chanRet: c.chanAsynIn,
 		cb:      cb,
 	}, false)
 	if err != nil {
-		c.ChanAsynRet <- &RetInfo{err: err, cb: cb}
+		c.chanAsynIn <- &RetInfo{err: err, cb: cb}
 		return
 	}
 }
 
-func (c *Client) AsynCall(id interface{}, _args ...interface{}) {
+// the callback is called with ErrTooManyPendingAsynCall
+// when the client is bounded and ChanAsynRet is full
+func (c *Client) AsynCall(id interface{}, _args ...interface{}) error {
 	if len(_args) < 1 {
 		panic("callback function not found")
 	}
@@ -341,20 +837,24 @@ func (c *Client) AsynCall(id interface{}, _args ...interface{}) {
 	}
 
 	// too many calls
-	if c.pendingAsynCall >= cap(c.ChanAsynRet) {
-		execCb(&RetInfo{err: errors.New("too many calls"), cb: cb})
-		return
+	if !c.unbounded && c.pendingAsynCall >= cap(c.ChanAsynRet) {
+		execCb(&RetInfo{err: ErrTooManyPendingAsynCall, cb: cb})
+		return ErrTooManyPendingAsynCall
 	}
 
+	if c.unbounded {
+		c.startPump()
+	}
 	c.asynCall(id, args, cb, n)
 	c.pendingAsynCall++
+	return nil
 }
 
 func execCb(ri *RetInfo) {
 	defer func() {
 		if r := recover(); r != nil {
-			if conf.LenStackBuf > 0 {
-				buf := make([]byte, conf.LenStackBuf)
+			if n := conf.Current().LenStackBuf; n > 0 {
+				buf := make([]byte, n)
 				l := runtime.Stack(buf, false)
 				log.Error("%v: %s", r, buf[:l])
 			} else {
@@ -388,6 +888,10 @@ func (c *Client) Close() {
 	}
 }
 
+func (c *Client) PendingAsynCall() int {
+	return c.pendingAsynCall
+}
+
 func (c *Client) Idle() bool {
 	return c.pendingAsynCall == 0
 }
@@ -1,8 +1,24 @@
 package chanrpc
 
 import (
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
 	"fmt"
+	"github.com/name5566/leaf/log"
+	"io"
+	l "log"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestClient_AsynCall(t *testing.T) {
@@ -38,3 +54,1245 @@ func TestClient_AsynCall(t *testing.T) {
 		}
 	})*/
 }
+
+func TestServer_RegisteredIDs(t *testing.T) {
+	server := NewServer(10)
+	server.Register("f0", func(args []interface{}) {})
+	server.Register("f1", func(args []interface{}) interface{} { return nil })
+	server.Register(2, func(args []interface{}) []interface{} { return nil })
+
+	ids := server.RegisteredIDs()
+	if len(ids) != 3 {
+		t.Fatalf("unexpected ids: %v", ids)
+	}
+	seen := make(map[interface{}]bool)
+	for _, id := range ids {
+		seen[id] = true
+	}
+	for _, id := range []interface{}{"f0", "f1", 2} {
+		if !seen[id] {
+			t.Errorf("id %v not listed", id)
+		}
+		if !server.HasFunction(id) {
+			t.Errorf("HasFunction(%v) = false", id)
+		}
+	}
+	if server.HasFunction("f2") {
+		t.Error("HasFunction(f2) = true")
+	}
+
+	// the returned slice is a copy
+	ids[0] = "modified"
+	if server.HasFunction("modified") {
+		t.Error("internal state exposed")
+	}
+}
+
+func TestClient_Call1Ctx(t *testing.T) {
+	server := NewServer(10)
+
+	server.Register("work", func(args []interface{}) interface{} {
+		ctx := server.Context()
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			return "no deadline"
+		}
+		if time.Until(deadline) < args[0].(time.Duration) {
+			return "short-circuited"
+		}
+		return "done"
+	})
+	server.Register("block", func(args []interface{}) interface{} {
+		<-server.Context().Done()
+		return nil
+	})
+
+	go func() {
+		for ci := range server.ChanCall {
+			server.Exec(ci)
+		}
+	}()
+	defer server.Close()
+
+	client := server.Open(0)
+
+	ret, err := client.Call1("work", time.Second)
+	if err != nil || ret != "no deadline" {
+		t.Fatalf("got %v, %v", ret, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ret, err = client.Call1Ctx(ctx, "work", time.Second)
+	if err != nil || ret != "short-circuited" {
+		t.Fatalf("got %v, %v", ret, err)
+	}
+	ret, err = client.Call1Ctx(ctx, "work", time.Millisecond)
+	if err != nil || ret != "done" {
+		t.Fatalf("got %v, %v", ret, err)
+	}
+
+	_, err = client.Call1Ctx(ctx, "block")
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// calls already expired are not executed
+	_, err = client.Call1Ctx(ctx, "work", time.Millisecond)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// the sync channel is not polluted by the abandoned calls
+	ret, err = client.Call1("work", time.Second)
+	if err != nil || ret != "no deadline" {
+		t.Fatalf("got %v, %v", ret, err)
+	}
+}
+
+func TestClient_CallNInto(t *testing.T) {
+	server := NewServer(10)
+	server.Register("divmod", func(args []interface{}) []interface{} {
+		a, b := args[0].(int), args[1].(int)
+		return []interface{}{a / b, a % b, nil}
+	})
+
+	go func() {
+		for ci := range server.ChanCall {
+			server.Exec(ci)
+		}
+	}()
+	defer server.Close()
+
+	client := server.Open(0)
+
+	var q, r int
+	var e error = errors.New("not reset")
+	if err := client.CallNInto("divmod", []interface{}{&q, &r, &e}, 7, 2); err != nil {
+		t.Fatal(err)
+	}
+	if q != 3 || r != 1 || e != nil {
+		t.Fatalf("got %v %v %v", q, r, e)
+	}
+
+	err := client.CallNInto("divmod", []interface{}{&q, &r}, 7, 2)
+	if err == nil || err.Error() != "function id divmod: 3 return values, 2 destinations" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var s string
+	if err := client.CallNInto("divmod", []interface{}{&s, &r, &e}, 7, 2); err == nil {
+		t.Fatal("type mismatch not reported")
+	}
+	if err := client.CallNInto("divmod", []interface{}{q, &r, &e}, 7, 2); err == nil {
+		t.Fatal("non-pointer destination not reported")
+	}
+}
+
+func TestServer_FairScheduling(t *testing.T) {
+	server := NewServer(1000)
+	server.FairScheduling = true
+	server.Register("slow", func(args []interface{}) {
+		time.Sleep(time.Millisecond)
+	})
+	server.Register("fast", func(args []interface{}) {})
+
+	// flood
+	flooder := server.Open(1000)
+	for i := 0; i < 500; i++ {
+		flooder.AsynCall("slow", func(err error) {})
+	}
+
+	closeSig := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		for {
+			select {
+			case ci := <-server.ChanCall:
+				server.Exec(ci)
+			case <-closeSig:
+				server.Close()
+				close(done)
+				return
+			}
+		}
+	}()
+	defer func() {
+		closeSig <- true
+		<-done
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	// trickle
+	trickler := server.Open(0)
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		if err := trickler.Call0("fast"); err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(start); d > 100*time.Millisecond {
+			t.Fatalf("call %v took %v", i, d)
+		}
+	}
+
+	if len(flooder.ChanAsynRet) == 500 {
+		t.Fatal("flooder not served")
+	}
+}
+
+func TestServer_FairSchedulingFlood(t *testing.T) {
+	server := NewServer(1000)
+	server.FairScheduling = true
+	server.Register("slow", func(args []interface{}) {
+		time.Sleep(time.Millisecond)
+	})
+	fast := make(chan struct{}, 1)
+	server.Register("fast", func(args []interface{}) {
+		fast <- struct{}{}
+	})
+
+	// floods until the end, like the agents routing through Go
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					server.GoFrom("flooder", "slow")
+				}
+			}
+		}()
+	}
+
+	closeSig := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		for {
+			select {
+			case ci := <-server.ChanCall:
+				server.Exec(ci)
+			case <-closeSig:
+				close(done)
+				return
+			}
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// another origin is not queued behind the flooder
+	server.GoFrom("other", "fast")
+	select {
+	case <-fast:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("call of another origin starved")
+	}
+
+	// nor is the loop of the server
+	closeSig <- true
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("closeSig not handled")
+	}
+
+	close(stop)
+	go func() {
+		for range server.ChanCall {
+		}
+	}()
+	wg.Wait()
+	server.Close()
+}
+
+func TestClient_AsynCallLimit(t *testing.T) {
+	server := NewServer(10)
+	server.Register("f", func(args []interface{}) {})
+
+	// bounded
+	c := server.Open(2)
+	var errs []error
+	for i := 0; i < 3; i++ {
+		err := c.AsynCall("f", func(err error) {
+			errs = append(errs, err)
+		})
+		if i < 2 && err != nil {
+			t.Fatalf("call %v: %v", i, err)
+		}
+		if i == 2 && err != ErrTooManyPendingAsynCall {
+			t.Fatalf("call %v: got %v, want %v", i, err, ErrTooManyPendingAsynCall)
+		}
+	}
+	if c.PendingAsynCall() != 2 || len(errs) != 1 || errs[0] != ErrTooManyPendingAsynCall {
+		t.Fatalf("pending %v, errs %v", c.PendingAsynCall(), errs)
+	}
+	for len(server.ChanCall) > 0 {
+		server.Exec(<-server.ChanCall)
+	}
+	c.Close()
+	if !c.Idle() || len(errs) != 3 || errs[1] != nil || errs[2] != nil {
+		t.Fatalf("unexpected errs %v", errs)
+	}
+
+	// unbounded
+	server = NewServer(100)
+	server.Register("f", func(args []interface{}) {})
+	c = server.OpenUnbounded()
+	n := 0
+	for i := 0; i < 50; i++ {
+		if err := c.AsynCall("f", func(err error) {
+			if err == nil {
+				n++
+			}
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.AsynCall("not registered", func(err error) {
+		if err == nil {
+			t.Error("expected error")
+		}
+	})
+	if c.PendingAsynCall() != 51 {
+		t.Fatalf("pending %v", c.PendingAsynCall())
+	}
+	for len(server.ChanCall) > 0 {
+		server.Exec(<-server.ChanCall)
+	}
+	c.Close()
+	if !c.Idle() || n != 50 {
+		t.Fatalf("idle %v, n %v", c.Idle(), n)
+	}
+}
+
+type deadCall struct {
+	id     interface{}
+	args   []interface{}
+	reason error
+}
+
+func TestServer_SetDeadLetter(t *testing.T) {
+	s := NewServer(1)
+	s.Register("f", func(args []interface{}) {})
+
+	var dead []deadCall
+	s.SetDeadLetter(func(id interface{}, args []interface{}, reason error) {
+		dead = append(dead, deadCall{id, args, reason})
+	})
+	last := func() deadCall {
+		if len(dead) == 0 {
+			t.Fatal("no dead letter")
+		}
+		d := dead[len(dead)-1]
+		dead = dead[:len(dead)-1]
+		return d
+	}
+
+	// not found
+	s.Go("missing", 1)
+	if d := last(); d.id != "missing" || len(d.args) != 1 || !errors.Is(d.reason, ErrNotRegistered) {
+		t.Fatalf("unexpected dead letter %v", d)
+	}
+	c := s.Open(10)
+	if err := c.Call0("missing"); !errors.Is(err, ErrNotRegistered) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if d := last(); d.id != "missing" || !errors.Is(d.reason, ErrNotRegistered) {
+		t.Fatalf("unexpected dead letter %v", d)
+	}
+
+	// busy queue
+	s.Go("f", 1)
+	c.AsynCall("f", 2, func(err error) {})
+	if d := last(); d.id != "f" || d.args[0] != 2 || d.reason != ErrChannelFull {
+		t.Fatalf("unexpected dead letter %v", d)
+	}
+	c.Cb(<-c.ChanAsynRet)
+
+	// closed, the queued call is dropped by Close
+	s.Close()
+	if d := last(); d.id != "f" || d.args[0] != 1 || d.reason != ErrServerClosed {
+		t.Fatalf("unexpected dead letter %v", d)
+	}
+	s.Go("f", 3)
+	if d := last(); d.id != "f" || d.args[0] != 3 || d.reason != ErrServerClosed {
+		t.Fatalf("unexpected dead letter %v", d)
+	}
+	if err := c.Call0("f", 4); err != ErrServerClosed {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if d := last(); d.id != "f" || d.args[0] != 4 || d.reason != ErrServerClosed {
+		t.Fatalf("unexpected dead letter %v", d)
+	}
+
+	if len(dead) != 0 {
+		t.Fatalf("unexpected dead letters %v", dead)
+	}
+}
+
+func TestClient_GoRetry(t *testing.T) {
+	s := NewServer(1)
+	done := make(chan int, 10)
+	s.Register("f", func(args []interface{}) {
+		done <- args[0].(int)
+	})
+
+	var dead []error
+	s.SetDeadLetter(func(id interface{}, args []interface{}, reason error) {
+		dead = append(dead, reason)
+	})
+
+	c := s.Open(0)
+	if err := c.GoRetry("f", 0, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	// busy
+	if err := s.TryGo("f", 2); err != ErrServerBusy {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := c.GoRetry("f", 2, time.Millisecond, 3); err != ErrChannelFull {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(dead) != 2 {
+		t.Fatalf("%v dead letters, want 2", len(dead))
+	}
+
+	// free after a while
+	freed := make(chan struct{})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		s.Exec(<-s.ChanCall)
+		close(freed)
+	}()
+	if err := c.GoRetry("f", 100, 5*time.Millisecond, 4); err != nil {
+		t.Fatal(err)
+	}
+	<-freed
+	s.Exec(<-s.ChanCall)
+
+	for _, want := range []int{1, 4} {
+		if got := <-done; got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if len(dead) != 2 {
+		t.Fatalf("%v dead letters, want 2", len(dead))
+	}
+}
+
+func TestServer_Call1Concurrent(t *testing.T) {
+	s := NewServer(10)
+	s.Register("double", func(args []interface{}) interface{} {
+		return args[0].(int) * 2
+	})
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+	defer close(s.ChanCall)
+
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			for j := 0; j < 1000; j++ {
+				n := i*1000 + j
+				ret, err := s.Call1("double", n)
+				if err == nil && ret.(int) != n*2 {
+					err = fmt.Errorf("double %v: got %v", n, ret)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkServer_Call1(b *testing.B) {
+	s := NewServer(10)
+	s.Register("f", func(args []interface{}) interface{} {
+		return nil
+	})
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+	defer close(s.ChanCall)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.Call1("f")
+	}
+}
+
+func BenchmarkServer_TryGo(b *testing.B) {
+	s := NewServer(10)
+	s.Register("f", func(args []interface{}) {})
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+	defer close(s.ChanCall)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.TryGo("f")
+	}
+}
+
+type addReq struct {
+	A, B int
+	Tag  string
+}
+
+type addResp struct {
+	Sum int
+	Tag string
+}
+
+func TestServer_RegisterStruct(t *testing.T) {
+	s := NewServer(10)
+	s.RegisterStruct("add", func(req addReq) addResp {
+		return addResp{req.A + req.B, req.Tag}
+	})
+	got := make(chan addReq, 1)
+	s.RegisterStruct("notify", func(req addReq) {
+		got <- req
+	})
+	// the errors are logged after the calls return
+	done := make(chan struct{})
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+		close(done)
+	}()
+	defer func() {
+		close(s.ChanCall)
+		<-done
+	}()
+
+	ret, err := s.Call1("add", 1, 2, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := ret.(addResp); resp != (addResp{3, "x"}) {
+		t.Fatalf("unexpected result %v", resp)
+	}
+
+	if err := s.Call0("notify", 1, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if req := <-got; req != (addReq{1, 2, ""}) {
+		t.Fatalf("unexpected request %v", req)
+	}
+
+	if _, err := s.Call1("add", 1, 2); err == nil {
+		t.Fatal("missing argument accepted")
+	}
+	if _, err := s.Call1("add", 1, "2", "x"); err == nil {
+		t.Fatal("mismatching argument accepted")
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("invalid struct function registered")
+			}
+		}()
+		s.RegisterStruct("invalid", func(a, b int) int { return a + b })
+	}()
+}
+
+func TestServer_GoTimeout(t *testing.T) {
+	s := NewServer(1)
+	done := make(chan int, 10)
+	s.Register("f", func(args []interface{}) {
+		done <- args[0].(int)
+	})
+
+	if err := s.GoTimeout(time.Millisecond, "f", 1); err != nil {
+		t.Fatal(err)
+	}
+	// busy
+	if err := s.GoTimeout(10*time.Millisecond, "f", 2); err != ErrServerBusy {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// freed within the window
+	freed := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.Exec(<-s.ChanCall)
+		close(freed)
+	}()
+	if err := s.GoTimeout(time.Second, "f", 3); err != nil {
+		t.Fatal(err)
+	}
+	<-freed
+	s.Exec(<-s.ChanCall)
+
+	for _, want := range []int{1, 3} {
+		if got := <-done; got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+
+	s.Close()
+	if err := s.GoTimeout(time.Second, "f", 4); err != ErrServerClosed {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestServer_Trace(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := log.New("debug", dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Export(logger)
+	defer func() {
+		stdout, _ := log.New("debug", "", l.LstdFlags)
+		log.Export(stdout)
+		logger.Close()
+	}()
+
+	inner := NewServer(10)
+	inner.SlowCallThreshold = time.Millisecond
+	traces := make(chan string, 1)
+	inner.Register("inner", func(args []interface{}) interface{} {
+		traces <- TraceID(inner.Context())
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+
+	outer := NewServer(10)
+	outer.Register("outer", func(args []interface{}) interface{} {
+		// propagate the trace id
+		ret, err := inner.Call1Ctx(outer.Context(), "inner")
+		if err != nil {
+			panic(err)
+		}
+		return ret
+	})
+
+	for _, s := range []*Server{inner, outer} {
+		s := s
+		go func() {
+			for ci := range s.ChanCall {
+				s.Exec(ci)
+			}
+		}()
+		defer close(s.ChanCall)
+	}
+
+	ctx := WithTrace(context.Background(), "t-42")
+	if _, err := outer.Call1Ctx(ctx, "outer"); err != nil {
+		t.Fatal(err)
+	}
+	if trace := <-traces; trace != "t-42" {
+		t.Fatalf("got trace %q, want t-42", trace)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(files) != 1 {
+		t.Fatal("log file not found")
+	}
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`function id inner: slow call \S+ \(trace t-42\)`).Match(b) {
+		t.Fatalf("slow call not logged: %q", b)
+	}
+}
+
+func TestServer_ReentrantCall(t *testing.T) {
+	s := NewServer(10)
+	s.Register("double", func(args []interface{}) interface{} {
+		return args[0].(int) * 2
+	})
+	s.Register("quad", func(args []interface{}) {
+		_, err := s.Call1Ctx(s.Context(), "double", args[0])
+		if !errors.Is(err, ErrReentrantCall) {
+			t.Errorf("got %v, want ErrReentrantCall", err)
+		}
+		ctx, cancel := context.WithTimeout(s.Context(), 100*time.Millisecond)
+		defer cancel()
+		if err := s.Call0Ctx(ctx, "quad", args[0]); !errors.Is(err, ErrReentrantCall) {
+			t.Errorf("derived context: got %v, want ErrReentrantCall", err)
+		}
+	})
+	other := make(chan error, 2)
+	s.Register("slow", func(args []interface{}) {
+		// calls from the other goroutines wait as usual
+		go func() {
+			_, err := s.Call1("double", 1)
+			other <- err
+		}()
+		// the context of a call returned
+		ctx := s.Context()
+		go func() {
+			time.Sleep(40 * time.Millisecond)
+			_, err := s.Call1Ctx(ctx, "double", 1)
+			other <- err
+		}()
+		time.Sleep(20 * time.Millisecond)
+	})
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+	defer close(s.ChanCall)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Call0("quad", 1)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reentrant call deadlocked")
+	}
+
+	if err := s.Call0("slow"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-other; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestServer_ServePool(t *testing.T) {
+	const n = 4
+	s := NewServer(10)
+	var running, maxRunning atomic.Int32
+	s.Register("square", func(args []interface{}) interface{} {
+		r := running.Add(1)
+		for {
+			m := maxRunning.Load()
+			if r <= m || maxRunning.CompareAndSwap(m, r) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		running.Add(-1)
+		x := args[0].(int)
+		return x * x
+	})
+	done := make(chan struct{})
+	go func() {
+		s.ServePool(n)
+		close(done)
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+	for i := 0; i < 2*n; i++ {
+		wg.Add(1)
+		go func(x int) {
+			defer wg.Done()
+			ret, err := s.Call1("square", x)
+			if err == nil && ret != x*x {
+				err = fmt.Errorf("square %v: got %v", x, ret)
+			}
+			if err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if m := maxRunning.Load(); m != n {
+		t.Fatalf("got %v concurrent calls, want %v", m, n)
+	}
+
+	s.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("ServePool not returned after Close")
+	}
+}
+
+func TestServer_RegisterCached(t *testing.T) {
+	s := NewServer(10)
+	calls := 0
+	s.RegisterCached("lookup", 50*time.Millisecond, func(args []interface{}) interface{} {
+		calls++
+		return fmt.Sprintf("%v@%v", args[0], calls)
+	})
+	s.RegisterCached("pair", time.Minute, func(args []interface{}) []interface{} {
+		return []interface{}{args[0], args[0]}
+	})
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+	defer close(s.ChanCall)
+
+	call := func(key string) interface{} {
+		ret, err := s.Call1("lookup", key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ret
+	}
+	if r := call("a"); r != "a@1" {
+		t.Fatalf("got %v", r)
+	}
+	if r := call("a"); r != "a@1" || calls != 1 {
+		t.Fatalf("got %v after %v calls, want the cached result", r, calls)
+	}
+	if r := call("b"); r != "b@2" {
+		t.Fatalf("got %v, other arguments must not hit the cache", r)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if r := call("a"); r != "a@3" {
+		t.Fatalf("got %v, want an expired result", r)
+	}
+
+	ret, err := s.CallN("pair", 1)
+	if err != nil || len(ret) != 2 || ret[1] != 1 {
+		t.Fatalf("got %v %v", ret, err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("cached function without result registered")
+		}
+	}()
+	s.RegisterCached("invalid", time.Second, func(args []interface{}) {})
+}
+
+func TestServer_GoChecked(t *testing.T) {
+	s := NewServer(10)
+	s.Register("f", func(args []interface{}) {})
+
+	if err := s.GoChecked("f", 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.ChanCall) != 1 {
+		t.Fatal("call not queued")
+	}
+
+	err := s.GoChecked("typo", 1)
+	if !errors.Is(err, ErrNotRegistered) || !strings.Contains(err.Error(), "typo") {
+		t.Fatalf("got %v, want ErrNotRegistered", err)
+	}
+	if len(s.ChanCall) != 1 {
+		t.Fatal("unknown call queued")
+	}
+
+	s.Close()
+	if err := s.GoChecked("f", 1); err != ErrServerClosed {
+		t.Fatalf("got %v, want ErrServerClosed", err)
+	}
+}
+
+func TestServer_Observe(t *testing.T) {
+	s := NewServer(10)
+	var seen []string
+	var handled []interface{}
+	s.Register("f", func(args []interface{}) {
+		handled = append(handled, args[0])
+	})
+	s.Register("g", func(args []interface{}) interface{} {
+		handled = append(handled, args[0])
+		return args[0]
+	})
+	s.Observe(func(id interface{}, args []interface{}) {
+		seen = append(seen, fmt.Sprintf("%v %v", id, args))
+		// cannot alter the call
+		args[0] = "altered"
+	})
+	s.Observe(func(id interface{}, args []interface{}) {
+		panic("observer failed")
+	})
+
+	s.Go("f", 1)
+	c := s.Open(10)
+	c.AsynCall("g", 2, func(ret interface{}, err error) {
+		if err != nil || ret != 2 {
+			t.Errorf("got %v %v, want 2", ret, err)
+		}
+	})
+	for i := 0; i < 2; i++ {
+		s.Exec(<-s.ChanCall)
+	}
+	c.Cb(<-c.ChanAsynRet)
+
+	if want := []string{"f [1]", "g [2]"}; !reflect.DeepEqual(seen, want) {
+		t.Fatalf("observed %v, want %v", seen, want)
+	}
+	if want := []interface{}{1, 2}; !reflect.DeepEqual(handled, want) {
+		t.Fatalf("handled %v, want %v", handled, want)
+	}
+}
+
+func TestServer_RegisterWithSchema(t *testing.T) {
+	s := NewServer(10)
+	var called int
+	s.RegisterWithSchema("move", func(args []interface{}) interface{} {
+		called++
+		return args[0].(int) + len(args[1].(string))
+	}, Schema{reflect.TypeOf(0), reflect.String, nil})
+	var dropped []error
+	s.SetDeadLetter(func(id interface{}, args []interface{}, reason error) {
+		dropped = append(dropped, reason)
+	})
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+	defer s.Close()
+
+	ret, err := s.Call1("move", 1, "ab", nil)
+	if err != nil || ret != 3 {
+		t.Fatalf("got %v %v, want 3", ret, err)
+	}
+
+	for _, args := range [][]interface{}{
+		{1, "ab"},
+		{"1", "ab", 0},
+		{1, 2, 0},
+		{nil, "ab", 0},
+	} {
+		_, err := s.Call1("move", args...)
+		if !errors.Is(err, ErrInvalidArgs) || !strings.Contains(err.Error(), "move") {
+			t.Fatalf("args %v: got %v, want ErrInvalidArgs", args, err)
+		}
+	}
+	if called != 1 || len(dropped) != 4 {
+		t.Fatalf("%v calls, %v dropped", called, len(dropped))
+	}
+	if err := (Schema{reflect.Ptr}).validate("f", []interface{}{nil}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServer_SetConcurrency(t *testing.T) {
+	const n = 4
+	s := NewServer(20)
+	type counter struct {
+		running, max atomic.Int32
+	}
+	track := func(c *counter) func([]interface{}) {
+		return func([]interface{}) {
+			r := c.running.Add(1)
+			for {
+				m := c.max.Load()
+				if r <= m || c.max.CompareAndSwap(m, r) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			c.running.Add(-1)
+		}
+	}
+	var serial, parallel counter
+	s.Register("serial", track(&serial))
+	s.Register("parallel", track(&parallel))
+	s.SetConcurrency("serial", 1)
+	s.SetConcurrency("parallel", 0)
+	done := make(chan struct{})
+	go func() {
+		s.ServePool(2 * n)
+		close(done)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		for _, id := range []string{"serial", "parallel"} {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				if err := s.Call0(id); err != nil {
+					t.Error(err)
+				}
+			}(id)
+		}
+	}
+	wg.Wait()
+	s.Close()
+	<-done
+
+	if m := serial.max.Load(); m != 1 {
+		t.Fatalf("got %v concurrent serial calls, want 1", m)
+	}
+	if m := parallel.max.Load(); m != n {
+		t.Fatalf("got %v concurrent parallel calls, want %v", m, n)
+	}
+}
+
+func TestServer_GoAfter(t *testing.T) {
+	s := NewServer(10)
+	called := make(chan string, 2)
+	s.Register("reward", func(args []interface{}) {
+		called <- args[0].(string)
+	})
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+	defer s.Close()
+
+	start := time.Now()
+	s.GoAfter(30*time.Millisecond, "reward", "kept")
+	c := s.GoAfter(10*time.Millisecond, "reward", "canceled")
+	if !c.Stop() {
+		t.Fatal("pending call not stopped")
+	}
+
+	select {
+	case got := <-called:
+		if got != "kept" {
+			t.Fatalf("got %v, want kept", got)
+		}
+		if d := time.Since(start); d < 30*time.Millisecond {
+			t.Fatalf("called after %v, before the delay", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("delayed call not executed")
+	}
+	select {
+	case got := <-called:
+		t.Fatalf("canceled call %v executed", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if c.Stop() {
+		t.Fatal("call stopped twice")
+	}
+}
+
+func TestServer_CallNotify(t *testing.T) {
+	s := NewServer(10)
+	var progressed []interface{}
+	s.Register("upgrade", func(args []interface{}, notify func(msg interface{})) interface{} {
+		notify(50)
+		notify(100)
+		progressed = append(progressed, "done")
+		return "level " + args[0].(string)
+	})
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+	defer s.Close()
+
+	var got []interface{}
+	ret, err := s.CallNotify("upgrade", func(msg interface{}) {
+		got = append(got, msg)
+	}, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, ret)
+	if fmt.Sprint(got) != "[50 100 level 2]" {
+		t.Fatalf("got %v, want the notifications then the result", got)
+	}
+
+	// no caller to notify
+	s.Go("upgrade", "3")
+	if _, err := s.Call1("upgrade", "4"); err == nil {
+		t.Fatal("Call1 of a notifying function succeeded")
+	}
+	if _, err := s.CallNotify("upgrade", nil, "5"); err != nil {
+		t.Fatal(err)
+	}
+	if len(progressed) != 3 {
+		t.Fatalf("%v calls executed, want 3", len(progressed))
+	}
+
+	// a panicking notify leaves no result on the pooled client
+	s.Register("level", func(args []interface{}) interface{} {
+		return "level " + args[0].(string)
+	})
+	func() {
+		defer func() {
+			if r := recover(); r != "notify" {
+				t.Fatalf("got %v, want the panic of notify", r)
+			}
+		}()
+		s.CallNotify("upgrade", func(msg interface{}) {
+			panic("notify")
+		}, "6")
+	}()
+	if ret, err := s.Call1("level", "7"); err != nil || ret != "level 7" {
+		t.Fatalf("got %v %v, want level 7", ret, err)
+	}
+}
+
+func TestMockServer(t *testing.T) {
+	m := NewMockServer()
+	defer m.Close()
+	m.On("add").Return(3)
+	m.On("log").Return()
+	m.On("pair").ReturnN(1, 2)
+	m.On("fail").Panic("db down")
+
+	c := m.Open(10)
+	if ret, err := c.Call1("add", 1, 2); err != nil || ret != 3 {
+		t.Fatalf("got %v %v, want 3", ret, err)
+	}
+	if err := c.Call0("log", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if ret, err := c.CallN("pair"); err != nil || !reflect.DeepEqual(ret, []interface{}{1, 2}) {
+		t.Fatalf("got %v %v, want [1 2]", ret, err)
+	}
+	if _, err := c.Call1("fail"); err == nil || err.Error() != "db down" {
+		t.Fatalf("got %v, want db down", err)
+	}
+	if _, err := c.Call1("unknown"); !errors.Is(err, ErrNotRegistered) {
+		t.Fatalf("got %v, want ErrNotRegistered", err)
+	}
+	c.Call1("add", 5, 6)
+
+	want := []MockCall{
+		{"add", []interface{}{1, 2}},
+		{"log", []interface{}{"hello"}},
+		{"pair", nil},
+		{"fail", nil},
+		{"add", []interface{}{5, 6}},
+	}
+	if calls := m.Calls(); !reflect.DeepEqual(calls, want) {
+		t.Fatalf("got calls %v, want %v", calls, want)
+	}
+	if calls := m.CallsOf("add"); !reflect.DeepEqual(calls, [][]interface{}{{1, 2}, {5, 6}}) {
+		t.Fatalf("got calls of add %v", calls)
+	}
+}
+
+type remoteItem struct {
+	Name  string
+	Count int
+}
+
+func writeFrame(w io.Writer, data []byte) error {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	_, err := w.Write(append(b, data...))
+	return err
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(b[:]))
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
+
+func TestServer_ExecRemote(t *testing.T) {
+	gob.Register(remoteItem{})
+
+	// the backend process
+	s := NewServer(10)
+	s.Register("give", func(args []interface{}) interface{} {
+		item := args[1].(remoteItem)
+		return fmt.Sprintf("%v got %v %v", args[0], item.Count, item.Name)
+	})
+	s.Register("split", func(args []interface{}) []interface{} {
+		return []interface{}{args[0].(int) / 2, args[0].(int) % 2}
+	})
+	s.Register("kick", func(args []interface{}) {})
+	s.Register("fail", func(args []interface{}) interface{} {
+		panic("bad item")
+	})
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+	defer s.Close()
+
+	gateway, backend := net.Pipe()
+	defer gateway.Close()
+	go func() {
+		defer backend.Close()
+		for {
+			call, err := readFrame(backend)
+			if err != nil {
+				return
+			}
+			ret, err := s.ExecRemote(GobCodec, call)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := writeFrame(backend, ret); err != nil {
+				return
+			}
+		}
+	}()
+
+	call := func(id interface{}, args ...interface{}) (interface{}, error) {
+		data, err := MarshalCall(GobCodec, id, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFrame(gateway, data); err != nil {
+			t.Fatal(err)
+		}
+		ret, err := readFrame(gateway)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return UnmarshalRet(GobCodec, ret)
+	}
+
+	if ret, err := call("give", "alice", remoteItem{"sword", 2}); err != nil || ret != "alice got 2 sword" {
+		t.Fatalf("got %v %v", ret, err)
+	}
+	if ret, err := call("split", 7); err != nil || !reflect.DeepEqual(ret, []interface{}{3, 1}) {
+		t.Fatalf("got %v %v", ret, err)
+	}
+	if ret, err := call("kick"); err != nil || ret != nil {
+		t.Fatalf("got %v %v", ret, err)
+	}
+
+	_, err := call("fail")
+	var remoteErr *RemoteError
+	if !errors.As(err, &remoteErr) || remoteErr.Msg != "bad item" {
+		t.Fatalf("got %v, want the panic of the remote function", err)
+	}
+	if _, err := call("missing"); err == nil || !strings.Contains(err.Error(), ErrNotRegistered.Error()) {
+		t.Fatalf("got %v, want not registered", err)
+	}
+	// bytes which are not a call
+	if ret, err := s.ExecRemote(GobCodec, []byte("garbage")); err != nil {
+		t.Fatal(err)
+	} else if _, err := UnmarshalRet(GobCodec, ret); err == nil {
+		t.Fatal("invalid call executed")
+	}
+}
@@ -0,0 +1,28 @@
+package chanrpc
+
+import (
+	"time"
+)
+
+// a call scheduled by GoAfter
+type DelayedCall struct {
+	t *time.Timer
+}
+
+// the call is sent to ChanCall after d and executed like a call of Go,
+// it is dropped if the function is not registered or the server is closed
+// by then
+// goroutine safe
+func (s *Server) GoAfter(d time.Duration, id interface{}, args ...interface{}) *DelayedCall {
+	c := new(DelayedCall)
+	c.t = time.AfterFunc(d, func() {
+		s.GoChecked(id, args...)
+	})
+	return c
+}
+
+// returns false if the call has already been sent to ChanCall
+// goroutine safe
+func (c *DelayedCall) Stop() bool {
+	return c.t.Stop()
+}
@@ -0,0 +1,112 @@
+package chanrpc
+
+import (
+	"container/list"
+	"reflect"
+)
+
+// calls from the same origin (client or GoFrom) in FIFO order,
+// origins served round-robin
+type fairQueue struct {
+	origins *list.List
+	index   map[interface{}]*list.Element
+}
+
+type originQueue struct {
+	origin interface{}
+	calls  []*CallInfo
+}
+
+func (q *fairQueue) push(ci *CallInfo) {
+	if q.origins == nil {
+		q.origins = list.New()
+		q.index = make(map[interface{}]*list.Element)
+	}
+
+	origin := ci.origin
+	if origin != nil && !reflect.TypeOf(origin).Comparable() {
+		origin = nil
+	}
+	e, ok := q.index[origin]
+	if !ok {
+		e = q.origins.PushBack(&originQueue{origin: origin})
+		q.index[origin] = e
+	}
+	oq := e.Value.(*originQueue)
+	oq.calls = append(oq.calls, ci)
+}
+
+func (q *fairQueue) pop() *CallInfo {
+	if q.origins == nil || q.origins.Len() == 0 {
+		return nil
+	}
+
+	e := q.origins.Front()
+	oq := e.Value.(*originQueue)
+	ci := oq.calls[0]
+	oq.calls[0] = nil
+	oq.calls = oq.calls[1:]
+	if len(oq.calls) == 0 {
+		q.origins.Remove(e)
+		delete(q.index, oq.origin)
+	} else {
+		q.origins.MoveToBack(e)
+	}
+	return ci
+}
+
+// sent to ChanCall while calls are left in the fair queue, so that Exec is
+// called again by the loop of the server
+var fairWake = new(CallInfo)
+
+// moves the calls already in ChanCall to the fair queue, at most its
+// capacity so that a steady flow of calls does not keep it draining
+func (s *Server) drain() {
+	for i := 0; i < cap(s.ChanCall); i++ {
+		select {
+		case ci, ok := <-s.ChanCall:
+			if !ok {
+				return
+			}
+			if ci == fairWake {
+				s.fairWaking = false
+				continue
+			}
+			s.fair.push(ci)
+		default:
+			return
+		}
+	}
+}
+
+// one call per Exec, the loop of the server goes on between the calls
+func (s *Server) execFair(ci *CallInfo) {
+	if ci == fairWake {
+		s.fairWaking = false
+	} else {
+		s.fair.push(ci)
+	}
+	s.drain()
+	if ci := s.fair.pop(); ci != nil {
+		s.exec1(ci)
+	}
+	if s.fair.origins.Len() > 0 {
+		s.wake()
+	}
+}
+
+// a full ChanCall has calls that will call Exec anyway
+func (s *Server) wake() {
+	if s.fairWaking {
+		return
+	}
+	defer func() {
+		// closed
+		recover()
+	}()
+	select {
+	case s.ChanCall <- fairWake:
+		s.fairWaking = true
+	default:
+	}
+}
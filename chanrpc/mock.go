@@ -0,0 +1,110 @@
+package chanrpc
+
+import (
+	"reflect"
+	"sync"
+)
+
+// a Server answering the calls with the results programmed by On, the
+// calls are executed by a goroutine of the mock and recorded, for the
+// tests of the callers
+// goroutine safe
+type MockServer struct {
+	*Server
+	mutex sync.Mutex
+	calls []MockCall
+	done  chan struct{}
+}
+
+type MockCall struct {
+	ID   interface{}
+	Args []interface{}
+}
+
+// the results of a function id of a MockServer
+type MockFunction struct {
+	m  *MockServer
+	id interface{}
+}
+
+func NewMockServer() *MockServer {
+	m := new(MockServer)
+	m.Server = NewServer(100)
+	m.done = make(chan struct{})
+	go func() {
+		for ci := range m.ChanCall {
+			m.Exec(ci)
+		}
+		close(m.done)
+	}()
+	return m
+}
+
+// an id can be programmed once
+func (m *MockServer) On(id interface{}) *MockFunction {
+	return &MockFunction{m, id}
+}
+
+// no result answers Call0, one result answers Call1
+func (f *MockFunction) Return(rets ...interface{}) {
+	switch len(rets) {
+	case 0:
+		f.m.Register(f.id, func(args []interface{}) {
+			f.m.record(f.id, args)
+		})
+	case 1:
+		f.m.Register(f.id, func(args []interface{}) interface{} {
+			f.m.record(f.id, args)
+			return rets[0]
+		})
+	default:
+		f.ReturnN(rets...)
+	}
+}
+
+// answers CallN
+func (f *MockFunction) ReturnN(rets ...interface{}) {
+	f.m.Register(f.id, func(args []interface{}) []interface{} {
+		f.m.record(f.id, args)
+		return rets
+	})
+}
+
+// the call fails with an error formatting v, like a panicking function
+func (f *MockFunction) Panic(v interface{}) {
+	f.m.Register(f.id, func(args []interface{}) interface{} {
+		f.m.record(f.id, args)
+		panic(v)
+	})
+}
+
+func (m *MockServer) record(id interface{}, args []interface{}) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.calls = append(m.calls, MockCall{id, args})
+}
+
+// the calls executed, in order
+func (m *MockServer) Calls() []MockCall {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]MockCall(nil), m.calls...)
+}
+
+// the arguments of the calls of id executed, in order
+func (m *MockServer) CallsOf(id interface{}) [][]interface{} {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var calls [][]interface{}
+	for _, c := range m.calls {
+		if reflect.DeepEqual(c.ID, id) {
+			calls = append(calls, c.Args)
+		}
+	}
+	return calls
+}
+
+func (m *MockServer) Close() {
+	m.Server.Close()
+	<-m.done
+}
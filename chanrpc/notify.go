@@ -0,0 +1,65 @@
+package chanrpc
+
+// the messages passed to notify by the function are sent to the caller
+// before the result, the function blocks until the caller takes the previous
+// one, the messages of a call made by Go are discarded
+func (s *Server) notify(ci *CallInfo, msg interface{}) {
+	if ci.chanRet == nil {
+		return
+	}
+	ci.chanRet <- &RetInfo{ret: msg, notification: true}
+}
+
+// calls a function registered as
+// func(args []interface{}, notify func(msg interface{})) interface{}
+// notify is called with the messages of the function in order on the
+// calling goroutine, then CallNotify returns the result of the function
+// notify must not call the server synchronously, when it panics the
+// remaining messages and the result are taken before the panic goes on
+func (c *Client) CallNotify(id interface{}, notify func(msg interface{}), args ...interface{}) (interface{}, error) {
+	f, err := c.f(id, 3, args)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.call(&CallInfo{
+		id:      id,
+		f:       f,
+		args:    args,
+		chanRet: c.chanSyncRet,
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	done := false
+	defer func() {
+		if done {
+			return
+		}
+		// the function waits for its messages to be taken and the client
+		// must be left without a result
+		for ri := range c.chanSyncRet {
+			if !ri.notification {
+				break
+			}
+		}
+	}()
+	for {
+		ri := <-c.chanSyncRet
+		if !ri.notification {
+			done = true
+			return ri.ret, ri.err
+		}
+		if notify != nil {
+			notify(ri.ret)
+		}
+	}
+}
+
+// goroutine safe
+func (s *Server) CallNotify(id interface{}, notify func(msg interface{}), args ...interface{}) (interface{}, error) {
+	c := s.syncClient()
+	defer s.clients.Put(c)
+	return c.CallNotify(id, notify, args...)
+}
@@ -0,0 +1,30 @@
+package chanrpc
+
+import (
+	"github.com/name5566/leaf/log"
+)
+
+// f is called with every call executed, whatever its id, before the
+// function of the call, e.g. for an audit trail
+// f gets a copy of the arguments and cannot alter the call, a panic of f
+// is logged and the call is executed anyway
+// f is called on the goroutine executing the call (must be goroutine safe
+// with ServePool)
+// you must call the function before calling Exec
+func (s *Server) Observe(f func(id interface{}, args []interface{})) {
+	s.observers = append(s.observers, f)
+}
+
+func (s *Server) observe(ci *CallInfo) {
+	for _, f := range s.observers {
+		args := append([]interface{}(nil), ci.args...)
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Error("function id %v: observer: %v", ci.id, r)
+				}
+			}()
+			f(ci.id, args)
+		}()
+	}
+}
@@ -0,0 +1,59 @@
+package chanrpc
+
+import (
+	"fmt"
+	"sync"
+)
+
+// executes the calls on n goroutines until ChanCall is closed (Close),
+// the functions then run concurrently and must be goroutine safe, unlike
+// the functions of a server owned by a single goroutine (e.g. a module)
+// FairScheduling is ignored, Context is not available and a synchronous
+// call to the own server is not detected as reentrant, see SetConcurrency
+// you must not call Exec on the server besides
+func (s *Server) ServePool(n int) {
+	if n <= 0 {
+		n = 1
+	}
+	s.pooled = true
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			for ci := range s.ChanCall {
+				s.exec1(ci)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// at most n calls of the function run at once under ServePool, n <= 0
+// means no limit (the default), e.g. 1 for a function touching shared
+// state, a worker waits for its turn instead of executing another call
+// you must call the function before calling ServePool
+func (s *Server) SetConcurrency(id interface{}, n int) {
+	s.mutexFunctions.Lock()
+	defer s.mutexFunctions.Unlock()
+	if _, ok := s.functions[id]; !ok {
+		panic(fmt.Sprintf("function id %v: function not registered", id))
+	}
+
+	if n <= 0 {
+		delete(s.limits, id)
+		return
+	}
+	if s.limits == nil {
+		s.limits = make(map[interface{}]chan struct{})
+	}
+	s.limits[id] = make(chan struct{}, n)
+}
+
+// returns nil if the function is not limited
+func (s *Server) limit(id interface{}) chan struct{} {
+	s.mutexFunctions.RLock()
+	defer s.mutexFunctions.RUnlock()
+	return s.limits[id]
+}
@@ -0,0 +1,51 @@
+package chanrpc
+
+import (
+	"context"
+	"errors"
+)
+
+// a synchronous call made by a function called by Exec to the same server
+// would wait for itself forever, it is detected when made with the context
+// of the call being executed (Context) or one derived from it, which must
+// not be used by other goroutines before the call returns
+var ErrReentrantCall = errors.New("chanrpc reentrant call")
+
+type execKey struct{}
+
+// the call being executed, a context of an earlier call is not reentrant
+type execMark struct {
+	s   *Server
+	seq uint64
+}
+
+func (s *Server) enter() {
+	s.execSeq.Add(1)
+	s.execCtx = nil
+	s.executing.Store(true)
+}
+
+func (s *Server) leave() {
+	s.executing.Store(false)
+	s.execCtx = nil
+}
+
+// made on demand, a function not asking for its context allocates nothing
+func (s *Server) markedContext() context.Context {
+	if s.execCtx == nil {
+		parent := s.ctx
+		if parent == nil {
+			parent = context.Background()
+		}
+		s.execCtx = context.WithValue(parent, execKey{}, execMark{s: s, seq: s.execSeq.Load()})
+	}
+	return s.execCtx
+}
+
+func (s *Server) reentrant(ctx context.Context) bool {
+	if ctx == nil || !s.executing.Load() {
+		return false
+	}
+	m, ok := ctx.Value(execKey{}).(execMark)
+	return ok && m.s == s && m.seq == s.execSeq.Load()
+}
@@ -0,0 +1,115 @@
+package chanrpc
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+// encodes the calls forwarded to a server of another process and their
+// results
+// must be goroutine safe
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(v)
+	return b.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// the types of the ids and arguments other than the basic ones must be
+// registered by gob.Register on both sides
+var GobCodec Codec = gobCodec{}
+
+type remoteCall struct {
+	ID   interface{}
+	Args []interface{}
+}
+
+type remoteRet struct {
+	Ret interface{}
+	// the results of a func(args []interface{}) []interface{}
+	Rets []interface{}
+	N    bool
+	Err  string
+}
+
+// the error of a remote call, only its text crosses the process boundary
+type RemoteError struct {
+	Msg string
+}
+
+func (e *RemoteError) Error() string {
+	return e.Msg
+}
+
+// the bytes of the call, to be passed to Server.ExecRemote by the other
+// process however it is transported
+func MarshalCall(c Codec, id interface{}, args ...interface{}) ([]byte, error) {
+	return c.Marshal(&remoteCall{ID: id, Args: args})
+}
+
+// decodes a call made by MarshalCall, calls the function and waits for its
+// result, the returned bytes are for UnmarshalRet
+// a call failing (not registered, panicking, invalid bytes...) is returned
+// as a result too, the error is only returned when the result cannot be
+// encoded at all
+// goroutine safe, must not be called on the goroutine of the server
+func (s *Server) ExecRemote(c Codec, call []byte) ([]byte, error) {
+	var ci remoteCall
+	var ri remoteRet
+	if err := c.Unmarshal(call, &ci); err != nil {
+		ri.Err = fmt.Sprintf("decode call: %v", err)
+		return c.Marshal(&ri)
+	}
+
+	var err error
+	switch s.function(ci.ID).(type) {
+	case func([]interface{}):
+		err = s.Call0(ci.ID, ci.Args...)
+	case func([]interface{}) interface{}:
+		ri.Ret, err = s.Call1(ci.ID, ci.Args...)
+	case func([]interface{}) []interface{}:
+		ri.Rets, err = s.CallN(ci.ID, ci.Args...)
+		ri.N = true
+	case nil:
+		err = fmt.Errorf("function id %v: %w", ci.ID, ErrNotRegistered)
+	default:
+		err = fmt.Errorf("function id %v: not callable remotely", ci.ID)
+	}
+	if err != nil {
+		ri = remoteRet{Err: err.Error()}
+	}
+
+	data, err := c.Marshal(&ri)
+	if err != nil {
+		return c.Marshal(&remoteRet{Err: fmt.Sprintf("function id %v: encode result: %v", ci.ID, err)})
+	}
+	return data, nil
+}
+
+// the result of a call executed by Server.ExecRemote, like Call0, Call1 or
+// CallN depending on the function: nil, interface{} or []interface{}
+// the error of the call is a *RemoteError
+func UnmarshalRet(c Codec, ret []byte) (interface{}, error) {
+	var ri remoteRet
+	if err := c.Unmarshal(ret, &ri); err != nil {
+		return nil, err
+	}
+	if ri.Err != "" {
+		return nil, &RemoteError{Msg: ri.Err}
+	}
+	if ri.N {
+		return ri.Rets, nil
+	}
+	return ri.Ret, nil
+}
@@ -0,0 +1,86 @@
+package chanrpc
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var ErrInvalidArgs = errors.New("invalid arguments")
+
+// the expected arguments of a function by position, the arity is the
+// length of the schema
+// an element is a reflect.Type the argument must be assignable to,
+// a reflect.Kind the argument must be of, or nil for any argument
+// a nil argument is only valid for the types which can be nil
+type Schema []interface{}
+
+// like Register, the arguments of each call are checked against schema by
+// Exec, a call with invalid arguments is not executed and returns an error
+// wrapping ErrInvalidArgs to the caller
+// you must call the function before calling Open and Go
+func (s *Server) RegisterWithSchema(id interface{}, f interface{}, schema Schema) {
+	for i, e := range schema {
+		switch e.(type) {
+		case nil, reflect.Type, reflect.Kind:
+		default:
+			panic(fmt.Sprintf("function id %v: invalid schema element %v: %v", id, i, e))
+		}
+	}
+
+	s.Register(id, f)
+
+	s.mutexFunctions.Lock()
+	defer s.mutexFunctions.Unlock()
+	if s.schemas == nil {
+		s.schemas = make(map[interface{}]Schema)
+	}
+	s.schemas[id] = schema
+}
+
+func (s *Server) validate(ci *CallInfo) error {
+	s.mutexFunctions.RLock()
+	schema, ok := s.schemas[ci.id]
+	s.mutexFunctions.RUnlock()
+	if !ok {
+		return nil
+	}
+	return schema.validate(ci.id, ci.args)
+}
+
+func (schema Schema) validate(id interface{}, args []interface{}) error {
+	if len(args) != len(schema) {
+		return fmt.Errorf("function id %v: %v arguments, want %v: %w", id, len(args), len(schema), ErrInvalidArgs)
+	}
+	for i, arg := range args {
+		var ok bool
+		switch e := schema[i].(type) {
+		case nil:
+			ok = true
+		case reflect.Type:
+			if arg == nil {
+				ok = nilable(e.Kind())
+			} else {
+				ok = reflect.TypeOf(arg).AssignableTo(e)
+			}
+		case reflect.Kind:
+			if arg == nil {
+				ok = nilable(e)
+			} else {
+				ok = reflect.TypeOf(arg).Kind() == e
+			}
+		}
+		if !ok {
+			return fmt.Errorf("function id %v: argument %v is %T, want %v: %w", id, i, arg, schema[i], ErrInvalidArgs)
+		}
+	}
+	return nil
+}
+
+func nilable(k reflect.Kind) bool {
+	switch k {
+	case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package chanrpc
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// f is func(req T) or func(req T) R where T is a struct,
+// the call arguments are assigned to the fields of T by order,
+// f is called with Call0 or Call1
+// you must call the function before calling Open and Go
+func (s *Server) RegisterStruct(id interface{}, f interface{}) {
+	v := reflect.ValueOf(f)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.In(0).Kind() != reflect.Struct || t.NumOut() > 1 {
+		panic(fmt.Sprintf("function id %v: definition of struct function is invalid", id))
+	}
+	req := t.In(0)
+	for i := 0; i < req.NumField(); i++ {
+		if req.Field(i).PkgPath != "" {
+			panic(fmt.Sprintf("function id %v: field %v of %v is not exported", id, req.Field(i).Name, req))
+		}
+	}
+
+	call := func(args []interface{}) []reflect.Value {
+		if len(args) != req.NumField() {
+			panic(fmt.Errorf("function id %v: %v arguments, %v has %v fields", id, len(args), req, req.NumField()))
+		}
+		in := reflect.New(req).Elem()
+		for i, arg := range args {
+			field := in.Field(i)
+			if arg == nil {
+				continue
+			}
+			a := reflect.ValueOf(arg)
+			if !a.Type().AssignableTo(field.Type()) {
+				panic(fmt.Errorf("function id %v: cannot assign argument %v of type %v to %v.%v",
+					id, i, a.Type(), req, req.Field(i).Name))
+			}
+			field.Set(a)
+		}
+		return v.Call([]reflect.Value{in})
+	}
+
+	if t.NumOut() == 0 {
+		s.Register(id, func(args []interface{}) {
+			call(args)
+		})
+	} else {
+		s.Register(id, func(args []interface{}) interface{} {
+			return call(args)[0].Interface()
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package chanrpc
+
+import (
+	"context"
+)
+
+type traceKey struct{}
+
+// the trace id is passed to a function with the context of the call,
+// a function propagates it by calling with Server.Context
+func WithTrace(ctx context.Context, trace string) context.Context {
+	return context.WithValue(ctx, traceKey{}, trace)
+}
+
+// returns "" if ctx has no trace id
+func TraceID(ctx context.Context) string {
+	trace, _ := ctx.Value(traceKey{}).(string)
+	return trace
+}
+
+func traceSuffix(trace string) string {
+	if trace == "" {
+		return ""
+	}
+	return " (trace " + trace + ")"
+}
@@ -0,0 +1,60 @@
+package chanrpc
+
+// the results of asynchronous calls are queued without limit,
+// AsynCall never fails with ErrTooManyPendingAsynCall
+func NewUnboundedClient() *Client {
+	c := new(Client)
+	c.chanSyncRet = make(chan *RetInfo, 1)
+	c.ChanAsynRet = make(chan *RetInfo)
+	c.chanAsynIn = make(chan *RetInfo, 16)
+	c.unbounded = true
+	return c
+}
+
+// goroutine safe
+func (s *Server) OpenUnbounded() *Client {
+	c := NewUnboundedClient()
+	c.Attach(s)
+	return c
+}
+
+// the pump runs only while results are in flight
+func (c *Client) startPump() {
+	c.mutexPump.Lock()
+	defer c.mutexPump.Unlock()
+
+	c.inflight++
+	if !c.pumping {
+		c.pumping = true
+		go c.pump()
+	}
+}
+
+func (c *Client) pump() {
+	var queue []*RetInfo
+	for {
+		var out chan *RetInfo
+		var first *RetInfo
+		if len(queue) > 0 {
+			out = c.ChanAsynRet
+			first = queue[0]
+		}
+
+		select {
+		case ri := <-c.chanAsynIn:
+			queue = append(queue, ri)
+		case out <- first:
+			queue[0] = nil
+			queue = queue[1:]
+
+			c.mutexPump.Lock()
+			c.inflight--
+			if c.inflight == 0 {
+				c.pumping = false
+				c.mutexPump.Unlock()
+				return
+			}
+			c.mutexPump.Unlock()
+		}
+	}
+}
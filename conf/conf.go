@@ -1,5 +1,9 @@
 package conf
 
+import (
+	"time"
+)
+
 var (
 	LenStackBuf = 4096
 
@@ -8,11 +12,19 @@ var (
 	LogPath  string
 	LogFlag  int
 
+	// module
+	// OnInit and OnDestroy taking longer are logged as slow, 0 means never
+	SlowModuleThreshold time.Duration
+
 	// console
 	ConsolePort   int
 	ConsolePrompt string = "Leaf# "
 	ProfilePath   string
 
+	// pprof
+	PprofAddr        string
+	PprofAllowPublic bool
+
 	// cluster
 	ListenAddr      string
 	ConnAddrs       []string
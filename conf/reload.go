@@ -0,0 +1,197 @@
+package conf
+
+import (
+	"encoding/json"
+	"github.com/name5566/leaf/log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// the variables of the package, a JSON file holds some or all of them
+// under the same names, durations are in nanoseconds
+type Config struct {
+	LenStackBuf         int
+	LogLevel            string
+	LogPath             string
+	LogFlag             int
+	SlowModuleThreshold time.Duration
+	ConsolePort         int
+	ConsolePrompt       string
+	ProfilePath         string
+	PprofAddr           string
+	PprofAllowPublic    bool
+	ListenAddr          string
+	ConnAddrs           []string
+	PendingWriteNum     int
+}
+
+var (
+	mutexReload sync.Mutex
+	onChange    []func(old, new Config)
+	// the values in effect after a reload, the variables are not written
+	// while the modules may be reading them
+	reloaded atomic.Pointer[Config]
+)
+
+// a snapshot of the variables, with the values of the last reload
+// goroutine safe once leaf.Run is called
+func Current() Config {
+	c := Config{
+		LenStackBuf:         LenStackBuf,
+		LogLevel:            LogLevel,
+		LogPath:             LogPath,
+		LogFlag:             LogFlag,
+		SlowModuleThreshold: SlowModuleThreshold,
+		ConsolePort:         ConsolePort,
+		ConsolePrompt:       ConsolePrompt,
+		ProfilePath:         ProfilePath,
+		PprofAddr:           PprofAddr,
+		PprofAllowPublic:    PprofAllowPublic,
+		ListenAddr:          ListenAddr,
+		ConnAddrs:           ConnAddrs,
+		PendingWriteNum:     PendingWriteNum,
+	}
+	if r := reloaded.Load(); r != nil {
+		c.LenStackBuf = r.LenStackBuf
+		c.LogLevel = r.LogLevel
+		c.SlowModuleThreshold = r.SlowModuleThreshold
+		c.ConsolePrompt = r.ConsolePrompt
+		c.ProfilePath = r.ProfilePath
+	}
+	return c
+}
+
+func set(c Config) {
+	LenStackBuf = c.LenStackBuf
+	LogLevel = c.LogLevel
+	LogPath = c.LogPath
+	LogFlag = c.LogFlag
+	SlowModuleThreshold = c.SlowModuleThreshold
+	ConsolePort = c.ConsolePort
+	ConsolePrompt = c.ConsolePrompt
+	ProfilePath = c.ProfilePath
+	PprofAddr = c.PprofAddr
+	PprofAllowPublic = c.PprofAllowPublic
+	ListenAddr = c.ListenAddr
+	ConnAddrs = c.ConnAddrs
+	PendingWriteNum = c.PendingWriteNum
+	reloaded.Store(nil)
+}
+
+// only the values read at runtime are changed by a reload: LenStackBuf,
+// LogLevel, SlowModuleThreshold, ConsolePrompt and ProfilePath, the others
+// are read once by leaf.Run and are kept
+// the variables keep the values set before leaf.Run, Current returns the
+// values in effect
+func setRuntime(c Config) {
+	reloaded.Store(&c)
+}
+
+func read(path string) (Config, error) {
+	c := Current()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// sets the variables present in the JSON file
+// you must call the function before calling leaf.Run
+func Load(path string) error {
+	mutexReload.Lock()
+	defer mutexReload.Unlock()
+
+	c, err := read(path)
+	if err != nil {
+		return err
+	}
+	set(c)
+	return nil
+}
+
+// f is called on the goroutine of Watch after a reload changing a value,
+// new holds the values in effect
+// goroutine safe
+func OnChange(f func(old, new Config)) {
+	mutexReload.Lock()
+	defer mutexReload.Unlock()
+	onChange = append(onChange, f)
+}
+
+// the modification time of the file is polled every interval, the file is
+// reloaded when it changes and a file failing to load is ignored
+func Watch(path string, interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = time.Second
+		log.Release("invalid interval, reset to %v", interval)
+	}
+
+	var modTime time.Time
+	if fi, err := os.Stat(path); err == nil {
+		modTime = fi.ModTime()
+	}
+
+	closeSig := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-closeSig:
+				return
+			}
+			fi, err := os.Stat(path)
+			if err != nil || fi.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = fi.ModTime()
+			if err := reload(path); err != nil {
+				log.Error("reload %v: %v", path, err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(closeSig)
+			<-done
+		})
+	}
+}
+
+func reload(path string) error {
+	mutexReload.Lock()
+	defer mutexReload.Unlock()
+
+	c, err := read(path)
+	if err != nil {
+		return err
+	}
+	old := Current()
+	if c.LogLevel != old.LogLevel {
+		if err := log.SetLevel(c.LogLevel); err != nil {
+			return err
+		}
+	}
+	setRuntime(c)
+	now := Current()
+	if old.LenStackBuf == now.LenStackBuf &&
+		old.LogLevel == now.LogLevel &&
+		old.SlowModuleThreshold == now.SlowModuleThreshold &&
+		old.ConsolePrompt == now.ConsolePrompt &&
+		old.ProfilePath == now.ProfilePath {
+		return nil
+	}
+	for _, f := range onChange {
+		f(old, now)
+	}
+	return nil
+}
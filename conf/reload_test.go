@@ -0,0 +1,105 @@
+package conf_test
+
+import (
+	"encoding/json"
+	"github.com/name5566/leaf/conf"
+	"github.com/name5566/leaf/log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConf(t *testing.T, path string, data string, modTime time.Time) {
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	saved := conf.Current()
+	defer func() {
+		if err := conf.Load(writeSaved(t, saved)); err != nil {
+			t.Fatal(err)
+		}
+		log.SetLevel("debug")
+	}()
+
+	path := filepath.Join(t.TempDir(), "leaf.json")
+	now := time.Now()
+	writeConf(t, path, `{"LogLevel": "debug", "LenStackBuf": 1024, "ConsolePrompt": "> "}`, now)
+	if err := conf.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if conf.LogLevel != "debug" || conf.LenStackBuf != 1024 || conf.ConsolePrompt != "> " {
+		t.Fatalf("not loaded: %+v", conf.Current())
+	}
+
+	changes := make(chan [2]conf.Config, 10)
+	conf.OnChange(func(old, new conf.Config) {
+		changes <- [2]conf.Config{old, new}
+	})
+	stop := conf.Watch(path, 10*time.Millisecond)
+	defer stop()
+
+	// read by the modules during the reloads
+	reading := make(chan struct{})
+	defer close(reading)
+	go func() {
+		for {
+			select {
+			case <-reading:
+				return
+			default:
+				_ = conf.Current().LenStackBuf
+			}
+		}
+	}()
+
+	writeConf(t, path, `{"LogLevel": "error", "LenStackBuf": 2048, "SlowModuleThreshold": 1000000000}`, now.Add(time.Second))
+	select {
+	case c := <-changes:
+		old, new := c[0], c[1]
+		if old.LenStackBuf != 1024 || new.LenStackBuf != 2048 || new.SlowModuleThreshold != time.Second {
+			t.Fatalf("got %+v -> %+v", old, new)
+		}
+		if old.LogLevel != "debug" || new.LogLevel != "error" {
+			t.Fatalf("LogLevel %v -> %v", old.LogLevel, new.LogLevel)
+		}
+		// kept when absent from the file
+		if new.ConsolePrompt != "> " {
+			t.Fatalf("ConsolePrompt reset to %q", new.ConsolePrompt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("change not notified")
+	}
+
+	// nothing to reload at runtime
+	writeConf(t, path, `{"PendingWriteNum": 10, "LenStackBuf": 2048, "SlowModuleThreshold": 1000000000}`, now.Add(2*time.Second))
+	// unknown level
+	writeConf(t, path, `{"LogLevel": "verbose", "LenStackBuf": 4096}`, now.Add(3*time.Second))
+	// malformed
+	writeConf(t, path, `{"LenStackBuf": `, now.Add(4*time.Second))
+	select {
+	case c := <-changes:
+		t.Fatalf("unexpected change %+v -> %+v", c[0], c[1])
+	case <-time.After(100 * time.Millisecond):
+	}
+	stop()
+	if n := conf.Current().LenStackBuf; n != 2048 {
+		t.Fatalf("LenStackBuf %v", n)
+	}
+}
+
+func writeSaved(t *testing.T, c conf.Config) string {
+	path := filepath.Join(t.TempDir(), "saved.json")
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeConf(t, path, string(data), time.Now())
+	return path
+}
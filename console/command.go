@@ -18,11 +18,11 @@ var commands = []Command{
 }
 
 type Command interface {
-	// must goroutine safe
+	// must be goroutine safe
 	name() string
-	// must goroutine safe
+	// must be goroutine safe
 	help() string
-	// must goroutine safe
+	// must be goroutine safe
 	run(args []string) string
 }
 
@@ -76,6 +76,41 @@ func Register(name string, help string, f interface{}, server *chanrpc.Server) {
 	commands = append(commands, c)
 }
 
+type funcCommand struct {
+	_name string
+	_help string
+	f     func(args []string) string
+}
+
+func (c *funcCommand) name() string {
+	return c._name
+}
+
+func (c *funcCommand) help() string {
+	return c._help
+}
+
+func (c *funcCommand) run(args []string) string {
+	return c.f(args)
+}
+
+// f is called on the goroutine of the console session (must be goroutine safe)
+// you must call the function before calling console.Init
+// goroutine not safe
+func RegisterFunc(name string, help string, f func(args []string) string) {
+	for _, c := range commands {
+		if c.name() == name {
+			log.Fatal("command %v is already registered", name)
+		}
+	}
+
+	c := new(funcCommand)
+	c._name = name
+	c._help = help
+	c.f = f
+	commands = append(commands, c)
+}
+
 // help
 type CommandHelp struct{}
 
@@ -144,7 +179,7 @@ func (c *CommandCPUProf) run(args []string) string {
 
 func profileName() string {
 	now := time.Now()
-	return path.Join(conf.ProfilePath,
+	return path.Join(conf.Current().ProfilePath,
 		fmt.Sprintf("%d%02d%02d_%02d_%02d_%02d",
 			now.Year(),
 			now.Month(),
@@ -45,8 +45,8 @@ func newAgent(conn *network.TCPConn) network.Agent {
 
 func (a *Agent) Run() {
 	for {
-		if conf.ConsolePrompt != "" {
-			a.conn.Write([]byte(conf.ConsolePrompt))
+		if prompt := conf.Current().ConsolePrompt; prompt != "" {
+			a.conn.Write([]byte(prompt))
 		}
 
 		line, err := a.reader.ReadString('\n')
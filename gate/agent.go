@@ -1,15 +1,55 @@
 package gate
 
 import (
+	"crypto/tls"
 	"net"
 )
 
+// the write methods are goroutine safe (broadcasts, other modules),
+// a message is never interleaved with another one
 type Agent interface {
 	WriteMsg(msg interface{})
+	// a high priority message is written before the pending low priority
+	// ones, on TCP connections only
+	WriteMsgPriority(msg interface{}, high bool)
+	// msgs are written at once, in a single frame on TCP connections when
+	// Gate.BatchFrames is set
+	WriteBatched(msgs ...interface{})
+	// data must be the output of Processor.Marshal, it is framed by the
+	// connection as usual but neither marshaled nor intercepted
+	WriteRaw(data ...[]byte)
 	LocalAddr() net.Addr
 	RemoteAddr() net.Addr
+	// TransportTCP, TransportWS or TransportUDP
+	Transport() string
+	// e.g. the verified client certificates (PeerCertificates),
+	// false if the connection does not use TLS
+	ConnectionState() (tls.ConnectionState, bool)
 	Close()
 	Destroy()
 	UserData() interface{}
 	SetUserData(data interface{})
+	// goroutine safe
+	Authenticated() bool
+	// goroutine safe
+	SetAuthenticated(authenticated bool)
+	// goroutine safe
+	Identity() interface{}
+	// identity is the application key of the agent once authenticated,
+	// e.g. a user id, it must be comparable, see Gate.KickMsg
+	// goroutine safe
+	SetIdentity(identity interface{})
+	// goroutine safe
+	DroppedMsgs() DroppedMsgs
+	// the messages queued and not written yet, e.g. to send less to a
+	// congested client, the connection is closed beyond PendingWriteCap
+	// goroutine safe
+	PendingWrites() int
+	// goroutine safe
+	PendingWriteCap() int
+	// the close code and reason sent by the client of a websocket
+	// connection, e.g. in the CloseAgent function of AgentChanRPC, see
+	// network.WSConn.CloseStatus, 0 on the other transports
+	// goroutine safe
+	CloseStatus() (code int, reason string)
 }
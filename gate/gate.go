@@ -1,21 +1,87 @@
 package gate
 
 import (
+	"bytes"
+	"crypto/tls"
+	"errors"
 	"github.com/name5566/leaf/chanrpc"
 	"github.com/name5566/leaf/log"
 	"github.com/name5566/leaf/network"
+	"github.com/name5566/leaf/network/protobuf"
 	"net"
+	"os"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Gate struct {
 	MaxConnNum      int
+	MaxConnPerIP    int
 	PendingWriteNum int
 	MaxMsgLen       uint32
 	Processor       network.Processor
 	AgentChanRPC    *chanrpc.Server
 
+	// "tcp" (default), "tcp4" or "tcp6" for the TCP and WebSocket servers
+	Network string
+	// the servers are started once WaitReady is closed, e.g. module.Ready()
+	WaitReady <-chan struct{}
+	// the agents stop reading while CanAccept returns false, pushing back on
+	// the clients, e.g. when the queue of AgentChanRPC is almost full
+	// must be goroutine safe
+	CanAccept func() bool
+	// TCP and WebSocket connections receiving no message within IdleTimeout
+	// are closed, 0 means never, UDP sessions expire after UDPIdleTimeout
+	IdleTimeout time.Duration
+
+	// protocol version -> processor, when not empty the first message of
+	// a connection is the version declared by the client, the server echoes
+	// the version back or closes the connection if it is not supported
+	VersionProcessors map[string]network.Processor
+
+	// messages accepted before the agent is authenticated,
+	// all messages are accepted if empty
+	PreAuthMsgs []interface{}
+	// disconnect after so many rejected messages, 0 means never
+	MaxPreAuthViolations int
+	// messages failing to unmarshal or to route, and the TCP messages longer
+	// than MaxMsgLen with SkipMsgTooLong, are dropped, the connection is
+	// closed when more than MaxDroppedMsgs are
+	MaxDroppedMsgs int
+	// a TCP message longer than MaxMsgLen is read and dropped instead of
+	// closing the connection at once, see network.MsgParser.SetSkipTooLong
+	SkipMsgTooLong bool
+	// receives a copy of every message read or written, for debugging
+	FrameLogger network.FrameLogger
+	// called when a connection is refused by the gate
+	OnRejectConn func(addr net.Addr, reason string)
+	// admission control of the TCP connections, see network.TCPServer,
+	// a rejection is reported to OnRejectConn
+	// must be goroutine safe
+	ShouldAccept func(conn net.Conn) (accept bool, delay time.Duration)
+	// the agent holding an identity (Agent.SetIdentity) is closed when
+	// another agent sets the same identity, KickMsg is written to it first
+	// if not nil, e.g. to report a login from elsewhere
+	KickMsg interface{}
+	// called with the marshaled message before it is written,
+	// the returned data is written instead, an error aborts the write
+	// must be goroutine safe
+	WriteInterceptor func(a Agent, msg interface{}, data [][]byte) ([][]byte, error)
+	// a warning is logged when the handler of a message is still running
+	// after it, 0 means no warning
+	// the messages routed to a chanrpc server are only queued by the agent,
+	// their handlers are timed by the SlowCallThreshold of the server
+	MsgHandleTimeout time.Duration
+	// on shutdown the agents are closed gracefully, the pending messages
+	// are written, the connections still open after DrainTimeout are
+	// destroyed, 0 means no draining
+	DrainTimeout time.Duration
+	// called for each agent on shutdown before it is closed when
+	// DrainTimeout is set, e.g. to notify the client of a restart
+	OnShutdown func(a Agent)
+
 	// websocket
 	WSAddr      string
 	HTTPTimeout time.Duration
@@ -26,43 +92,158 @@ type Gate struct {
 	TCPAddr      string
 	LenMsgLen    int
 	LittleEndian bool
+	// see network.TCPServer, the data passed to Processor.Unmarshal is then
+	// only valid during the call, the raw messages of network/protobuf keep
+	// it and are unmarshaled again from a copy
+	ReadBufferSize int
+	// see network.TCPServer
+	ReadBytesPerSec int
+	// frames carry one or more messages, see network.MsgParser.SetBatch,
+	// the clients must use the same framing
+	BatchFrames bool
+	// TLS on TCPAddr when set, see network.TCPServer
+	TCPCertFile     string
+	TCPKeyFile      string
+	TCPClientCAFile string
+	// behind a load balancer sending the PROXY protocol, the RemoteAddr of
+	// the agents (and MaxConnPerIP) is then the client, see network.TCPServer
+	TCPProxyProtocol bool
+	// the listening socket inherited from the previous process, e.g.
+	// os.NewFile(3, "gate") received by exec.Cmd.ExtraFiles, is used
+	// instead of listening on TCPAddr, see ListenerFD
+	// the connections of the previous process are not handed off, it
+	// should drain them (DrainTimeout)
+	TCPListenerFile *os.File
+
+	// udp
+	UDPAddr        string
+	UDPIdleTimeout time.Duration
+
+	metrics     metrics
+	preAuthMsgs map[reflect.Type]struct{}
+	connsPerIP  map[string]int
+	agents      map[*agent]struct{}
+	identities  map[interface{}]*agent
+	drained     chan struct{}
+	mutexConns  sync.Mutex
+	listeners   []listener
+	tcpServer   *network.TCPServer
+}
+
+const (
+	TransportTCP = "tcp"
+	TransportWS  = "ws"
+	TransportUDP = "udp"
+)
+
+type listener struct {
+	ln        net.Listener
+	processor network.Processor
+}
+
+// connections accepted from l use the TCP framing and processor
+// you must call the function before calling Run
+func (gate *Gate) AddListener(l net.Listener, processor network.Processor) {
+	gate.listeners = append(gate.listeners, listener{l, processor})
 }
 
 func (gate *Gate) Run(closeSig chan bool) {
+	if len(gate.PreAuthMsgs) > 0 {
+		gate.preAuthMsgs = make(map[reflect.Type]struct{})
+		for _, msg := range gate.PreAuthMsgs {
+			gate.preAuthMsgs[reflect.TypeOf(msg)] = struct{}{}
+		}
+	}
+
 	var wsServer *network.WSServer
 	if gate.WSAddr != "" {
 		wsServer = new(network.WSServer)
 		wsServer.Addr = gate.WSAddr
+		wsServer.Network = gate.Network
 		wsServer.MaxConnNum = gate.MaxConnNum
 		wsServer.PendingWriteNum = gate.PendingWriteNum
 		wsServer.MaxMsgLen = gate.MaxMsgLen
 		wsServer.HTTPTimeout = gate.HTTPTimeout
 		wsServer.CertFile = gate.CertFile
 		wsServer.KeyFile = gate.KeyFile
+		wsServer.FrameLogger = gate.FrameLogger
 		wsServer.NewAgent = func(conn *network.WSConn) network.Agent {
-			a := &agent{conn: conn, gate: gate}
-			if gate.AgentChanRPC != nil {
-				gate.AgentChanRPC.Go("NewAgent", a)
-			}
-			return a
+			return gate.newAgent(conn, TransportWS, gate.Processor)
 		}
 	}
 
 	var tcpServer *network.TCPServer
-	if gate.TCPAddr != "" {
+	if gate.TCPAddr != "" || gate.TCPListenerFile != nil {
 		tcpServer = new(network.TCPServer)
 		tcpServer.Addr = gate.TCPAddr
+		if gate.TCPListenerFile != nil {
+			ln, err := net.FileListener(gate.TCPListenerFile)
+			if err != nil {
+				log.Fatal("%v", err)
+			}
+			gate.TCPListenerFile.Close()
+			tcpServer.Listener = ln
+		}
+		tcpServer.Network = gate.Network
 		tcpServer.MaxConnNum = gate.MaxConnNum
 		tcpServer.PendingWriteNum = gate.PendingWriteNum
 		tcpServer.LenMsgLen = gate.LenMsgLen
 		tcpServer.MaxMsgLen = gate.MaxMsgLen
 		tcpServer.LittleEndian = gate.LittleEndian
+		tcpServer.FrameLogger = gate.FrameLogger
+		tcpServer.ReadBufferSize = gate.ReadBufferSize
+		tcpServer.ReadBytesPerSec = gate.ReadBytesPerSec
+		tcpServer.Batch = gate.BatchFrames
+		tcpServer.SkipMsgTooLong = gate.SkipMsgTooLong
+		tcpServer.CertFile = gate.TCPCertFile
+		tcpServer.KeyFile = gate.TCPKeyFile
+		tcpServer.ClientCAFile = gate.TCPClientCAFile
+		tcpServer.ProxyProtocol = gate.TCPProxyProtocol
+		tcpServer.ShouldAccept = gate.shouldAccept()
 		tcpServer.NewAgent = func(conn *network.TCPConn) network.Agent {
-			a := &agent{conn: conn, gate: gate}
-			if gate.AgentChanRPC != nil {
-				gate.AgentChanRPC.Go("NewAgent", a)
-			}
-			return a
+			return gate.newAgent(conn, TransportTCP, gate.Processor)
+		}
+	}
+
+	var udpServer *network.UDPServer
+	if gate.UDPAddr != "" {
+		udpServer = new(network.UDPServer)
+		udpServer.Addr = gate.UDPAddr
+		udpServer.MaxConnNum = gate.MaxConnNum
+		udpServer.PendingWriteNum = gate.PendingWriteNum
+		udpServer.MaxMsgLen = gate.MaxMsgLen
+		udpServer.IdleTimeout = gate.UDPIdleTimeout
+		udpServer.NewAgent = func(conn *network.UDPConn) network.Agent {
+			return gate.newAgent(conn, TransportUDP, gate.Processor)
+		}
+	}
+
+	var lnServers []*network.TCPServer
+	for _, l := range gate.listeners {
+		processor := l.processor
+		server := new(network.TCPServer)
+		server.Listener = l.ln
+		server.MaxConnNum = gate.MaxConnNum
+		server.PendingWriteNum = gate.PendingWriteNum
+		server.LenMsgLen = gate.LenMsgLen
+		server.MaxMsgLen = gate.MaxMsgLen
+		server.LittleEndian = gate.LittleEndian
+		server.FrameLogger = gate.FrameLogger
+		server.ReadBytesPerSec = gate.ReadBytesPerSec
+		server.Batch = gate.BatchFrames
+		server.SkipMsgTooLong = gate.SkipMsgTooLong
+		server.ShouldAccept = gate.shouldAccept()
+		server.NewAgent = func(conn *network.TCPConn) network.Agent {
+			return gate.newAgent(conn, TransportTCP, processor)
+		}
+		lnServers = append(lnServers, server)
+	}
+
+	if gate.WaitReady != nil {
+		select {
+		case <-gate.WaitReady:
+		case <-closeSig:
+			return
 		}
 	}
 
@@ -71,49 +252,396 @@ func (gate *Gate) Run(closeSig chan bool) {
 	}
 	if tcpServer != nil {
 		tcpServer.Start()
+		gate.mutexConns.Lock()
+		gate.tcpServer = tcpServer
+		gate.mutexConns.Unlock()
+	}
+	if udpServer != nil {
+		udpServer.Start()
+	}
+	for _, server := range lnServers {
+		server.Start()
 	}
 	<-closeSig
+	gate.drain()
 	if wsServer != nil {
 		wsServer.Close()
 	}
 	if tcpServer != nil {
 		tcpServer.Close()
 	}
+	if udpServer != nil {
+		udpServer.Close()
+	}
+	for _, server := range lnServers {
+		server.Close()
+	}
+}
+
+// a duplicate of the TCP listening socket for TCPListenerFile of the next
+// process, the caller must close it
+// goroutine safe
+func (gate *Gate) ListenerFD() (*os.File, error) {
+	gate.mutexConns.Lock()
+	tcpServer := gate.tcpServer
+	gate.mutexConns.Unlock()
+	if tcpServer == nil {
+		return nil, errors.New("no TCP listener")
+	}
+	return tcpServer.File()
 }
 
 func (gate *Gate) OnDestroy() {}
 
+func (gate *Gate) drain() {
+	if gate.DrainTimeout <= 0 {
+		return
+	}
+
+	gate.mutexConns.Lock()
+	agents := make([]*agent, 0, len(gate.agents))
+	for a := range gate.agents {
+		agents = append(agents, a)
+	}
+	drained := make(chan struct{})
+	if len(gate.agents) == 0 {
+		close(drained)
+	} else {
+		gate.drained = drained
+	}
+	gate.mutexConns.Unlock()
+
+	// OnShutdown must not delay the deadline
+	go func() {
+		for _, a := range agents {
+			if gate.OnShutdown != nil {
+				gate.OnShutdown(a)
+			}
+			a.Close()
+		}
+	}()
+
+	t := time.NewTimer(gate.DrainTimeout)
+	defer t.Stop()
+	select {
+	case <-drained:
+	case <-t.C:
+		log.Release("drain timeout, %v connections left", gate.metrics.active.Load())
+	}
+}
+
+func (gate *Gate) addAgent(a *agent) {
+	gate.mutexConns.Lock()
+	defer gate.mutexConns.Unlock()
+	if gate.agents == nil {
+		gate.agents = make(map[*agent]struct{})
+	}
+	gate.agents[a] = struct{}{}
+}
+
+func (gate *Gate) delAgent(a *agent) {
+	gate.mutexConns.Lock()
+	defer gate.mutexConns.Unlock()
+	delete(gate.agents, a)
+	if a.identity != nil && gate.identities[a.identity] == a {
+		delete(gate.identities, a.identity)
+	}
+	if gate.drained != nil && len(gate.agents) == 0 {
+		close(gate.drained)
+		gate.drained = nil
+	}
+}
+
+// returns the agent replaced
+func (gate *Gate) setIdentity(a *agent, identity interface{}) *agent {
+	gate.mutexConns.Lock()
+	defer gate.mutexConns.Unlock()
+	if _, ok := gate.agents[a]; !ok {
+		// closed
+		return nil
+	}
+	if a.identity != nil && gate.identities[a.identity] == a {
+		delete(gate.identities, a.identity)
+	}
+	a.identity = identity
+	if identity == nil {
+		return nil
+	}
+
+	if gate.identities == nil {
+		gate.identities = make(map[interface{}]*agent)
+	}
+	old := gate.identities[identity]
+	gate.identities[identity] = a
+	if old == a {
+		return nil
+	}
+	if old != nil {
+		old.identity = nil
+	}
+	return old
+}
+
+// returns nil if no agent holds the identity
+// goroutine safe
+func (gate *Gate) AgentByIdentity(identity interface{}) Agent {
+	gate.mutexConns.Lock()
+	defer gate.mutexConns.Unlock()
+	if a, ok := gate.identities[identity]; ok {
+		return a
+	}
+	return nil
+}
+
+func (gate *Gate) newAgent(conn network.Conn, transport string, processor network.Processor) network.Agent {
+	a := &agent{conn: conn, transport: transport, gate: gate, connectedAt: time.Now()}
+	if !gate.acquireIP(a) {
+		log.Debug("too many connections from %v", a.ip)
+		if gate.OnRejectConn != nil {
+			gate.OnRejectConn(conn.RemoteAddr(), "too many connections per ip")
+		}
+		a.rejected = true
+		return a
+	}
+
+	gate.metrics.onAccept()
+	gate.addAgent(a)
+	a.processor = processor
+	if len(gate.VersionProcessors) == 0 {
+		a.notifyNew()
+	}
+	return a
+}
+
+func (gate *Gate) shouldAccept() func(conn net.Conn) (bool, time.Duration) {
+	if gate.ShouldAccept == nil {
+		return nil
+	}
+	return func(conn net.Conn) (bool, time.Duration) {
+		accept, delay := gate.ShouldAccept(conn)
+		if !accept && gate.OnRejectConn != nil {
+			gate.OnRejectConn(conn.RemoteAddr(), "not accepted")
+		}
+		return accept, delay
+	}
+}
+
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+func (gate *Gate) acquireIP(a *agent) bool {
+	if gate.MaxConnPerIP <= 0 {
+		return true
+	}
+	a.ip = remoteIP(a.conn.RemoteAddr())
+
+	gate.mutexConns.Lock()
+	defer gate.mutexConns.Unlock()
+	if gate.connsPerIP == nil {
+		gate.connsPerIP = make(map[string]int)
+	}
+	if gate.connsPerIP[a.ip] >= gate.MaxConnPerIP {
+		return false
+	}
+	gate.connsPerIP[a.ip]++
+	return true
+}
+
+func (gate *Gate) releaseIP(a *agent) {
+	if gate.MaxConnPerIP <= 0 {
+		return
+	}
+
+	gate.mutexConns.Lock()
+	defer gate.mutexConns.Unlock()
+	if gate.connsPerIP[a.ip] <= 1 {
+		delete(gate.connsPerIP, a.ip)
+	} else {
+		gate.connsPerIP[a.ip]--
+	}
+}
+
 type agent struct {
-	conn     network.Conn
-	gate     *Gate
-	userData interface{}
+	conn              network.Conn
+	transport         string
+	gate              *Gate
+	userData          interface{}
+	connectedAt       time.Time
+	authenticated     atomic.Bool
+	preAuthViolations int
+	dropped           droppedMsgs
+	ip                string
+	rejected          bool
+	processor         network.Processor
+	notified          bool
+	closing           atomic.Bool
+	// guarded by gate.mutexConns
+	identity interface{}
+}
+
+// how often CanAccept is called while the agent is paused
+const acceptPollInterval = 10 * time.Millisecond
+
+func (a *agent) notifyNew() {
+	a.notified = true
+	if a.gate.AgentChanRPC != nil {
+		a.gate.AgentChanRPC.Go("NewAgent", a)
+	}
+}
+
+// the negotiated version is stored in the user data
+func (a *agent) handshake() bool {
+	data, err := a.readMsg()
+	if err != nil {
+		log.Debug("read version: %v", err)
+		return false
+	}
+
+	version := string(data)
+	processor, ok := a.gate.VersionProcessors[version]
+	if !ok {
+		log.Debug("unsupported protocol version %q", version)
+		return false
+	}
+	err = a.conn.WriteMsg(data)
+	if err != nil {
+		log.Debug("write version error: %v", err)
+		return false
+	}
+
+	a.processor = processor
+	a.userData = version
+	a.notifyNew()
+	return true
 }
 
 func (a *agent) Run() {
+	if a.rejected {
+		return
+	}
+	if !a.notified && !a.handshake() {
+		return
+	}
+
 	for {
-		data, err := a.conn.ReadMsg()
+		data, err := a.readMsg()
+		if err == network.ErrMsgTooLong {
+			log.Debug("read message: %v", err)
+			if a.drop(&a.dropped.tooLong) {
+				break
+			}
+			continue
+		}
+		if err == network.ErrMsgTooLongClose {
+			a.dropped.tooLong.Add(1)
+		}
 		if err != nil {
 			log.Debug("read message: %v", err)
 			break
 		}
 
-		if a.gate.Processor != nil {
-			msg, err := a.gate.Processor.Unmarshal(data)
+		if a.processor != nil {
+			msg, err := a.processor.Unmarshal(data)
+			if err == nil && a.gate.ReadBufferSize > 0 && isRaw(msg) {
+				msg, err = a.processor.Unmarshal(append([]byte(nil), data...))
+			}
 			if err != nil {
 				log.Debug("unmarshal message error: %v", err)
-				break
+				if a.drop(&a.dropped.malformed) {
+					break
+				}
+				continue
+			}
+			if !a.allowed(msg) {
+				log.Debug("message %v not allowed before authentication", reflect.TypeOf(msg))
+				a.preAuthViolations++
+				if a.gate.MaxPreAuthViolations > 0 &&
+					a.preAuthViolations >= a.gate.MaxPreAuthViolations {
+					break
+				}
+				continue
 			}
-			err = a.gate.Processor.Route(msg, a)
+			err = a.route(msg)
 			if err != nil {
 				log.Debug("route message error: %v", err)
-				break
+				if a.drop(&a.dropped.unroutable) {
+					break
+				}
 			}
 		}
 	}
 }
 
+type deadlineConn interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// the raw messages keep the data, which is in the buffer reused by the
+// connection with ReadBufferSize
+func isRaw(msg interface{}) bool {
+	_, ok := msg.(protobuf.MsgRaw)
+	return ok
+}
+
+func (a *agent) readMsg() ([]byte, error) {
+	if a.gate.CanAccept != nil {
+		for !a.gate.CanAccept() && !a.closing.Load() {
+			time.Sleep(acceptPollInterval)
+		}
+	}
+	if a.gate.IdleTimeout > 0 {
+		if conn, ok := a.conn.(deadlineConn); ok {
+			conn.SetReadDeadline(time.Now().Add(a.gate.IdleTimeout))
+		}
+	}
+	return a.conn.ReadMsg()
+}
+
+func (a *agent) route(msg interface{}) error {
+	timeout := a.gate.MsgHandleTimeout
+	if timeout <= 0 {
+		return a.processor.Route(msg, a)
+	}
+
+	t := time.AfterFunc(timeout, func() {
+		log.Release("message %v: handler still running after %v", reflect.TypeOf(msg), timeout)
+	})
+	defer t.Stop()
+	return a.processor.Route(msg, a)
+}
+
+// returns true if the agent must be closed
+func (a *agent) drop(counter *atomic.Uint64) bool {
+	counter.Add(1)
+	return a.dropped.total() > uint64(a.gate.MaxDroppedMsgs)
+}
+
+func (a *agent) allowed(msg interface{}) bool {
+	if a.gate.preAuthMsgs == nil || a.authenticated.Load() {
+		return true
+	}
+	_, ok := a.gate.preAuthMsgs[reflect.TypeOf(msg)]
+	return ok
+}
+
 func (a *agent) OnClose() {
-	if a.gate.AgentChanRPC != nil {
+	if a.rejected {
+		return
+	}
+
+	a.gate.releaseIP(a)
+	a.gate.delAgent(a)
+	a.gate.metrics.onClose(time.Since(a.connectedAt))
+
+	if a.notified && a.gate.AgentChanRPC != nil {
 		err := a.gate.AgentChanRPC.Call0("CloseAgent", a)
 		if err != nil {
 			log.Error("chanrpc error: %v", err)
@@ -121,20 +649,85 @@ func (a *agent) OnClose() {
 	}
 }
 
+type priorityConn interface {
+	WriteMsgPriority(high bool, args ...[]byte) error
+}
+
 func (a *agent) WriteMsg(msg interface{}) {
-	if a.gate.Processor != nil {
-		data, err := a.gate.Processor.Marshal(msg)
+	a.WriteMsgPriority(msg, false)
+}
+
+func (a *agent) marshal(msg interface{}) ([][]byte, bool) {
+	data, err := a.processor.Marshal(msg)
+	if err != nil {
+		log.Error("marshal message %v error: %v", reflect.TypeOf(msg), err)
+		return nil, false
+	}
+	if a.gate.WriteInterceptor != nil {
+		data, err = a.gate.WriteInterceptor(a, msg, data)
 		if err != nil {
-			log.Error("marshal message %v error: %v", reflect.TypeOf(msg), err)
+			log.Debug("intercept message %v: %v", reflect.TypeOf(msg), err)
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+func (a *agent) WriteMsgPriority(msg interface{}, high bool) {
+	if a.processor != nil {
+		data, ok := a.marshal(msg)
+		if !ok {
 			return
 		}
-		err = a.conn.WriteMsg(data...)
+		var err error
+		if conn, ok := a.conn.(priorityConn); ok {
+			err = conn.WriteMsgPriority(high, data...)
+		} else {
+			err = a.conn.WriteMsg(data...)
+		}
 		if err != nil {
 			log.Error("write message %v error: %v", reflect.TypeOf(msg), err)
 		}
 	}
 }
 
+type batchConn interface {
+	WriteBatch(msgs ...[]byte) error
+}
+
+func (a *agent) WriteBatched(msgs ...interface{}) {
+	if a.processor == nil {
+		return
+	}
+	conn, ok := a.conn.(batchConn)
+	if !ok {
+		for _, msg := range msgs {
+			a.WriteMsg(msg)
+		}
+		return
+	}
+
+	batch := make([][]byte, 0, len(msgs))
+	for _, msg := range msgs {
+		data, ok := a.marshal(msg)
+		if !ok {
+			continue
+		}
+		batch = append(batch, bytes.Join(data, nil))
+	}
+	err := conn.WriteBatch(batch...)
+	if err != nil {
+		log.Error("write batch of %v messages error: %v", len(batch), err)
+	}
+}
+
+func (a *agent) WriteRaw(data ...[]byte) {
+	err := a.conn.WriteMsg(data...)
+	if err != nil {
+		log.Error("write raw message error: %v", err)
+	}
+}
+
 func (a *agent) LocalAddr() net.Addr {
 	return a.conn.LocalAddr()
 }
@@ -144,13 +737,60 @@ func (a *agent) RemoteAddr() net.Addr {
 }
 
 func (a *agent) Close() {
+	a.closing.Store(true)
 	a.conn.Close()
 }
 
 func (a *agent) Destroy() {
+	a.closing.Store(true)
 	a.conn.Destroy()
 }
 
+func (a *agent) Transport() string {
+	return a.transport
+}
+
+type tlsConn interface {
+	ConnectionState() (tls.ConnectionState, bool)
+}
+
+func (a *agent) ConnectionState() (tls.ConnectionState, bool) {
+	if conn, ok := a.conn.(tlsConn); ok {
+		return conn.ConnectionState()
+	}
+	return tls.ConnectionState{}, false
+}
+
+type pendingConn interface {
+	PendingWrites() int
+	PendingWriteCap() int
+}
+
+func (a *agent) PendingWrites() int {
+	if conn, ok := a.conn.(pendingConn); ok {
+		return conn.PendingWrites()
+	}
+	return 0
+}
+
+func (a *agent) PendingWriteCap() int {
+	if conn, ok := a.conn.(pendingConn); ok {
+		return conn.PendingWriteCap()
+	}
+	return 0
+}
+
+type closeStatusConn interface {
+	CloseStatus() (code int, reason string)
+}
+
+func (a *agent) CloseStatus() (code int, reason string) {
+	if conn, ok := a.conn.(closeStatusConn); ok {
+		return conn.CloseStatus()
+	}
+	return 0, ""
+}
+
 func (a *agent) UserData() interface{} {
 	return a.userData
 }
@@ -158,3 +798,38 @@ func (a *agent) UserData() interface{} {
 func (a *agent) SetUserData(data interface{}) {
 	a.userData = data
 }
+
+func (a *agent) Authenticated() bool {
+	return a.authenticated.Load()
+}
+
+func (a *agent) DroppedMsgs() DroppedMsgs {
+	return DroppedMsgs{
+		TooLong:    a.dropped.tooLong.Load(),
+		Malformed:  a.dropped.malformed.Load(),
+		Unroutable: a.dropped.unroutable.Load(),
+	}
+}
+
+func (a *agent) SetAuthenticated(authenticated bool) {
+	a.authenticated.Store(authenticated)
+}
+
+func (a *agent) Identity() interface{} {
+	a.gate.mutexConns.Lock()
+	defer a.gate.mutexConns.Unlock()
+	return a.identity
+}
+
+func (a *agent) SetIdentity(identity interface{}) {
+	old := a.gate.setIdentity(a, identity)
+	if old == nil {
+		return
+	}
+
+	log.Debug("identity %v: close the previous agent %v", identity, old.RemoteAddr())
+	if a.gate.KickMsg != nil {
+		old.WriteMsg(a.gate.KickMsg)
+	}
+	old.Close()
+}
@@ -0,0 +1,1232 @@
+package gate_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/gorilla/websocket"
+	"github.com/name5566/leaf/chanrpc"
+	"github.com/name5566/leaf/gate"
+	"github.com/name5566/leaf/log"
+	"github.com/name5566/leaf/network"
+	"github.com/name5566/leaf/network/json"
+	"github.com/name5566/leaf/network/protobuf"
+	"io"
+	l "log"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func dial(t *testing.T, addr string) net.Conn {
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			return conn
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("dial %v failed", addr)
+	return nil
+}
+
+func waitFor(t *testing.T, g *gate.Gate, ok func(gate.Metrics) bool) gate.Metrics {
+	var m gate.Metrics
+	for i := 0; i < 200; i++ {
+		m = g.Metrics()
+		if ok(m) {
+			return m
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("unexpected metrics: %+v", m)
+	return m
+}
+
+// returns a function stopping the gate, called on cleanup
+func startGate(t *testing.T, g *gate.Gate) func() {
+	g.MaxConnNum = 10
+	if g.PendingWriteNum == 0 {
+		g.PendingWriteNum = 10
+	}
+	g.MaxMsgLen = 4096
+	g.TCPAddr = freeAddr(t)
+	g.LenMsgLen = 2
+
+	closeSig := make(chan bool)
+	done := make(chan struct{})
+	go func() {
+		g.Run(closeSig)
+		close(done)
+	}()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			closeSig <- true
+			<-done
+		})
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+func writeMsg(t *testing.T, conn net.Conn, data string) {
+	b := make([]byte, 2+len(data))
+	binary.BigEndian.PutUint16(b, uint16(len(data)))
+	copy(b[2:], data)
+	if _, err := conn.Write(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGate_Metrics(t *testing.T) {
+	g := new(gate.Gate)
+	startGate(t, g)
+
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		conns = append(conns, dial(t, g.TCPAddr))
+	}
+	waitFor(t, g, func(m gate.Metrics) bool {
+		return m.Accepted == 3 && m.Active == 3
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	conns[0].Close()
+	conns[1].Close()
+	m := waitFor(t, g, func(m gate.Metrics) bool {
+		return m.Closed == 2
+	})
+	if m.Accepted != 3 || m.Active != 1 {
+		t.Fatalf("unexpected metrics: %+v", m)
+	}
+	if m.MaxDuration < 50*time.Millisecond || m.TotalDuration < 100*time.Millisecond {
+		t.Fatalf("unexpected durations: %+v", m)
+	}
+	if len(m.DurationBuckets) != len(gate.DurationBuckets)+1 || m.DurationBuckets[0] != 2 {
+		t.Fatalf("unexpected duration buckets: %v", m.DurationBuckets)
+	}
+
+	conns[2].Close()
+	waitFor(t, g, func(m gate.Metrics) bool {
+		return m.Closed == 3 && m.Active == 0
+	})
+}
+
+type Login struct{}
+
+type Chat struct {
+	Text string
+}
+
+func TestGate_PreAuthMsgs(t *testing.T) {
+	processor := json.NewProcessor()
+	processor.Register(&Login{})
+	processor.Register(&Chat{})
+
+	chats := make(chan string, 10)
+	processor.SetHandler(&Login{}, func(args []interface{}) {
+		args[1].(gate.Agent).SetAuthenticated(true)
+	})
+	processor.SetHandler(&Chat{}, func(args []interface{}) {
+		chats <- args[0].(*Chat).Text
+	})
+
+	g := &gate.Gate{
+		Processor:            processor,
+		PreAuthMsgs:          []interface{}{&Login{}},
+		MaxPreAuthViolations: 2,
+	}
+	startGate(t, g)
+
+	conn := dial(t, g.TCPAddr)
+	defer conn.Close()
+
+	writeMsg(t, conn, `{"Chat": {"Text": "rejected"}}`)
+	writeMsg(t, conn, `{"Login": {}}`)
+	writeMsg(t, conn, `{"Chat": {"Text": "accepted"}}`)
+
+	select {
+	case text := <-chats:
+		if text != "accepted" {
+			t.Fatalf("got %v, want accepted", text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message not dispatched")
+	}
+
+	// too many violations
+	conn2 := dial(t, g.TCPAddr)
+	defer conn2.Close()
+	writeMsg(t, conn2, `{"Chat": {"Text": "rejected"}}`)
+	writeMsg(t, conn2, `{"Chat": {"Text": "rejected"}}`)
+
+	conn2.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn2.Read(make([]byte, 1)); err == nil || isTimeout(err) {
+		t.Fatalf("connection not closed: %v", err)
+	}
+	select {
+	case text := <-chats:
+		t.Fatalf("unexpected message %v", text)
+	default:
+	}
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+func dialFrom(t *testing.T, ip string, addr string) net.Conn {
+	d := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(ip)}}
+	conn, err := d.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func isOpen(conn net.Conn) bool {
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err := conn.Read(make([]byte, 1))
+	return isTimeout(err)
+}
+
+func TestGate_MaxConnPerIP(t *testing.T) {
+	rejected := make(chan net.Addr, 10)
+	g := &gate.Gate{
+		MaxConnPerIP: 2,
+		OnRejectConn: func(addr net.Addr, reason string) {
+			rejected <- addr
+		},
+	}
+	startGate(t, g)
+	dial(t, g.TCPAddr).Close()
+	waitFor(t, g, func(m gate.Metrics) bool { return m.Closed == 1 })
+
+	c1 := dialFrom(t, "127.0.0.1", g.TCPAddr)
+	defer c1.Close()
+	c2 := dialFrom(t, "127.0.0.1", g.TCPAddr)
+	defer c2.Close()
+	c3 := dialFrom(t, "127.0.0.1", g.TCPAddr)
+	defer c3.Close()
+	other := dialFrom(t, "127.0.0.2", g.TCPAddr)
+	defer other.Close()
+
+	if isOpen(c3) {
+		t.Fatal("connection over the limit accepted")
+	}
+	select {
+	case addr := <-rejected:
+		if addr.String() != c3.LocalAddr().String() {
+			t.Fatalf("rejected %v, want %v", addr, c3.LocalAddr())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("rejection hook not fired")
+	}
+	if !isOpen(c1) || !isOpen(c2) || !isOpen(other) {
+		t.Fatal("connection under the limit closed")
+	}
+
+	c1.Close()
+	waitFor(t, g, func(m gate.Metrics) bool { return m.Closed == 2 })
+	c4 := dialFrom(t, "127.0.0.1", g.TCPAddr)
+	defer c4.Close()
+	if !isOpen(c4) {
+		t.Fatal("connection not accepted after disconnect")
+	}
+
+	m := g.Metrics()
+	if m.Accepted != 5 || m.Active != 3 {
+		t.Fatalf("unexpected metrics: %+v", m)
+	}
+}
+
+func TestGate_ShouldAccept(t *testing.T) {
+	rejected := make(chan string, 10)
+	g := &gate.Gate{
+		ShouldAccept: func(conn net.Conn) (bool, time.Duration) {
+			host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+			return host != "127.0.0.2", 0
+		},
+		OnRejectConn: func(addr net.Addr, reason string) {
+			rejected <- reason
+		},
+	}
+	startGate(t, g)
+	dial(t, g.TCPAddr).Close()
+
+	c1 := dialFrom(t, "127.0.0.1", g.TCPAddr)
+	defer c1.Close()
+	c2 := dialFrom(t, "127.0.0.2", g.TCPAddr)
+	defer c2.Close()
+
+	select {
+	case reason := <-rejected:
+		if reason != "not accepted" {
+			t.Fatalf("rejected for %q", reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("rejection hook not fired")
+	}
+	if isOpen(c2) {
+		t.Fatal("rejected connection open")
+	}
+	if !isOpen(c1) {
+		t.Fatal("accepted connection closed")
+	}
+}
+
+func TestGate_TCPProxyProtocol(t *testing.T) {
+	rejected := make(chan net.Addr, 10)
+	g := &gate.Gate{
+		MaxConnPerIP:     1,
+		TCPProxyProtocol: true,
+		OnRejectConn: func(addr net.Addr, reason string) {
+			rejected <- addr
+		},
+	}
+	startGate(t, g)
+
+	dialProxy := func(src string) net.Conn {
+		conn := dial(t, g.TCPAddr)
+		if _, err := conn.Write([]byte("PROXY TCP4 " + src + " 198.51.100.1 56324 443\r\n")); err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	c1 := dialProxy("192.0.2.1")
+	defer c1.Close()
+	c2 := dialProxy("192.0.2.2")
+	defer c2.Close()
+	c3 := dialProxy("192.0.2.1")
+	defer c3.Close()
+
+	select {
+	case addr := <-rejected:
+		if addr.String() != "192.0.2.1:56324" {
+			t.Fatalf("rejected %v, want the client behind the load balancer", addr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("rejection hook not fired")
+	}
+	if !isOpen(c1) || !isOpen(c2) {
+		t.Fatal("connection of another client closed")
+	}
+}
+
+func readMsg(t *testing.T, conn net.Conn) (string, error) {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var l [2]byte
+	if _, err := io.ReadFull(conn, l[:]); err != nil {
+		return "", err
+	}
+	b := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err := io.ReadFull(conn, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func TestGate_VersionProcessors(t *testing.T) {
+	type routed struct {
+		version string
+		text    string
+		data    interface{}
+	}
+	chats := make(chan routed, 10)
+	newProcessor := func(version string) *json.Processor {
+		processor := json.NewProcessor()
+		processor.Register(&Chat{})
+		processor.SetHandler(&Chat{}, func(args []interface{}) {
+			chats <- routed{version, args[0].(*Chat).Text, args[1].(gate.Agent).UserData()}
+		})
+		return processor
+	}
+
+	g := &gate.Gate{
+		VersionProcessors: map[string]network.Processor{
+			"1.0": newProcessor("1.0"),
+			"2.0": newProcessor("2.0"),
+		},
+	}
+	startGate(t, g)
+
+	for _, version := range []string{"1.0", "2.0"} {
+		conn := dial(t, g.TCPAddr)
+		defer conn.Close()
+
+		writeMsg(t, conn, version)
+		ack, err := readMsg(t, conn)
+		if err != nil || ack != version {
+			t.Fatalf("handshake: got %q, %v", ack, err)
+		}
+		writeMsg(t, conn, `{"Chat": {"Text": "hi"}}`)
+
+		select {
+		case r := <-chats:
+			if r.version != version || r.text != "hi" || r.data != version {
+				t.Fatalf("unexpected route: %+v", r)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("message not dispatched")
+		}
+	}
+
+	conn := dial(t, g.TCPAddr)
+	defer conn.Close()
+	writeMsg(t, conn, "3.0")
+	if _, err := readMsg(t, conn); err == nil || isTimeout(err) {
+		t.Fatalf("unsupported version accepted: %v", err)
+	}
+}
+
+func TestGate_WriteInterceptor(t *testing.T) {
+	processor := json.NewProcessor()
+	processor.Register(&Chat{})
+	processor.SetHandler(&Chat{}, func(args []interface{}) {
+		args[1].(gate.Agent).WriteMsg(args[0])
+	})
+
+	g := &gate.Gate{
+		Processor: processor,
+		WriteInterceptor: func(a gate.Agent, msg interface{}, data [][]byte) ([][]byte, error) {
+			if msg.(*Chat).Text == "veto" {
+				return nil, errors.New("vetoed")
+			}
+			return append(data, []byte("|signed")), nil
+		},
+	}
+	startGate(t, g)
+
+	conn := dial(t, g.TCPAddr)
+	defer conn.Close()
+
+	writeMsg(t, conn, `{"Chat": {"Text": "veto"}}`)
+	writeMsg(t, conn, `{"Chat": {"Text": "hi"}}`)
+
+	got, err := readMsg(t, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Chat":{"Text":"hi"}}|signed`; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestGate_AddListener(t *testing.T) {
+	processor := json.NewProcessor()
+	processor.Register(&Chat{})
+	processor.SetHandler(&Chat{}, func(args []interface{}) {
+		args[1].(gate.Agent).WriteMsg(&Chat{Text: "re:" + args[0].(*Chat).Text})
+	})
+
+	path := filepath.Join(t.TempDir(), "gate.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := new(gate.Gate)
+	g.AddListener(ln, processor)
+	startGate(t, g)
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	writeMsg(t, conn, `{"Chat": {"Text": "hi"}}`)
+	got, err := readMsg(t, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Chat":{"Text":"re:hi"}}`; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestAgent_WriteRaw(t *testing.T) {
+	processor := json.NewProcessor()
+	processor.Register(&Chat{})
+
+	agents := make(chan gate.Agent, 10)
+	processor.SetHandler(&Chat{}, func(args []interface{}) {
+		agents <- args[1].(gate.Agent)
+	})
+
+	g := &gate.Gate{Processor: processor}
+	startGate(t, g)
+
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		conn := dial(t, g.TCPAddr)
+		defer conn.Close()
+		writeMsg(t, conn, `{"Chat": {}}`)
+		conns = append(conns, conn)
+	}
+
+	// marshal once
+	data, err := processor.Marshal(&Chat{Text: "broadcast"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(conns); i++ {
+		select {
+		case a := <-agents:
+			a.WriteRaw(data...)
+		case <-time.After(time.Second):
+			t.Fatal("agent not registered")
+		}
+	}
+
+	for _, conn := range conns {
+		got, err := readMsg(t, conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `{"Chat":{"Text":"broadcast"}}`; got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestGate_ReadBufferSizeRaw(t *testing.T) {
+	processor := protobuf.NewProcessor()
+	id := processor.Register(&wrappers.StringValue{})
+
+	raws := make(chan []byte, 2)
+	processor.SetRawHandler(id, func(args []interface{}) {
+		raws <- args[1].([]byte)
+	})
+
+	g := &gate.Gate{Processor: processor, ReadBufferSize: 100}
+	startGate(t, g)
+
+	conn := dial(t, g.TCPAddr)
+	defer conn.Close()
+
+	// the first message is retained after the buffer is reused
+	writeMsg(t, conn, "\x00\x00first")
+	writeMsg(t, conn, "\x00\x00again")
+	var got []string
+	for i := 0; i < 2; i++ {
+		select {
+		case raw := <-raws:
+			got = append(got, string(raw))
+		case <-time.After(time.Second):
+			t.Fatal("message not handled")
+		}
+	}
+	if got[0] != "first" || got[1] != "again" {
+		t.Fatalf("unexpected raw messages %q", got)
+	}
+}
+
+func TestGate_MsgHandleTimeout(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := log.New("debug", dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Export(logger)
+	t.Cleanup(func() {
+		stdout, _ := log.New("debug", "", l.LstdFlags)
+		log.Export(stdout)
+		logger.Close()
+	})
+
+	release := make(chan struct{})
+	processor := json.NewProcessor()
+	processor.Register(&Chat{})
+	processor.SetHandler(&Chat{}, func(args []interface{}) {
+		if args[0].(*Chat).Text == "slow" {
+			<-release
+		}
+		args[1].(gate.Agent).WriteMsg(args[0])
+	})
+
+	g := &gate.Gate{Processor: processor, MsgHandleTimeout: 20 * time.Millisecond}
+	startGate(t, g)
+
+	conn := dial(t, g.TCPAddr)
+	defer conn.Close()
+
+	writeMsg(t, conn, `{"Chat": {"Text": "slow"}}`)
+	writeMsg(t, conn, `{"Chat": {"Text": "fast"}}`)
+
+	// logged while the handler hangs
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(files) != 1 {
+		t.Fatal("log file not found")
+	}
+	var b []byte
+	for i := 0; i < 100; i++ {
+		if b, err = os.ReadFile(files[0]); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), "message *gate_test.Chat: handler still running after 20ms") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(string(b), "message *gate_test.Chat: handler still running after 20ms") {
+		t.Fatalf("warning not logged: %q", b)
+	}
+	close(release)
+
+	// still handled in order
+	for _, want := range []string{`{"Chat":{"Text":"slow"}}`, `{"Chat":{"Text":"fast"}}`} {
+		got, err := readMsg(t, conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
+
+// Login cannot be routed
+type routeProcessor struct {
+	*json.Processor
+}
+
+func (p routeProcessor) Route(msg interface{}, userData interface{}) error {
+	if _, ok := msg.(*Login); ok {
+		return errors.New("no route")
+	}
+	return p.Processor.Route(msg, userData)
+}
+
+func TestGate_MaxDroppedMsgs(t *testing.T) {
+	processor := json.NewProcessor()
+	processor.Register(&Login{})
+	processor.Register(&Chat{})
+
+	agents := make(chan gate.Agent, 1)
+	processor.SetHandler(&Chat{}, func(args []interface{}) {
+		a := args[1].(gate.Agent)
+		a.WriteMsg(args[0])
+		agents <- a
+	})
+
+	g := &gate.Gate{Processor: routeProcessor{processor}, MaxDroppedMsgs: 2, SkipMsgTooLong: true}
+	startGate(t, g)
+
+	conn := dial(t, g.TCPAddr)
+	defer conn.Close()
+
+	writeMsg(t, conn, strings.Repeat("x", 5000))
+	writeMsg(t, conn, `{"Chat": {"Text": "hi"}}`)
+	if got, err := readMsg(t, conn); err != nil || got != `{"Chat":{"Text":"hi"}}` {
+		t.Fatalf("unexpected reply %q %v", got, err)
+	}
+	a := <-agents
+
+	writeMsg(t, conn, `not json`)
+	writeMsg(t, conn, `{"Login": {}}`)
+	if _, err := readMsg(t, conn); err == nil || isTimeout(err) {
+		t.Fatalf("connection not closed: %v", err)
+	}
+	if d := a.DroppedMsgs(); d != (gate.DroppedMsgs{TooLong: 1, Malformed: 1, Unroutable: 1}) {
+		t.Fatalf("unexpected dropped messages %+v", d)
+	}
+}
+
+func TestGate_MsgTooLong(t *testing.T) {
+	processor := json.NewProcessor()
+	processor.Register(&Chat{})
+
+	agents := make(chan gate.Agent, 1)
+	processor.SetHandler(&Chat{}, func(args []interface{}) {
+		a := args[1].(gate.Agent)
+		a.WriteMsg(args[0])
+		agents <- a
+	})
+
+	g := &gate.Gate{Processor: processor}
+	startGate(t, g)
+
+	conn := dial(t, g.TCPAddr)
+	defer conn.Close()
+
+	writeMsg(t, conn, `{"Chat": {"Text": "hi"}}`)
+	if got, err := readMsg(t, conn); err != nil || got != `{"Chat":{"Text":"hi"}}` {
+		t.Fatalf("unexpected reply %q %v", got, err)
+	}
+	a := <-agents
+
+	writeMsg(t, conn, strings.Repeat("x", 5000))
+	if _, err := readMsg(t, conn); err == nil || isTimeout(err) {
+		t.Fatalf("connection not closed: %v", err)
+	}
+	if d := a.DroppedMsgs(); d != (gate.DroppedMsgs{TooLong: 1}) {
+		t.Fatalf("unexpected dropped messages %+v", d)
+	}
+}
+
+func TestGate_WSMsgTooLong(t *testing.T) {
+	server := chanrpc.NewServer(10)
+	closed := make(chan gate.Agent, 1)
+	server.Register("NewAgent", func(args []interface{}) {})
+	server.Register("CloseAgent", func(args []interface{}) {
+		closed <- args[0].(gate.Agent)
+	})
+	go func() {
+		for ci := range server.ChanCall {
+			server.Exec(ci)
+		}
+	}()
+	defer server.Close()
+
+	processor := json.NewProcessor()
+	processor.Register(&Chat{})
+	// dropping would not close it
+	g := &gate.Gate{Processor: processor, AgentChanRPC: server, WSAddr: freeAddr(t), MaxDroppedMsgs: 100}
+	startGate(t, g)
+
+	var ws *websocket.Conn
+	for i := 0; i < 100; i++ {
+		var err error
+		ws, _, err = websocket.DefaultDialer.Dial("ws://"+g.WSAddr, nil)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ws == nil {
+		t.Fatal("websocket dial failed")
+	}
+	defer ws.Close()
+
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 5000))); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case a := <-closed:
+		if d := a.DroppedMsgs(); d != (gate.DroppedMsgs{TooLong: 1}) {
+			t.Fatalf("unexpected dropped messages %+v", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("connection not closed")
+	}
+}
+
+func TestAgent_CloseStatus(t *testing.T) {
+	server := chanrpc.NewServer(10)
+	closed := make(chan string, 1)
+	server.Register("NewAgent", func(args []interface{}) {})
+	server.Register("CloseAgent", func(args []interface{}) {
+		code, reason := args[0].(gate.Agent).CloseStatus()
+		closed <- fmt.Sprint(code, " ", reason)
+	})
+	go func() {
+		for ci := range server.ChanCall {
+			server.Exec(ci)
+		}
+	}()
+	defer server.Close()
+
+	processor := json.NewProcessor()
+	g := &gate.Gate{Processor: processor, AgentChanRPC: server, WSAddr: freeAddr(t)}
+	startGate(t, g)
+
+	var ws *websocket.Conn
+	for i := 0; i < 100; i++ {
+		var err error
+		ws, _, err = websocket.DefaultDialer.Dial("ws://"+g.WSAddr, nil)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ws == nil {
+		t.Fatal("websocket dial failed")
+	}
+	defer ws.Close()
+
+	msg := websocket.FormatCloseMessage(4000, "bye")
+	if err := ws.WriteMessage(websocket.CloseMessage, msg); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-closed:
+		if got != "4000 bye" {
+			t.Fatalf("got %q, want 4000 bye", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("agent not closed")
+	}
+}
+
+func TestGate_OnShutdown(t *testing.T) {
+	processor := json.NewProcessor()
+	processor.Register(&Chat{})
+	processor.SetHandler(&Chat{}, func(args []interface{}) {
+		args[1].(gate.Agent).WriteMsg(args[0])
+	})
+
+	g := &gate.Gate{
+		Processor:    processor,
+		DrainTimeout: time.Second,
+		OnShutdown: func(a gate.Agent) {
+			a.WriteMsg(&Chat{Text: "restarting"})
+		},
+	}
+	stop := startGate(t, g)
+
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		conn := dial(t, g.TCPAddr)
+		defer conn.Close()
+		writeMsg(t, conn, `{"Chat": {"Text": "hi"}}`)
+		if _, err := readMsg(t, conn); err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	for _, conn := range conns {
+		got, err := readMsg(t, conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `{"Chat":{"Text":"restarting"}}`; got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+		if _, err := readMsg(t, conn); err != io.EOF {
+			t.Fatalf("connection not closed: %v", err)
+		}
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second / 2):
+		t.Fatal("shutdown waited for the drain timeout")
+	}
+}
+
+func TestAgent_Transport(t *testing.T) {
+	processor := json.NewProcessor()
+	processor.Register(&Chat{})
+	transports := make(chan string, 2)
+	processor.SetHandler(&Chat{}, func(args []interface{}) {
+		transports <- args[1].(gate.Agent).Transport()
+	})
+
+	g := &gate.Gate{Processor: processor, WSAddr: freeAddr(t)}
+	startGate(t, g)
+
+	conn := dial(t, g.TCPAddr)
+	defer conn.Close()
+	writeMsg(t, conn, `{"Chat": {}}`)
+	if got := <-transports; got != gate.TransportTCP {
+		t.Fatalf("got %v, want %v", got, gate.TransportTCP)
+	}
+
+	var ws *websocket.Conn
+	for i := 0; i < 100; i++ {
+		var err error
+		ws, _, err = websocket.DefaultDialer.Dial("ws://"+g.WSAddr, nil)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ws == nil {
+		t.Fatal("websocket dial failed")
+	}
+	defer ws.Close()
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"Chat": {}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-transports; got != gate.TransportWS {
+		t.Fatalf("got %v, want %v", got, gate.TransportWS)
+	}
+}
+
+func TestGate_WaitReady(t *testing.T) {
+	ready := make(chan struct{})
+	g := &gate.Gate{WaitReady: ready}
+	startGate(t, g)
+
+	time.Sleep(50 * time.Millisecond)
+	if conn, err := net.Dial("tcp", g.TCPAddr); err == nil {
+		conn.Close()
+		t.Fatal("connection accepted before ready")
+	}
+
+	close(ready)
+	conn := dial(t, g.TCPAddr)
+	conn.Close()
+}
+
+func TestGate_IdleTimeout(t *testing.T) {
+	processor := json.NewProcessor()
+	processor.Register(&Chat{})
+	processor.SetHandler(&Chat{}, func(args []interface{}) {})
+
+	g := &gate.Gate{Processor: processor, IdleTimeout: 200 * time.Millisecond}
+	startGate(t, g)
+
+	silent := dial(t, g.TCPAddr)
+	defer silent.Close()
+	chatty := dial(t, g.TCPAddr)
+	defer chatty.Close()
+
+	start := time.Now()
+	for time.Since(start) < 400*time.Millisecond {
+		writeMsg(t, chatty, `{"Chat": {"Text": "hi"}}`)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	waitFor(t, g, func(m gate.Metrics) bool {
+		return m.Closed == 1 && m.Active == 1
+	})
+	if _, err := readMsg(t, silent); err == nil || isTimeout(err) {
+		t.Fatalf("silent connection not closed: %v", err)
+	}
+	if !isOpen(chatty) {
+		t.Fatal("active connection closed")
+	}
+}
+
+// the body of a batch frame
+func batch(msgs ...string) string {
+	var b []byte
+	for _, msg := range msgs {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(msg)))
+		b = append(b, msg...)
+	}
+	return string(b)
+}
+
+func TestAgent_WriteBatched(t *testing.T) {
+	processor := json.NewProcessor()
+	processor.Register(&Chat{})
+	processor.SetHandler(&Chat{}, func(args []interface{}) {
+		text := args[0].(*Chat).Text
+		args[1].(gate.Agent).WriteBatched(&Chat{text + "1"}, &Chat{text + "2"}, &Chat{text + "3"})
+	})
+
+	g := &gate.Gate{Processor: processor, BatchFrames: true}
+	startGate(t, g)
+
+	conn := dial(t, g.TCPAddr)
+	defer conn.Close()
+
+	writeMsg(t, conn, batch(`{"Chat": {"Text": "a"}}`, `{"Chat": {"Text": "b"}}`))
+
+	for _, text := range []string{"a", "b"} {
+		got, err := readMsg(t, conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := batch(`{"Chat":{"Text":"`+text+`1"}}`, `{"Chat":{"Text":"`+text+`2"}}`, `{"Chat":{"Text":"`+text+`3"}}`)
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestAgent_ConcurrentWriters(t *testing.T) {
+	const writers, msgs = 8, 50
+	processor := json.NewProcessor()
+	processor.Register(&Login{})
+	processor.Register(&Chat{})
+	agents := make(chan gate.Agent, 1)
+	processor.SetHandler(&Login{}, func(args []interface{}) {
+		agents <- args[1].(gate.Agent)
+	})
+
+	g := &gate.Gate{Processor: processor, PendingWriteNum: writers * msgs}
+	startGate(t, g)
+
+	conn := dial(t, g.TCPAddr)
+	defer conn.Close()
+	writeMsg(t, conn, `{"Login": {}}`)
+	a := <-agents
+
+	for i := 0; i < writers; i++ {
+		go func(i int) {
+			for j := 0; j < msgs; j++ {
+				text := fmt.Sprintf("%v-%v-%v", i, j, strings.Repeat("x", 100))
+				if j%2 == 0 {
+					a.WriteMsg(&Chat{text})
+				} else {
+					a.WriteRaw([]byte(`{"Chat":{"Text":"`), []byte(text), []byte(`"}}`))
+				}
+			}
+		}(i)
+	}
+
+	// every message is whole, in order per writer
+	next := make([]int, writers)
+	for n := 0; n < writers*msgs; n++ {
+		got, err := readMsg(t, conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var i, j int
+		if _, err := fmt.Sscanf(got, `{"Chat":{"Text":"%d-%d-`, &i, &j); err != nil {
+			t.Fatalf("corrupted message %q", got)
+		}
+		want := fmt.Sprintf(`{"Chat":{"Text":"%v-%v-%v"}}`, i, j, strings.Repeat("x", 100))
+		if got != want || j != next[i] {
+			t.Fatalf("got %q, want message %v of writer %v", got, next[i], i)
+		}
+		next[i]++
+	}
+}
+
+func TestGate_CanAccept(t *testing.T) {
+	server := chanrpc.NewServer(2)
+	var handled atomic.Int32
+	server.Register(reflect.TypeOf(&Chat{}), func(args []interface{}) {
+		handled.Add(1)
+	})
+	processor := json.NewProcessor()
+	processor.Register(&Chat{})
+	processor.SetRouter(&Chat{}, server)
+
+	var read atomic.Int32
+	g := &gate.Gate{
+		Processor: processor,
+		CanAccept: func() bool {
+			return len(server.ChanCall) < cap(server.ChanCall)
+		},
+		FrameLogger: func(dir network.FrameDirection, _ time.Time, _ []byte) {
+			if dir == network.FrameIn {
+				read.Add(1)
+			}
+		},
+	}
+	startGate(t, g)
+
+	conn := dial(t, g.TCPAddr)
+	defer conn.Close()
+	for i := 0; i < 5; i++ {
+		writeMsg(t, conn, `{"Chat": {"Text": "hi"}}`)
+	}
+
+	// the queue is full, the agent is paused instead of blocked on it
+	time.Sleep(100 * time.Millisecond)
+	if n := read.Load(); n != 2 {
+		t.Fatalf("%v messages read, want 2", n)
+	}
+
+	// resumes as the queue drains
+	go func() {
+		for ci := range server.ChanCall {
+			server.Exec(ci)
+		}
+	}()
+	defer server.Close()
+	for i := 0; i < 200 && handled.Load() < 5; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := handled.Load(); n != 5 {
+		t.Fatalf("%v messages handled, want 5", n)
+	}
+}
+
+// accepts the server ends of pipes, writes block until the client reads
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *pipeListener) dial() net.Conn {
+	server, client := net.Pipe()
+	l.conns <- server
+	return client
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "pipe", Net: "pipe"}
+}
+
+func TestAgent_PendingWrites(t *testing.T) {
+	processor := json.NewProcessor()
+	processor.Register(&Login{})
+	processor.Register(&Chat{})
+	agents := make(chan gate.Agent, 1)
+	processor.SetHandler(&Login{}, func(args []interface{}) {
+		agents <- args[1].(gate.Agent)
+	})
+
+	ln := newPipeListener()
+	g := &gate.Gate{PendingWriteNum: 100}
+	g.AddListener(ln, processor)
+	startGate(t, g)
+
+	conn := ln.dial()
+	defer conn.Close()
+	writeMsg(t, conn, `{"Login": {}}`)
+	a := <-agents
+
+	if a.PendingWrites() != 0 || a.PendingWriteCap() != 100 {
+		t.Fatalf("got %v/%v pending writes", a.PendingWrites(), a.PendingWriteCap())
+	}
+
+	// the first message is taken by the writer, blocked on the pipe
+	for i := 0; i < 11; i++ {
+		a.WriteMsg(&Chat{"hi"})
+	}
+	for i := 0; i < 100 && a.PendingWrites() != 10; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if n := a.PendingWrites(); n != 10 {
+		t.Fatalf("got %v pending writes, want 10", n)
+	}
+
+	for i := 0; i < 11; i++ {
+		if _, err := readMsg(t, conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := a.PendingWrites(); n != 0 {
+		t.Fatalf("got %v pending writes after reading, want 0", n)
+	}
+}
+
+func TestGate_KickMsg(t *testing.T) {
+	processor := json.NewProcessor()
+	processor.Register(&Login{})
+	processor.Register(&Chat{})
+	logins := make(chan gate.Agent, 2)
+	processor.SetHandler(&Login{}, func(args []interface{}) {
+		a := args[1].(gate.Agent)
+		a.SetIdentity("user")
+		logins <- a
+	})
+
+	g := &gate.Gate{
+		Processor: processor,
+		KickMsg:   &Chat{Text: "logged in elsewhere"},
+	}
+	startGate(t, g)
+
+	conn := dial(t, g.TCPAddr)
+	defer conn.Close()
+	writeMsg(t, conn, `{"Login": {}}`)
+	first := <-logins
+
+	conn2 := dial(t, g.TCPAddr)
+	defer conn2.Close()
+	writeMsg(t, conn2, `{"Login": {}}`)
+	second := <-logins
+
+	msg, err := readMsg(t, conn)
+	if err != nil || msg != `{"Chat":{"Text":"logged in elsewhere"}}` {
+		t.Fatalf("got %q %v, want the kick message", msg, err)
+	}
+	if _, err := readMsg(t, conn); err == nil || isTimeout(err) {
+		t.Fatalf("previous connection not closed: %v", err)
+	}
+	if first.Identity() != nil || second.Identity() != "user" {
+		t.Fatalf("got identities %v and %v", first.Identity(), second.Identity())
+	}
+	if g.AgentByIdentity("user") != second {
+		t.Fatal("identity not held by the new agent")
+	}
+
+	// the identity is released with the agent
+	conn2.Close()
+	for i := 0; i < 100 && g.AgentByIdentity("user") != nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if g.AgentByIdentity("user") != nil {
+		t.Fatal("identity not released")
+	}
+}
+
+func TestGate_ListenerFD(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no listener file on windows")
+	}
+
+	old := new(gate.Gate)
+	stopOld := startGate(t, old)
+	var f *os.File
+	var err error
+	for i := 0; i < 100; i++ {
+		if f, err = old.ListenerFD(); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processor := json.NewProcessor()
+	processor.Register(&Chat{})
+	chats := make(chan string, 1)
+	processor.SetHandler(&Chat{}, func(args []interface{}) {
+		chats <- args[0].(*Chat).Text
+	})
+	g := &gate.Gate{
+		Processor:       processor,
+		TCPListenerFile: f,
+	}
+	startGate(t, g)
+	// the old gate stops accepting, the bind is kept by the new one
+	stopOld()
+
+	conn := dial(t, old.TCPAddr)
+	defer conn.Close()
+	writeMsg(t, conn, `{"Chat": {"Text": "resumed"}}`)
+	select {
+	case text := <-chats:
+		if text != "resumed" {
+			t.Fatalf("got %v, want resumed", text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("connection not accepted by the new gate")
+	}
+}
@@ -0,0 +1,94 @@
+package gate
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// upper bounds of the connection duration histogram,
+// the last bucket of Metrics.DurationBuckets counts the rest
+var DurationBuckets = [...]time.Duration{
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+	10 * time.Minute,
+	time.Hour,
+}
+
+type Metrics struct {
+	Accepted        uint64
+	Active          int64
+	Closed          uint64
+	TotalDuration   time.Duration
+	MaxDuration     time.Duration
+	DurationBuckets []uint64
+}
+
+// messages dropped by an agent
+type DroppedMsgs struct {
+	TooLong    uint64
+	Malformed  uint64
+	Unroutable uint64
+}
+
+type droppedMsgs struct {
+	tooLong    atomic.Uint64
+	malformed  atomic.Uint64
+	unroutable atomic.Uint64
+}
+
+func (d *droppedMsgs) total() uint64 {
+	return d.tooLong.Load() + d.malformed.Load() + d.unroutable.Load()
+}
+
+type metrics struct {
+	accepted        atomic.Uint64
+	active          atomic.Int64
+	closed          atomic.Uint64
+	totalDuration   atomic.Int64
+	maxDuration     atomic.Int64
+	durationBuckets [len(DurationBuckets) + 1]atomic.Uint64
+}
+
+func (m *metrics) onAccept() {
+	m.accepted.Add(1)
+	m.active.Add(1)
+}
+
+func (m *metrics) onClose(d time.Duration) {
+	m.totalDuration.Add(int64(d))
+	for {
+		max := m.maxDuration.Load()
+		if int64(d) <= max || m.maxDuration.CompareAndSwap(max, int64(d)) {
+			break
+		}
+	}
+
+	i := 0
+	for i < len(DurationBuckets) && d > DurationBuckets[i] {
+		i++
+	}
+	m.durationBuckets[i].Add(1)
+
+	m.active.Add(-1)
+	m.closed.Add(1)
+}
+
+// goroutine safe
+func (gate *Gate) Metrics() Metrics {
+	m := &gate.metrics
+
+	buckets := make([]uint64, len(m.durationBuckets))
+	for i := range buckets {
+		buckets[i] = m.durationBuckets[i].Load()
+	}
+
+	return Metrics{
+		Accepted:        m.accepted.Load(),
+		Active:          m.active.Load(),
+		Closed:          m.closed.Load(),
+		TotalDuration:   time.Duration(m.totalDuration.Load()),
+		MaxDuration:     time.Duration(m.maxDuration.Load()),
+		DurationBuckets: buckets,
+	}
+}
@@ -6,12 +6,25 @@ import (
 	"github.com/name5566/leaf/log"
 	"runtime"
 	"sync"
+	"time"
 )
 
 // one Go per goroutine (goroutine not safe)
 type Go struct {
 	ChanCb    chan func()
 	pendingGo int
+	panicChan chan PanicInfo
+	timers    map[*GoTimer]struct{}
+}
+
+// panics not yet received from PanicChan, the newer ones are dropped
+const panicChanLen = 16
+
+type PanicInfo struct {
+	Value interface{}
+	// nil if conf.LenStackBuf is 0
+	Stack []byte
+	Time  time.Time
 }
 
 type LinearGo struct {
@@ -29,41 +42,93 @@ type LinearContext struct {
 func New(l int) *Go {
 	g := new(Go)
 	g.ChanCb = make(chan func(), l)
+	g.panicChan = make(chan PanicInfo, panicChanLen)
 	return g
 }
 
+// every panic recovered from f or cb, dropped if nobody reads it
+// goroutine safe
+func (g *Go) PanicChan() <-chan PanicInfo {
+	return g.panicChan
+}
+
+func (g *Go) recover(r interface{}) {
+	var stack []byte
+	if n := conf.Current().LenStackBuf; n > 0 {
+		buf := make([]byte, n)
+		l := runtime.Stack(buf, false)
+		stack = buf[:l]
+		log.Error("%v: %s", r, stack)
+	} else {
+		log.Error("%v", r)
+	}
+
+	select {
+	case g.panicChan <- PanicInfo{Value: r, Stack: stack, Time: time.Now()}:
+	default:
+	}
+}
+
 func (g *Go) Go(f func(), cb func()) {
 	g.pendingGo++
 
-	go func() {
-		defer func() {
-			g.ChanCb <- cb
-			if r := recover(); r != nil {
-				if conf.LenStackBuf > 0 {
-					buf := make([]byte, conf.LenStackBuf)
-					l := runtime.Stack(buf, false)
-					log.Error("%v: %s", r, buf[:l])
-				} else {
-					log.Error("%v", r)
-				}
-			}
-		}()
+	go g.exec(f, cb)
+}
 
-		f()
+func (g *Go) exec(f func(), cb func()) {
+	defer func() {
+		g.ChanCb <- cb
+		if r := recover(); r != nil {
+			g.recover(r)
+		}
 	}()
+
+	f()
+}
+
+type GoTimer struct {
+	g *Go
+	t *time.Timer
+}
+
+// the task counts as pending until cb is called or the timer is stopped,
+// Close stops it if f has not started and waits for it otherwise
+func (g *Go) GoAfter(d time.Duration, f func(), cb func()) *GoTimer {
+	g.pendingGo++
+
+	t := new(GoTimer)
+	t.g = g
+	if g.timers == nil {
+		g.timers = make(map[*GoTimer]struct{})
+	}
+	g.timers[t] = struct{}{}
+	t.t = time.AfterFunc(d, func() {
+		g.exec(f, func() {
+			delete(g.timers, t)
+			if cb != nil {
+				cb()
+			}
+		})
+	})
+	return t
+}
+
+// returns false if f has already started
+// goroutine not safe (call it from the goroutine which owns the Go)
+func (t *GoTimer) Stop() bool {
+	if t.t.Stop() {
+		delete(t.g.timers, t)
+		t.g.pendingGo--
+		return true
+	}
+	return false
 }
 
 func (g *Go) Cb(cb func()) {
 	defer func() {
 		g.pendingGo--
 		if r := recover(); r != nil {
-			if conf.LenStackBuf > 0 {
-				buf := make([]byte, conf.LenStackBuf)
-				l := runtime.Stack(buf, false)
-				log.Error("%v: %s", r, buf[:l])
-			} else {
-				log.Error("%v", r)
-			}
+			g.recover(r)
 		}
 	}()
 
@@ -72,7 +137,23 @@ func (g *Go) Cb(cb func()) {
 	}
 }
 
+// calls cb then the callbacks already queued in ChanCb without waiting,
+// in the order they were queued, returns the number of callbacks called
+// the callbacks queued meanwhile are left for the next call so the other
+// channels of the loop are not starved
+func (g *Go) CbBatch(cb func()) int {
+	g.Cb(cb)
+	n := len(g.ChanCb)
+	for i := 0; i < n; i++ {
+		g.Cb(<-g.ChanCb)
+	}
+	return n + 1
+}
+
 func (g *Go) Close() {
+	for t := range g.timers {
+		t.Stop()
+	}
 	for g.pendingGo > 0 {
 		g.Cb(<-g.ChanCb)
 	}
@@ -107,13 +188,7 @@ func (c *LinearContext) Go(f func(), cb func()) {
 		defer func() {
 			c.g.ChanCb <- e.cb
 			if r := recover(); r != nil {
-				if conf.LenStackBuf > 0 {
-					buf := make([]byte, conf.LenStackBuf)
-					l := runtime.Stack(buf, false)
-					log.Error("%v: %s", r, buf[:l])
-				} else {
-					log.Error("%v", r)
-				}
+				c.g.recover(r)
 			}
 		}()
 
@@ -0,0 +1,189 @@
+package g_test
+
+import (
+	"github.com/name5566/leaf/go"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestGo_GoAfter(t *testing.T) {
+	d := g.New(10)
+
+	start := time.Now()
+	var ran time.Duration
+	called := false
+	d.GoAfter(50*time.Millisecond, func() {
+		ran = time.Since(start)
+	}, func() {
+		called = true
+	})
+	if d.Idle() {
+		t.Fatal("delayed task not pending")
+	}
+
+	d.Cb(<-d.ChanCb)
+	if ran < 50*time.Millisecond || !called {
+		t.Fatalf("ran after %v, callback called: %v", ran, called)
+	}
+	if !d.Idle() {
+		t.Fatal("task still pending")
+	}
+}
+
+func TestGo_CloseGoAfter(t *testing.T) {
+	d := g.New(10)
+	d.GoAfter(time.Hour, func() {
+		t.Error("task executed after Close")
+	}, nil)
+
+	closed := make(chan struct{})
+	go func() {
+		d.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close waited for the delayed task")
+	}
+	if !d.Idle() {
+		t.Fatal("delayed task still pending")
+	}
+}
+
+func TestGoTimer_Stop(t *testing.T) {
+	d := g.New(10)
+
+	ran := make(chan struct{}, 1)
+	timer := d.GoAfter(20*time.Millisecond, func() {
+		ran <- struct{}{}
+	}, func() {
+		t.Error("callback of a stopped task called")
+	})
+	if !timer.Stop() {
+		t.Fatal("Stop failed")
+	}
+	if timer.Stop() {
+		t.Fatal("Stop succeeded twice")
+	}
+	if !d.Idle() {
+		t.Fatal("stopped task still pending")
+	}
+
+	select {
+	case <-ran:
+		t.Fatal("stopped task executed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	d.Close()
+}
+
+func TestGo_PanicChan(t *testing.T) {
+	d := g.New(10)
+
+	d.Go(func() {
+		panic("task failed")
+	}, nil)
+	d.Go(func() {}, func() {
+		panic("callback failed")
+	})
+	d.Close()
+
+	got := make(map[interface{}]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case p := <-d.PanicChan():
+			if p.Time.IsZero() {
+				t.Fatal("panic time not set")
+			}
+			got[p.Value] = true
+		default:
+			t.Fatalf("panics not reported: %v", got)
+		}
+	}
+	if !got["task failed"] || !got["callback failed"] {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestGo_PanicChanNotRead(t *testing.T) {
+	d := g.New(100)
+
+	for i := 0; i < 50; i++ {
+		d.Go(func() {
+			panic("ignored")
+		}, nil)
+	}
+	done := make(chan struct{})
+	go func() {
+		d.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("unread panics block the tasks")
+	}
+}
+
+func TestGo_CbBatch(t *testing.T) {
+	d := g.New(10)
+	c := d.NewLinearContext()
+
+	var order []int
+	for i := 0; i < 10; i++ {
+		i := i
+		c.Go(func() {}, func() {
+			order = append(order, i)
+		})
+	}
+	for len(d.ChanCb) < 9 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cb := <-d.ChanCb
+	for len(d.ChanCb) < 9 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := d.CbBatch(cb); n != 10 {
+		t.Fatalf("%v callbacks in the batch, want 10", n)
+	}
+	if !d.Idle() {
+		t.Fatal("callbacks still pending")
+	}
+	for i, v := range order {
+		if v != i {
+			t.Fatalf("got %v, want the order of the queue", order)
+		}
+	}
+}
+
+// the tasks complete faster than their callbacks are called
+func benchmarkCb(b *testing.B, batch bool) {
+	d := g.New(100)
+	wakeups := 0
+	for i := 0; i < b.N; i++ {
+		d.Go(func() {}, func() {
+			runtime.Gosched()
+		})
+	}
+	for !d.Idle() {
+		cb := <-d.ChanCb
+		wakeups++
+		if batch {
+			d.CbBatch(cb)
+		} else {
+			d.Cb(cb)
+		}
+	}
+	b.ReportMetric(float64(wakeups)/float64(b.N), "wakeups/op")
+}
+
+func BenchmarkGo_Cb(b *testing.B) {
+	benchmarkCb(b, false)
+}
+
+func BenchmarkGo_CbBatch(b *testing.B) {
+	benchmarkCb(b, true)
+}
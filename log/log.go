@@ -7,6 +7,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,25 +27,34 @@ const (
 )
 
 type Logger struct {
-	level      int
+	// shared with the loggers returned by With
+	level      *atomic.Int32
 	baseLogger *log.Logger
 	baseFile   *os.File
+	callerSkip int
+	fields     string
 }
 
-func New(strLevel string, pathname string, flag int) (*Logger, error) {
-	// level
-	var level int
+func parseLevel(strLevel string) (int32, error) {
 	switch strings.ToLower(strLevel) {
 	case "debug":
-		level = debugLevel
+		return debugLevel, nil
 	case "release":
-		level = releaseLevel
+		return releaseLevel, nil
 	case "error":
-		level = errorLevel
+		return errorLevel, nil
 	case "fatal":
-		level = fatalLevel
+		return fatalLevel, nil
 	default:
-		return nil, errors.New("unknown level: " + strLevel)
+		return 0, errors.New("unknown level: " + strLevel)
+	}
+}
+
+func New(strLevel string, pathname string, flag int) (*Logger, error) {
+	// level
+	level, err := parseLevel(strLevel)
+	if err != nil {
+		return nil, err
 	}
 
 	// logger
@@ -74,7 +84,8 @@ func New(strLevel string, pathname string, flag int) (*Logger, error) {
 
 	// new
 	logger := new(Logger)
-	logger.level = level
+	logger.level = new(atomic.Int32)
+	logger.level.Store(level)
 	logger.baseLogger = baseLogger
 	logger.baseFile = baseFile
 
@@ -91,16 +102,53 @@ func (logger *Logger) Close() {
 	logger.baseFile = nil
 }
 
-func (logger *Logger) doPrintf(level int, printLevel string, format string, a ...interface{}) {
-	if level < logger.level {
+// returns a logger prefixing every message with the key=value pairs,
+// it writes to the same output and must not be used once logger is closed
+func (logger *Logger) With(kv ...interface{}) *Logger {
+	child := new(Logger)
+	*child = *logger
+	// closing the child does not close the file of the parent
+	child.baseFile = nil
+
+	fields := logger.fields
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 < len(kv) {
+			fields += fmt.Sprintf("%v=%v ", kv[i], kv[i+1])
+		} else {
+			fields += fmt.Sprintf("%v=(MISSING) ", kv[i])
+		}
+	}
+	child.fields = fields
+
+	return child
+}
+
+// the loggers returned by With get the level too
+// goroutine safe
+func (logger *Logger) SetLevel(strLevel string) error {
+	level, err := parseLevel(strLevel)
+	if err != nil {
+		return err
+	}
+	logger.level.Store(level)
+	return nil
+}
+
+// It's dangerous to call the method on logging
+func (logger *Logger) SetCallerSkip(skip int) {
+	logger.callerSkip = skip
+}
+
+func (logger *Logger) doPrintf(skip int, level int32, printLevel string, format string, a ...interface{}) {
+	if level < logger.level.Load() {
 		return
 	}
 	if logger.baseLogger == nil {
 		panic("logger closed")
 	}
 
-	format = printLevel + format
-	logger.baseLogger.Output(3, fmt.Sprintf(format, a...))
+	logger.baseLogger.Output(3+logger.callerSkip+skip,
+		printLevel+logger.fields+fmt.Sprintf(format, a...))
 
 	if level == fatalLevel {
 		os.Exit(1)
@@ -108,19 +156,35 @@ func (logger *Logger) doPrintf(level int, printLevel string, format string, a ..
 }
 
 func (logger *Logger) Debug(format string, a ...interface{}) {
-	logger.doPrintf(debugLevel, printDebugLevel, format, a...)
+	logger.doPrintf(0, debugLevel, printDebugLevel, format, a...)
 }
 
 func (logger *Logger) Release(format string, a ...interface{}) {
-	logger.doPrintf(releaseLevel, printReleaseLevel, format, a...)
+	logger.doPrintf(0, releaseLevel, printReleaseLevel, format, a...)
 }
 
 func (logger *Logger) Error(format string, a ...interface{}) {
-	logger.doPrintf(errorLevel, printErrorLevel, format, a...)
+	logger.doPrintf(0, errorLevel, printErrorLevel, format, a...)
 }
 
 func (logger *Logger) Fatal(format string, a ...interface{}) {
-	logger.doPrintf(fatalLevel, printFatalLevel, format, a...)
+	logger.doPrintf(0, fatalLevel, printFatalLevel, format, a...)
+}
+
+func (logger *Logger) DebugSkip(skip int, format string, a ...interface{}) {
+	logger.doPrintf(skip, debugLevel, printDebugLevel, format, a...)
+}
+
+func (logger *Logger) ReleaseSkip(skip int, format string, a ...interface{}) {
+	logger.doPrintf(skip, releaseLevel, printReleaseLevel, format, a...)
+}
+
+func (logger *Logger) ErrorSkip(skip int, format string, a ...interface{}) {
+	logger.doPrintf(skip, errorLevel, printErrorLevel, format, a...)
+}
+
+func (logger *Logger) FatalSkip(skip int, format string, a ...interface{}) {
+	logger.doPrintf(skip, fatalLevel, printFatalLevel, format, a...)
 }
 
 var gLogger, _ = New("debug", "", log.LstdFlags)
@@ -132,20 +196,46 @@ func Export(logger *Logger) {
 	}
 }
 
+// sets the level of the logger exported
+// goroutine safe
+func SetLevel(strLevel string) error {
+	return gLogger.SetLevel(strLevel)
+}
+
+func With(kv ...interface{}) *Logger {
+	return gLogger.With(kv...)
+}
+
 func Debug(format string, a ...interface{}) {
-	gLogger.doPrintf(debugLevel, printDebugLevel, format, a...)
+	gLogger.doPrintf(0, debugLevel, printDebugLevel, format, a...)
 }
 
 func Release(format string, a ...interface{}) {
-	gLogger.doPrintf(releaseLevel, printReleaseLevel, format, a...)
+	gLogger.doPrintf(0, releaseLevel, printReleaseLevel, format, a...)
 }
 
 func Error(format string, a ...interface{}) {
-	gLogger.doPrintf(errorLevel, printErrorLevel, format, a...)
+	gLogger.doPrintf(0, errorLevel, printErrorLevel, format, a...)
 }
 
 func Fatal(format string, a ...interface{}) {
-	gLogger.doPrintf(fatalLevel, printFatalLevel, format, a...)
+	gLogger.doPrintf(0, fatalLevel, printFatalLevel, format, a...)
+}
+
+func DebugSkip(skip int, format string, a ...interface{}) {
+	gLogger.doPrintf(skip, debugLevel, printDebugLevel, format, a...)
+}
+
+func ReleaseSkip(skip int, format string, a ...interface{}) {
+	gLogger.doPrintf(skip, releaseLevel, printReleaseLevel, format, a...)
+}
+
+func ErrorSkip(skip int, format string, a ...interface{}) {
+	gLogger.doPrintf(skip, errorLevel, printErrorLevel, format, a...)
+}
+
+func FatalSkip(skip int, format string, a ...interface{}) {
+	gLogger.doPrintf(skip, fatalLevel, printFatalLevel, format, a...)
 }
 
 func Close() {
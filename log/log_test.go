@@ -0,0 +1,136 @@
+package log_test
+
+import (
+	"github.com/name5566/leaf/log"
+	l "log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newLogger(t *testing.T) (*log.Logger, string) {
+	dir := t.TempDir()
+	logger, err := log.New("debug", dir, l.Lshortfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(logger.Close)
+	return logger, dir
+}
+
+func output(t *testing.T, dir string) string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("log file not found: %v", err)
+	}
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func here() string {
+	_, file, line, _ := runtime.Caller(1)
+	return filepath.Base(file) + ":" + strconv.Itoa(line+1)
+}
+
+func wrapper1(logger *log.Logger, format string, a ...interface{}) {
+	logger.DebugSkip(1, format, a...)
+}
+
+func wrapper2(logger *log.Logger, format string, a ...interface{}) {
+	wrapper2Inner(logger, format, a...)
+}
+
+func wrapper2Inner(logger *log.Logger, format string, a ...interface{}) {
+	logger.Debug(format, a...)
+}
+
+func TestLogger_CallerSkip(t *testing.T) {
+	logger, dir := newLogger(t)
+
+	line0 := here()
+	logger.Debug("direct")
+	line1 := here()
+	wrapper1(logger, "one wrapper")
+
+	logger.SetCallerSkip(2)
+	line2 := here()
+	wrapper2(logger, "two wrappers")
+
+	lines := strings.Split(strings.TrimSpace(output(t, dir)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected output: %q", lines)
+	}
+	for i, want := range []string{line0, line1, line2} {
+		if !strings.HasPrefix(lines[i], want+": ") {
+			t.Errorf("line %v: got %q, want prefix %q", i, lines[i], want)
+		}
+	}
+}
+
+func TestLogger_With(t *testing.T) {
+	logger, dir := newLogger(t)
+
+	child := logger.With("player", 42, "conn", 7)
+	grandchild := child.With("scene", "lobby", "odd")
+
+	child.Debug("hello %v", "world")
+	logger.Debug("plain")
+	grandchild.Release("100%% done")
+	child.Close()
+	logger.Debug("parent still open")
+
+	lines := strings.Split(strings.TrimSpace(output(t, dir)), "\n")
+	want := []string{
+		"[debug  ] player=42 conn=7 hello world",
+		"[debug  ] plain",
+		"[release] player=42 conn=7 scene=lobby odd=(MISSING) 100% done",
+		"[debug  ] parent still open",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("unexpected output: %q", lines)
+	}
+	for i := range want {
+		if !strings.HasSuffix(lines[i], ": "+want[i]) {
+			t.Errorf("line %v: got %q, want suffix %q", i, lines[i], want[i])
+		}
+	}
+}
+
+func TestLogger_SetLevel(t *testing.T) {
+	logger, dir := newLogger(t)
+	child := logger.With("conn", 7)
+
+	if err := logger.SetLevel("verbose"); err == nil {
+		t.Fatal("unknown level set")
+	}
+	if err := logger.SetLevel("error"); err != nil {
+		t.Fatal(err)
+	}
+	logger.Release("dropped")
+	child.Debug("dropped")
+	child.Error("kept")
+	if err := logger.SetLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("kept again")
+
+	lines := strings.Split(strings.TrimSpace(output(t, dir)), "\n")
+	want := []string{
+		"[error  ] conn=7 kept",
+		"[debug  ] kept again",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("unexpected output: %q", lines)
+	}
+	for i := range want {
+		if !strings.HasSuffix(lines[i], ": "+want[i]) {
+			t.Errorf("line %v: got %q, want suffix %q", i, lines[i], want[i])
+		}
+	}
+}
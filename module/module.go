@@ -5,6 +5,7 @@ import (
 	"github.com/name5566/leaf/log"
 	"runtime"
 	"sync"
+	"time"
 )
 
 type Module interface {
@@ -19,19 +20,74 @@ type module struct {
 	wg       sync.WaitGroup
 }
 
-var mods []*module
+var (
+	mods      []*module
+	mutexMods sync.Mutex
+)
+
+// the durations of the lifecycle methods of a module
+type Timing struct {
+	Name    string
+	Init    time.Duration
+	Destroy time.Duration
+}
+
+var (
+	timings      []Timing
+	mutexTimings sync.Mutex
+)
+
+// the modules in the order of registration, Destroy is 0 until the module
+// is destroyed
+// goroutine safe
+func Timings() []Timing {
+	mutexTimings.Lock()
+	defer mutexTimings.Unlock()
+	return append([]Timing(nil), timings...)
+}
+
+func timed(mi Module, method string, f func()) time.Duration {
+	start := time.Now()
+	f()
+	d := time.Since(start)
+	if threshold := conf.Current().SlowModuleThreshold; threshold > 0 && d > threshold {
+		log.Release("module %v: slow %v %v", name(mi), method, d)
+	} else {
+		log.Debug("module %v: %v %v", name(mi), method, d)
+	}
+	return d
+}
+
+// a copy of mods, the lifecycle methods are called without holding
+// mutexMods
+func registered() []*module {
+	mutexMods.Lock()
+	defer mutexMods.Unlock()
+	return append([]*module(nil), mods...)
+}
 
 func Register(mi Module) {
 	m := new(module)
 	m.mi = mi
 	m.closeSig = make(chan bool, 1)
 
+	mutexMods.Lock()
 	mods = append(mods, m)
+	mutexMods.Unlock()
 }
 
 func Init() {
+	mods := registered()
+
+	mutexTimings.Lock()
+	timings = make([]Timing, len(mods))
+	mutexTimings.Unlock()
 	for i := 0; i < len(mods); i++ {
-		mods[i].mi.OnInit()
+		mi := mods[i].mi
+		d := timed(mi, "OnInit", mi.OnInit)
+		mutexTimings.Lock()
+		timings[i] = Timing{Name: name(mi), Init: d}
+		mutexTimings.Unlock()
 	}
 
 	for i := 0; i < len(mods); i++ {
@@ -39,14 +95,27 @@ func Init() {
 		m.wg.Add(1)
 		go run(m)
 	}
+
+	initDoneOnce.Do(func() {
+		close(initDone)
+	})
 }
 
 func Destroy() {
+	mods := registered()
+
 	for i := len(mods) - 1; i >= 0; i-- {
 		m := mods[i]
 		m.closeSig <- true
 		m.wg.Wait()
-		destroy(m)
+		d := timed(m.mi, "OnDestroy", func() {
+			destroy(m)
+		})
+		mutexTimings.Lock()
+		if i < len(timings) {
+			timings[i].Destroy = d
+		}
+		mutexTimings.Unlock()
 	}
 }
 
@@ -58,8 +127,8 @@ func run(m *module) {
 func destroy(m *module) {
 	defer func() {
 		if r := recover(); r != nil {
-			if conf.LenStackBuf > 0 {
-				buf := make([]byte, conf.LenStackBuf)
+			if n := conf.Current().LenStackBuf; n > 0 {
+				buf := make([]byte, n)
 				l := runtime.Stack(buf, false)
 				log.Error("%v: %s", r, buf[:l])
 			} else {
@@ -0,0 +1,68 @@
+package module_test
+
+import (
+	"github.com/name5566/leaf/conf"
+	"github.com/name5566/leaf/log"
+	"github.com/name5566/leaf/module"
+	l "log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type slowModule struct {
+	plainModule
+}
+
+func (m *slowModule) OnInit() {
+	time.Sleep(30 * time.Millisecond)
+}
+
+func TestTimings(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := log.New("debug", dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Export(logger)
+	defer func() {
+		stdout, _ := log.New("debug", "", l.LstdFlags)
+		log.Export(stdout)
+		logger.Close()
+	}()
+	conf.SlowModuleThreshold = 20 * time.Millisecond
+	defer func() { conf.SlowModuleThreshold = 0 }()
+
+	module.Register(new(plainModule))
+	module.Register(new(slowModule))
+	module.Init()
+	module.Destroy()
+
+	timings := module.Timings()
+	if len(timings) != 2 || timings[0].Name != "module_test.plainModule" || timings[1].Name != "module_test.slowModule" {
+		t.Fatalf("unexpected timings %+v", timings)
+	}
+	if d := timings[1].Init; d < 30*time.Millisecond {
+		t.Fatalf("OnInit took %v, want 30ms at least", d)
+	}
+	if d := timings[0].Init; d >= 20*time.Millisecond {
+		t.Fatalf("OnInit of the plain module took %v", d)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(files) != 1 {
+		t.Fatal("log file not found")
+	}
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "[release] module module_test.slowModule: slow OnInit") {
+		t.Fatalf("slow module not logged: %q", b)
+	}
+	if strings.Contains(string(b), "module_test.plainModule: slow") {
+		t.Fatalf("plain module logged as slow: %q", b)
+	}
+}
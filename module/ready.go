@@ -0,0 +1,55 @@
+package module
+
+import (
+	"sync"
+)
+
+// a module implements ReadyNotifier when it has to warm up before the
+// others depend on it, Ready must return the same channel from the
+// creation of the module and the channel is closed once it is ready
+type ReadyNotifier interface {
+	Ready() <-chan struct{}
+}
+
+var (
+	initDone     = make(chan struct{})
+	initDoneOnce sync.Once
+)
+
+// the returned channel is closed once all mods implementing ReadyNotifier
+// are ready
+func AllReady(mods ...Module) <-chan struct{} {
+	var chans []<-chan struct{}
+	for _, mi := range mods {
+		if r, ok := mi.(ReadyNotifier); ok {
+			chans = append(chans, r.Ready())
+		}
+	}
+
+	c := make(chan struct{})
+	go func() {
+		for _, ready := range chans {
+			<-ready
+		}
+		close(c)
+	}()
+	return c
+}
+
+// the returned channel is closed once Init is called and
+// all registered modules are ready
+// goroutine safe
+func Ready() <-chan struct{} {
+	c := make(chan struct{})
+	go func() {
+		<-initDone
+		mods := registered()
+		mis := make([]Module, len(mods))
+		for i, m := range mods {
+			mis[i] = m.mi
+		}
+		<-AllReady(mis...)
+		close(c)
+	}()
+	return c
+}
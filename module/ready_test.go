@@ -0,0 +1,48 @@
+package module_test
+
+import (
+	"github.com/name5566/leaf/module"
+	"testing"
+	"time"
+)
+
+type warmupModule struct {
+	ready chan struct{}
+}
+
+func newWarmupModule(d time.Duration) *warmupModule {
+	m := &warmupModule{ready: make(chan struct{})}
+	time.AfterFunc(d, func() { close(m.ready) })
+	return m
+}
+
+func (m *warmupModule) OnInit()                {}
+func (m *warmupModule) OnDestroy()             {}
+func (m *warmupModule) Run(closeSig chan bool) { <-closeSig }
+func (m *warmupModule) Ready() <-chan struct{} { return m.ready }
+
+type plainModule struct{}
+
+func (m *plainModule) OnInit()                {}
+func (m *plainModule) OnDestroy()             {}
+func (m *plainModule) Run(closeSig chan bool) { <-closeSig }
+
+func TestAllReady(t *testing.T) {
+	start := time.Now()
+	ready := module.AllReady(newWarmupModule(20*time.Millisecond), new(plainModule), newWarmupModule(50*time.Millisecond))
+
+	select {
+	case <-ready:
+	case <-time.After(time.Second):
+		t.Fatal("modules not ready")
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("ready after %v, before the slowest module", d)
+	}
+
+	select {
+	case <-module.AllReady(new(plainModule)):
+	case <-time.After(time.Second):
+		t.Fatal("modules not ready")
+	}
+}
@@ -0,0 +1,72 @@
+package module
+
+import (
+	"fmt"
+	"github.com/name5566/leaf/console"
+	"github.com/name5566/leaf/log"
+	"reflect"
+	"strings"
+)
+
+// a module embedding a Skeleton implements Reloadable to be reloaded
+// OnReload is called on the goroutine of the module, the module must
+// keep its old state when an error is returned
+type Reloadable interface {
+	OnReload() error
+}
+
+// implemented by Skeleton
+type executor interface {
+	exec(f func() error) error
+}
+
+// registers the console command reload, usage: reload <module>
+// you must call the function before calling console.Init
+func RegisterReloadCommand() {
+	console.RegisterFunc("reload", "reload a module, usage: reload <module>", func(args []string) string {
+		if len(args) != 1 {
+			return "usage: reload <module>"
+		}
+		if err := Reload(args[0]); err != nil {
+			return err.Error()
+		}
+		return "done"
+	})
+}
+
+// the name of a module is its type name, e.g. "game.Module"
+func name(mi Module) string {
+	return strings.TrimPrefix(reflect.TypeOf(mi).String(), "*")
+}
+
+// you must call the function after calling Init
+// goroutine safe, must not be called on the goroutine of a module
+func Reload(n string) error {
+	var mi Module
+	for _, m := range registered() {
+		if name(m.mi) == n {
+			mi = m.mi
+			break
+		}
+	}
+	if mi == nil {
+		return fmt.Errorf("module %v not found", n)
+	}
+
+	r, ok := mi.(Reloadable)
+	if !ok {
+		return fmt.Errorf("module %v is not reloadable", n)
+	}
+	e, ok := mi.(executor)
+	if !ok {
+		return fmt.Errorf("module %v has no skeleton", n)
+	}
+
+	err := e.exec(r.OnReload)
+	if err != nil {
+		log.Error("reload module %v: %v", n, err)
+		return err
+	}
+	log.Release("module %v reloaded", n)
+	return nil
+}
@@ -0,0 +1,72 @@
+package module_test
+
+import (
+	"errors"
+	"github.com/name5566/leaf/chanrpc"
+	"github.com/name5566/leaf/module"
+	"testing"
+)
+
+type contentModule struct {
+	*module.Skeleton
+	content string
+	next    string
+}
+
+func (m *contentModule) OnInit() {
+	m.content = "v1"
+	m.RegisterChanRPC("content", func(args []interface{}) interface{} {
+		return m.content
+	})
+	m.RegisterChanRPC("publish", func(args []interface{}) {
+		m.next = args[0].(string)
+	})
+}
+
+func (m *contentModule) OnDestroy() {}
+
+func (m *contentModule) OnReload() error {
+	if m.next == "" {
+		return errors.New("no content")
+	}
+	m.content, m.next = m.next, ""
+	return nil
+}
+
+func TestReload(t *testing.T) {
+	m := &contentModule{Skeleton: &module.Skeleton{ChanRPCServer: chanrpc.NewServer(10)}}
+	m.Skeleton.Init()
+	module.Register(m)
+	module.Init()
+	defer module.Destroy()
+
+	content := func() string {
+		ret, err := m.ChanRPCServer.Call1("content")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ret.(string)
+	}
+
+	// failed reload keeps the old content
+	if err := module.Reload("module_test.contentModule"); err == nil || err.Error() != "no content" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if c := content(); c != "v1" {
+		t.Fatalf("content %v, want v1", c)
+	}
+
+	if err := m.ChanRPCServer.Call0("publish", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := module.Reload("module_test.contentModule"); err != nil {
+		t.Fatal(err)
+	}
+	if c := content(); c != "v2" {
+		t.Fatalf("content %v, want v2", c)
+	}
+
+	if err := module.Reload("game.Module"); err == nil {
+		t.Fatal("unknown module reloaded")
+	}
+}
@@ -13,6 +13,9 @@ type Skeleton struct {
 	TimerDispatcherLen int
 	AsynCallLen        int
 	ChanRPCServer      *chanrpc.Server
+	Clock              timer.Clock
+	TimerCoalesce      time.Duration
+	GoCbBatch          bool
 	g                  *g.Go
 	dispatcher         *timer.Dispatcher
 	client             *chanrpc.Client
@@ -32,7 +35,12 @@ func (s *Skeleton) Init() {
 	}
 
 	s.g = g.New(s.GoLen)
-	s.dispatcher = timer.NewDispatcher(s.TimerDispatcherLen)
+	if s.Clock != nil {
+		s.dispatcher = timer.NewDispatcherWithClock(s.TimerDispatcherLen, s.Clock)
+	} else {
+		s.dispatcher = timer.NewDispatcher(s.TimerDispatcherLen)
+	}
+	s.dispatcher.SetCoalesce(s.TimerCoalesce)
 	s.client = chanrpc.NewClient(s.AsynCallLen)
 	s.server = s.ChanRPCServer
 
@@ -40,12 +48,19 @@ func (s *Skeleton) Init() {
 		s.server = chanrpc.NewServer(0)
 	}
 	s.commandServer = chanrpc.NewServer(0)
+	s.commandServer.Register(reloadID{}, func(args []interface{}) interface{} {
+		return args[0].(func() error)()
+	})
+	s.commandServer.Register(tickID{}, func(args []interface{}) {
+		args[0].(func())()
+	})
 }
 
 func (s *Skeleton) Run(closeSig chan bool) {
 	for {
 		select {
 		case <-closeSig:
+			s.dispatcher.Close()
 			s.commandServer.Close()
 			s.server.Close()
 			for !s.g.Idle() || !s.client.Idle() {
@@ -60,13 +75,36 @@ func (s *Skeleton) Run(closeSig chan bool) {
 		case ci := <-s.commandServer.ChanCall:
 			s.commandServer.Exec(ci)
 		case cb := <-s.g.ChanCb:
-			s.g.Cb(cb)
+			if s.GoCbBatch {
+				s.g.CbBatch(cb)
+			} else {
+				s.g.Cb(cb)
+			}
 		case t := <-s.dispatcher.ChanTimer:
 			t.Cb()
 		}
 	}
 }
 
+// processes one pending item if any, instead of Run (for tests)
+func (s *Skeleton) RunOnce() bool {
+	select {
+	case ri := <-s.client.ChanAsynRet:
+		s.client.Cb(ri)
+	case ci := <-s.server.ChanCall:
+		s.server.Exec(ci)
+	case ci := <-s.commandServer.ChanCall:
+		s.commandServer.Exec(ci)
+	case cb := <-s.g.ChanCb:
+		s.g.Cb(cb)
+	case t := <-s.dispatcher.ChanTimer:
+		t.Cb()
+	default:
+		return false
+	}
+	return true
+}
+
 func (s *Skeleton) AfterFunc(d time.Duration, cb func()) *timer.Timer {
 	if s.TimerDispatcherLen == 0 {
 		panic("invalid TimerDispatcherLen")
@@ -75,6 +113,14 @@ func (s *Skeleton) AfterFunc(d time.Duration, cb func()) *timer.Timer {
 	return s.dispatcher.AfterFunc(d, cb)
 }
 
+func (s *Skeleton) AtFunc(t time.Time, cb func()) *timer.Timer {
+	if s.TimerDispatcherLen == 0 {
+		panic("invalid TimerDispatcherLen")
+	}
+
+	return s.dispatcher.AtFunc(t, cb)
+}
+
 func (s *Skeleton) CronFunc(cronExpr *timer.CronExpr, cb func()) *timer.Cron {
 	if s.TimerDispatcherLen == 0 {
 		panic("invalid TimerDispatcherLen")
@@ -83,6 +129,38 @@ func (s *Skeleton) CronFunc(cronExpr *timer.CronExpr, cb func()) *timer.Cron {
 	return s.dispatcher.CronFunc(cronExpr, cb)
 }
 
+func (s *Skeleton) AfterFuncJitter(d time.Duration, jitter time.Duration, cb func()) *timer.Timer {
+	if s.TimerDispatcherLen == 0 {
+		panic("invalid TimerDispatcherLen")
+	}
+
+	return s.dispatcher.AfterFuncJitter(d, jitter, cb)
+}
+
+func (s *Skeleton) CronFuncJitter(cronExpr *timer.CronExpr, jitter time.Duration, cb func()) *timer.Cron {
+	if s.TimerDispatcherLen == 0 {
+		panic("invalid TimerDispatcherLen")
+	}
+
+	return s.dispatcher.CronFuncJitter(cronExpr, jitter, cb)
+}
+
+func (s *Skeleton) WeeklyFunc(weekday time.Weekday, hour, min int, cb func()) *timer.Cron {
+	if s.TimerDispatcherLen == 0 {
+		panic("invalid TimerDispatcherLen")
+	}
+
+	return s.dispatcher.WeeklyFunc(weekday, hour, min, cb)
+}
+
+func (s *Skeleton) MonthlyFunc(day, hour, min int, cb func()) *timer.Cron {
+	if s.TimerDispatcherLen == 0 {
+		panic("invalid TimerDispatcherLen")
+	}
+
+	return s.dispatcher.MonthlyFunc(day, hour, min, cb)
+}
+
 func (s *Skeleton) Go(f func(), cb func()) {
 	if s.GoLen == 0 {
 		panic("invalid GoLen")
@@ -91,6 +169,14 @@ func (s *Skeleton) Go(f func(), cb func()) {
 	s.g.Go(f, cb)
 }
 
+func (s *Skeleton) GoAfter(d time.Duration, f func(), cb func()) *g.GoTimer {
+	if s.GoLen == 0 {
+		panic("invalid GoLen")
+	}
+
+	return s.g.GoAfter(d, f, cb)
+}
+
 func (s *Skeleton) NewLinearContext() *g.LinearContext {
 	if s.GoLen == 0 {
 		panic("invalid GoLen")
@@ -99,13 +185,13 @@ func (s *Skeleton) NewLinearContext() *g.LinearContext {
 	return s.g.NewLinearContext()
 }
 
-func (s *Skeleton) AsynCall(server *chanrpc.Server, id interface{}, args ...interface{}) {
+func (s *Skeleton) AsynCall(server *chanrpc.Server, id interface{}, args ...interface{}) error {
 	if s.AsynCallLen == 0 {
 		panic("invalid AsynCallLen")
 	}
 
 	s.client.Attach(server)
-	s.client.AsynCall(id, args...)
+	return s.client.AsynCall(id, args...)
 }
 
 func (s *Skeleton) RegisterChanRPC(id interface{}, f interface{}) {
@@ -116,6 +202,33 @@ func (s *Skeleton) RegisterChanRPC(id interface{}, f interface{}) {
 	s.server.Register(id, f)
 }
 
+// f is a func(args []string) string or, like a chanrpc function,
+// a func(args []interface{}) interface{} returning a string,
+// it is called on the goroutine of the skeleton
+// you must call the function before calling console.Init
 func (s *Skeleton) RegisterCommand(name string, help string, f interface{}) {
+	if handler, ok := f.(func(args []string) string); ok {
+		f = func(args []interface{}) interface{} {
+			strs := make([]string, len(args))
+			for i, arg := range args {
+				strs[i] = arg.(string)
+			}
+			return handler(strs)
+		}
+	}
 	console.Register(name, help, f, s.commandServer)
 }
+
+type reloadID struct{}
+
+// calls f on the goroutine of the skeleton
+func (s *Skeleton) exec(f func() error) error {
+	ret, err := s.commandServer.Call1(reloadID{}, f)
+	if err != nil {
+		return err
+	}
+	if ret != nil {
+		return ret.(error)
+	}
+	return nil
+}
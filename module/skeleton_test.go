@@ -0,0 +1,155 @@
+package module_test
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/name5566/leaf/chanrpc"
+	"github.com/name5566/leaf/conf"
+	"github.com/name5566/leaf/console"
+	"github.com/name5566/leaf/module"
+	"github.com/name5566/leaf/timer"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSkeleton() (*module.Skeleton, *timer.MockClock) {
+	clock := timer.NewMockClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := &module.Skeleton{
+		GoLen:              10,
+		TimerDispatcherLen: 10,
+		AsynCallLen:        10,
+		ChanRPCServer:      chanrpc.NewServer(10),
+		Clock:              clock,
+	}
+	s.Init()
+	return s, clock
+}
+
+func TestSkeleton_RunOnceTimer(t *testing.T) {
+	s, clock := newSkeleton()
+
+	fired := 0
+	s.AfterFunc(5*time.Second, func() {
+		fired++
+	})
+
+	clock.Advance(4 * time.Second)
+	if s.RunOnce() {
+		t.Fatal("timer fired early")
+	}
+	clock.Advance(time.Second)
+	if !s.RunOnce() || fired != 1 {
+		t.Fatalf("timer not fired: %v", fired)
+	}
+	if s.RunOnce() {
+		t.Fatal("unexpected item")
+	}
+
+	// cron reschedules on the mock clock
+	cronExpr, err := timer.NewCronExpr("*/10 * * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticks := 0
+	s.CronFunc(cronExpr, func() {
+		ticks++
+	})
+	for i := 0; i < 3; i++ {
+		clock.Advance(10 * time.Second)
+		for s.RunOnce() {
+		}
+	}
+	if ticks != 3 {
+		t.Fatalf("got %v ticks, want 3", ticks)
+	}
+}
+
+func TestSkeleton_RunOnceRPC(t *testing.T) {
+	s, _ := newSkeleton()
+	s.RegisterChanRPC("add", func(args []interface{}) interface{} {
+		return args[0].(int) + args[1].(int)
+	})
+
+	var sum interface{}
+	s.AsynCall(s.ChanRPCServer, "add", 1, 2, func(ret interface{}, err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum = ret
+	})
+
+	// the call, then its callback
+	if !s.RunOnce() || sum != nil {
+		t.Fatal("call not executed")
+	}
+	if !s.RunOnce() || sum != 3 {
+		t.Fatalf("callback not executed: %v", sum)
+	}
+	if s.RunOnce() {
+		t.Fatal("unexpected item")
+	}
+}
+
+func TestSkeleton_RegisterCommand(t *testing.T) {
+	s, _ := newSkeleton()
+	items := make(map[string]int)
+	s.RegisterChanRPC("give", func(args []interface{}) {
+		items[args[0].(string)]++
+	})
+	s.RegisterCommand("give-item", "give-item <item>", func(args []string) string {
+		if len(args) != 1 {
+			return "usage: give-item <item>"
+		}
+		// no lock, the map belongs to the skeleton goroutine
+		items[args[0]]++
+		return fmt.Sprintf("%v: %v", args[0], items[args[0]])
+	})
+
+	closeSig := make(chan bool)
+	done := make(chan struct{})
+	go func() {
+		s.Run(closeSig)
+		close(done)
+	}()
+	defer func() {
+		closeSig <- true
+		<-done
+	}()
+
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.ConsolePort = ln.Addr().(*net.TCPAddr).Port
+	conf.ConsolePrompt = ""
+	ln.Close()
+	console.Init()
+	defer console.Destroy()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	if err := s.ChanRPCServer.Call0("give", "sword"); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct{ cmd, want string }{
+		{"give-item sword", "sword: 2"},
+		{"give-item", "usage: give-item <item>"},
+	} {
+		fmt.Fprintf(conn, "%v\n", c.cmd)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimRight(line, "\r\n"); got != c.want {
+			t.Fatalf("%v: got %q, want %q", c.cmd, got, c.want)
+		}
+	}
+}
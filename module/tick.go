@@ -0,0 +1,126 @@
+package module
+
+import (
+	"context"
+	"github.com/name5566/leaf/log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fires the tick handlers of the modules in lockstep, a tick starts once
+// every handler of the previous one has returned or after Timeout
+// a handler still running when the timeout expires is logged as slow, the
+// next ticks go on without it and it misses the ticks fired until it
+// returns, 0 means waiting forever
+// goroutine safe
+type TickCoordinator struct {
+	Interval time.Duration
+	Timeout  time.Duration
+	mutex    sync.Mutex
+	handlers []*tickHandler
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	calls    sync.WaitGroup
+}
+
+type tickHandler struct {
+	name string
+	s    *Skeleton
+	f    func(tick uint64)
+	busy atomic.Bool
+}
+
+type tickID struct{}
+
+// f is called on the goroutine of s with the number of the tick, from 1
+// you must call the function after calling s.Init
+func (c *TickCoordinator) Register(name string, s *Skeleton, f func(tick uint64)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.handlers = append(c.handlers, &tickHandler{name: name, s: s, f: f})
+}
+
+func (c *TickCoordinator) Start() {
+	if c.Interval <= 0 {
+		c.Interval = 100 * time.Millisecond
+		log.Release("invalid Interval, reset to %v", c.Interval)
+	}
+
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.done = make(chan struct{})
+	go c.run()
+}
+
+func (c *TickCoordinator) run() {
+	defer close(c.done)
+
+	t := time.NewTimer(c.Interval)
+	defer t.Stop()
+	for tick := uint64(1); ; tick++ {
+		select {
+		case <-t.C:
+		case <-c.ctx.Done():
+			return
+		}
+		start := time.Now()
+		c.tick(tick)
+		t.Reset(c.Interval - time.Since(start))
+	}
+}
+
+func (c *TickCoordinator) tick(tick uint64) {
+	c.mutex.Lock()
+	handlers := c.handlers
+	c.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, h := range handlers {
+		if !h.busy.CompareAndSwap(false, true) {
+			continue
+		}
+		wg.Add(1)
+		c.calls.Add(1)
+		h := h
+		// gives up on Close, the module may be closing or never take it
+		go func() {
+			defer c.calls.Done()
+			defer wg.Done()
+			defer h.busy.Store(false)
+			h.s.commandServer.Call0Ctx(c.ctx, tickID{}, func() {
+				h.f(tick)
+			})
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	var timeout <-chan time.Time
+	if c.Timeout > 0 {
+		t := time.NewTimer(c.Timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case <-done:
+	case <-timeout:
+		for _, h := range handlers {
+			if h.busy.Load() {
+				log.Release("tick %v: module %v slow", tick, h.name)
+			}
+		}
+	case <-c.ctx.Done():
+	}
+}
+
+// no tick is fired after Close returns, the ticks not taken yet by their
+// module are given up and the handlers still running are not waited for
+func (c *TickCoordinator) Close() {
+	c.cancel()
+	<-c.done
+	c.calls.Wait()
+}
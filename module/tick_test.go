@@ -0,0 +1,146 @@
+package module_test
+
+import (
+	"fmt"
+	"github.com/name5566/leaf/module"
+	"sync"
+	"testing"
+	"time"
+)
+
+func runSkeleton(t *testing.T) *module.Skeleton {
+	s, _ := newSkeleton()
+	closeSig := make(chan bool)
+	done := make(chan struct{})
+	go func() {
+		s.Run(closeSig)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		closeSig <- true
+		<-done
+	})
+	return s
+}
+
+func TestTickCoordinator(t *testing.T) {
+	var mutex sync.Mutex
+	completed := make(map[string]uint64)
+	errs := make(chan string, 100)
+
+	c := &module.TickCoordinator{Interval: time.Millisecond, Timeout: time.Second}
+	ticks := make(chan uint64, 100)
+	for _, name := range []string{"game", "battle"} {
+		name := name
+		c.Register(name, runSkeleton(t), func(tick uint64) {
+			mutex.Lock()
+			for m, n := range completed {
+				// done with this tick already, or with the previous one
+				if n != tick && n != tick-1 {
+					errs <- fmt.Sprintf("tick %v started, %v at %v", tick, m, n)
+				}
+			}
+			mutex.Unlock()
+
+			if name == "battle" {
+				time.Sleep(5 * time.Millisecond)
+			} else {
+				ticks <- tick
+			}
+
+			mutex.Lock()
+			completed[name] = tick
+			mutex.Unlock()
+		})
+	}
+	c.Start()
+	for tick := range ticks {
+		if tick == 5 {
+			break
+		}
+	}
+	c.Close()
+
+	select {
+	case err := <-errs:
+		t.Fatalf("modules not in lockstep: %v", err)
+	default:
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if completed["battle"] < 4 {
+		t.Fatalf("battle completed %v ticks, want 4 at least", completed["battle"])
+	}
+}
+
+func TestTickCoordinator_Timeout(t *testing.T) {
+	c := &module.TickCoordinator{Interval: time.Millisecond, Timeout: 20 * time.Millisecond}
+	var mutex sync.Mutex
+	var slowTicks []uint64
+	fast := make(chan uint64, 100)
+	c.Register("slow", runSkeleton(t), func(tick uint64) {
+		mutex.Lock()
+		slowTicks = append(slowTicks, tick)
+		mutex.Unlock()
+		time.Sleep(100 * time.Millisecond)
+	})
+	c.Register("fast", runSkeleton(t), func(tick uint64) {
+		fast <- tick
+	})
+	c.Start()
+
+	start := time.Now()
+	for tick := range fast {
+		if tick == 4 {
+			break
+		}
+	}
+	c.Close()
+	if d := time.Since(start); d > 90*time.Millisecond {
+		t.Fatalf("4 ticks took %v, waiting for the slow module", d)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(slowTicks) != 1 || slowTicks[0] != 1 {
+		t.Fatalf("slow module got ticks %v, want the first only", slowTicks)
+	}
+}
+
+func TestTickCoordinator_CloseNotRunning(t *testing.T) {
+	c := &module.TickCoordinator{Interval: time.Millisecond}
+	s, _ := newSkeleton()
+	called := make(chan uint64, 1)
+	c.Register("stopped", s, func(tick uint64) {
+		called <- tick
+	})
+	c.Start()
+	time.Sleep(10 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked on a module not running")
+	}
+
+	// the tick pending is given up
+	closeSig := make(chan bool)
+	done := make(chan struct{})
+	go func() {
+		s.Run(closeSig)
+		close(done)
+	}()
+	defer func() {
+		closeSig <- true
+		<-done
+	}()
+	select {
+	case tick := <-called:
+		t.Fatalf("tick %v run after Close", tick)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -6,6 +6,8 @@ import (
 
 type Conn interface {
 	ReadMsg() ([]byte, error)
+	// goroutine safe, the messages are queued whole in the order of the
+	// calls and written by the goroutine of the connection
 	WriteMsg(args ...[]byte) error
 	LocalAddr() net.Addr
 	RemoteAddr() net.Addr
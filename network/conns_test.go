@@ -0,0 +1,75 @@
+package network_test
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/name5566/leaf/network"
+	"net"
+	"testing"
+	"time"
+)
+
+func waitConns(t *testing.T, n int, conns func() int) {
+	for i := 0; i < 100; i++ {
+		if conns() == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%v connections, want %v", conns(), n)
+}
+
+func TestTCPServer_Conns(t *testing.T) {
+	server := new(network.TCPServer)
+	server.Addr = freeAddr(t)
+	server.NewAgent = func(conn *network.TCPConn) network.Agent {
+		return &echoAgent{conn}
+	}
+	server.Start()
+	defer server.Close()
+
+	var clients []net.Conn
+	for i := 0; i < 3; i++ {
+		c, err := net.Dial("tcp", server.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		clients = append(clients, c)
+	}
+	count := func() int { return len(server.Conns()) }
+	waitConns(t, 3, count)
+
+	clients[0].Close()
+	waitConns(t, 2, count)
+
+	// kick all
+	for _, conn := range server.Conns() {
+		conn.Close()
+	}
+	waitConns(t, 0, count)
+}
+
+func TestWSServer_Conns(t *testing.T) {
+	server := new(network.WSServer)
+	server.Addr = freeAddr(t)
+	server.NewAgent = func(conn *network.WSConn) network.Agent {
+		return &echoAgent{conn}
+	}
+	server.Start()
+	defer server.Close()
+
+	var clients []*websocket.Conn
+	for i := 0; i < 3; i++ {
+		c, _, err := websocket.DefaultDialer.Dial("ws://"+server.Addr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		clients = append(clients, c)
+	}
+	count := func() int { return len(server.Conns()) }
+	waitConns(t, 3, count)
+
+	clients[0].Close()
+	waitConns(t, 2, count)
+}
@@ -0,0 +1,40 @@
+package network
+
+import (
+	"time"
+)
+
+type FrameDirection int
+
+const (
+	FrameIn FrameDirection = iota
+	FrameOut
+)
+
+func (d FrameDirection) String() string {
+	switch d {
+	case FrameIn:
+		return "in"
+	case FrameOut:
+		return "out"
+	}
+	return "unknown"
+}
+
+// data is a copy of the message and can be retained
+// must be goroutine safe
+type FrameLogger func(dir FrameDirection, t time.Time, data []byte)
+
+func logFrame(logger FrameLogger, dir FrameDirection, args ...[]byte) {
+	var l int
+	for i := 0; i < len(args); i++ {
+		l += len(args[i])
+	}
+
+	data := make([]byte, 0, l)
+	for i := 0; i < len(args); i++ {
+		data = append(data, args[i]...)
+	}
+
+	logger(dir, time.Now(), data)
+}
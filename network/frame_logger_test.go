@@ -0,0 +1,193 @@
+package network_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/gorilla/websocket"
+	"github.com/name5566/leaf/network"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type echoAgent struct {
+	conn network.Conn
+}
+
+func (a *echoAgent) Run() {
+	for {
+		data, err := a.conn.ReadMsg()
+		if err != nil {
+			return
+		}
+		a.conn.WriteMsg([]byte("re:"), data)
+	}
+}
+
+func (a *echoAgent) OnClose() {}
+
+type frame struct {
+	dir  network.FrameDirection
+	data []byte
+}
+
+type frameRecorder struct {
+	sync.Mutex
+	frames []frame
+}
+
+func (r *frameRecorder) log(dir network.FrameDirection, t time.Time, data []byte) {
+	r.Lock()
+	defer r.Unlock()
+	r.frames = append(r.frames, frame{dir, data})
+}
+
+func (r *frameRecorder) get() []frame {
+	r.Lock()
+	defer r.Unlock()
+	return append([]frame(nil), r.frames...)
+}
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestTCPConn_FrameLogger(t *testing.T) {
+	recorder := new(frameRecorder)
+
+	server := new(network.TCPServer)
+	server.Addr = freeAddr(t)
+	server.FrameLogger = recorder.log
+	server.NewAgent = func(conn *network.TCPConn) network.Agent {
+		return &echoAgent{conn}
+	}
+	server.Start()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	msg := []byte("hello")
+	b := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(b, uint16(len(msg)))
+	copy(b[2:], msg)
+	if _, err := conn.Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := make([]byte, 2+len("re:hello"))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatal(err)
+	}
+
+	frames := recorder.get()
+	if len(frames) != 2 {
+		t.Fatalf("unexpected frames: %v", frames)
+	}
+	if frames[0].dir != network.FrameIn || !bytes.Equal(frames[0].data, msg) {
+		t.Errorf("unexpected inbound frame: %v %q", frames[0].dir, frames[0].data)
+	}
+	if frames[1].dir != network.FrameOut || !bytes.Equal(frames[1].data, reply[2:]) {
+		t.Errorf("unexpected outbound frame: %v %q", frames[1].dir, frames[1].data)
+	}
+}
+
+func TestWSConn_FrameLogger(t *testing.T) {
+	recorder := new(frameRecorder)
+
+	server := new(network.WSServer)
+	server.Addr = freeAddr(t)
+	server.FrameLogger = recorder.log
+	server.NewAgent = func(conn *network.WSConn) network.Agent {
+		return &echoAgent{conn}
+	}
+	server.Start()
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+server.Addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, reply, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := recorder.get()
+	if len(frames) != 2 {
+		t.Fatalf("unexpected frames: %v", frames)
+	}
+	if frames[0].dir != network.FrameIn || string(frames[0].data) != "hello" {
+		t.Errorf("unexpected inbound frame: %v %q", frames[0].dir, frames[0].data)
+	}
+	if frames[1].dir != network.FrameOut || !bytes.Equal(frames[1].data, reply) {
+		t.Errorf("unexpected outbound frame: %v %q", frames[1].dir, frames[1].data)
+	}
+}
+
+func TestTCPServer_ReadBufferSize(t *testing.T) {
+	server := new(network.TCPServer)
+	server.Addr = freeAddr(t)
+	server.ReadBufferSize = 64
+	server.NewAgent = func(conn *network.TCPConn) network.Agent {
+		return &echoAgent{conn}
+	}
+	server.Start()
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for c := 0; c < 8; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+
+			conn, err := net.Dial("tcp", server.Addr)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+
+			for i := 0; i < 100; i++ {
+				// some messages exceed the read buffer
+				msg := bytes.Repeat([]byte{byte('a' + c)}, 1+(i*7)%100)
+				b := make([]byte, 2+len(msg))
+				binary.BigEndian.PutUint16(b, uint16(len(msg)))
+				copy(b[2:], msg)
+				if _, err := conn.Write(b); err != nil {
+					t.Error(err)
+					return
+				}
+
+				reply := make([]byte, 2+3+len(msg))
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				if _, err := io.ReadFull(conn, reply); err != nil {
+					t.Error(err)
+					return
+				}
+				if !bytes.Equal(reply[5:], msg) {
+					t.Errorf("conn %v message %v corrupted: %q", c, i, reply[5:])
+					return
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+}
@@ -10,7 +10,8 @@ import (
 )
 
 type Processor struct {
-	msgInfo map[string]*MsgInfo
+	msgInfo           map[string]*MsgInfo
+	unknownMsgHandler func(id interface{}, raw []byte)
 }
 
 type MsgInfo struct {
@@ -27,6 +28,11 @@ type MsgRaw struct {
 	msgRawData json.RawMessage
 }
 
+type MsgUnknown struct {
+	msgID      string
+	msgRawData json.RawMessage
+}
+
 func NewProcessor() *Processor {
 	p := new(Processor)
 	p.msgInfo = make(map[string]*MsgInfo)
@@ -93,6 +99,13 @@ func (p *Processor) SetRawHandler(msgID string, msgRawHandler MsgHandler) {
 	i.msgRawHandler = msgRawHandler
 }
 
+// messages not registered are passed to f when routed instead of
+// failing to unmarshal, f is called with the message id and json data
+// It's dangerous to call the method on routing or marshaling (unmarshaling)
+func (p *Processor) SetUnknownMsgHandler(f func(id interface{}, raw []byte)) {
+	p.unknownMsgHandler = f
+}
+
 // goroutine safe
 func (p *Processor) Route(msg interface{}, userData interface{}) error {
 	// raw
@@ -107,6 +120,12 @@ func (p *Processor) Route(msg interface{}, userData interface{}) error {
 		return nil
 	}
 
+	// unknown
+	if msgUnknown, ok := msg.(MsgUnknown); ok {
+		p.unknownMsgHandler(msgUnknown.msgID, msgUnknown.msgRawData)
+		return nil
+	}
+
 	// json
 	msgType := reflect.TypeOf(msg)
 	if msgType == nil || msgType.Kind() != reflect.Ptr {
@@ -121,7 +140,7 @@ func (p *Processor) Route(msg interface{}, userData interface{}) error {
 		i.msgHandler([]interface{}{msg, userData})
 	}
 	if i.msgRouter != nil {
-		i.msgRouter.Go(msgType, msg, userData)
+		i.msgRouter.GoFrom(userData, msgType, msg, userData)
 	}
 	return nil
 }
@@ -140,6 +159,9 @@ func (p *Processor) Unmarshal(data []byte) (interface{}, error) {
 	for msgID, data := range m {
 		i, ok := p.msgInfo[msgID]
 		if !ok {
+			if p.unknownMsgHandler != nil {
+				return MsgUnknown{msgID, data}, nil
+			}
 			return nil, fmt.Errorf("message %v not registered", msgID)
 		}
 
@@ -0,0 +1,45 @@
+package json_test
+
+import (
+	"github.com/name5566/leaf/network/json"
+	"testing"
+)
+
+type Hello struct {
+	Name string
+}
+
+func TestProcessor_UnknownMsg(t *testing.T) {
+	p := json.NewProcessor()
+	p.Register(&Hello{})
+
+	data := []byte(`{"Bye": {"Name": "leaf"}}`)
+	if _, err := p.Unmarshal(data); err == nil {
+		t.Fatal("unknown message accepted")
+	}
+
+	var id interface{}
+	var raw []byte
+	p.SetUnknownMsgHandler(func(_id interface{}, _raw []byte) {
+		id, raw = _id, _raw
+	})
+	msg, err := p.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Route(msg, nil); err != nil {
+		t.Fatal(err)
+	}
+	if id != "Bye" || string(raw) != `{"Name": "leaf"}` {
+		t.Fatalf("unexpected unknown message %v %s", id, raw)
+	}
+
+	// registered messages are not affected
+	msg, err = p.Unmarshal([]byte(`{"Hello": {"Name": "leaf"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hello, ok := msg.(*Hello); !ok || hello.Name != "leaf" {
+		t.Fatalf("unexpected message %#v", msg)
+	}
+}
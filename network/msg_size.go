@@ -0,0 +1,55 @@
+package network
+
+import (
+	"sync/atomic"
+)
+
+// the upper bounds in bytes of the buckets of MsgSizeStats
+var MsgSizeBounds = [...]int{64, 256, 1024, 4096, 16384, 65536}
+
+// In[i] and Out[i] count the messages of at most MsgSizeBounds[i] bytes
+// and larger than the previous bound, the last counts the larger ones
+type MsgSizeStats struct {
+	In  [len(MsgSizeBounds) + 1]uint64
+	Out [len(MsgSizeBounds) + 1]uint64
+}
+
+// goroutine safe
+type msgSizes struct {
+	in  [len(MsgSizeBounds) + 1]atomic.Uint64
+	out [len(MsgSizeBounds) + 1]atomic.Uint64
+}
+
+func msgSizeBucket(n int) int {
+	for i, bound := range MsgSizeBounds {
+		if n <= bound {
+			return i
+		}
+	}
+	return len(MsgSizeBounds)
+}
+
+func (s *msgSizes) record(dir FrameDirection, args ...[]byte) {
+	if s == nil {
+		return
+	}
+
+	var n int
+	for _, arg := range args {
+		n += len(arg)
+	}
+	if dir == FrameIn {
+		s.in[msgSizeBucket(n)].Add(1)
+	} else {
+		s.out[msgSizeBucket(n)].Add(1)
+	}
+}
+
+func (s *msgSizes) stats() MsgSizeStats {
+	var stats MsgSizeStats
+	for i := range stats.In {
+		stats.In[i] = s.in[i].Load()
+		stats.Out[i] = s.out[i].Load()
+	}
+	return stats
+}
@@ -0,0 +1,51 @@
+package network_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/name5566/leaf/network"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTCPServer_MsgSizeStats(t *testing.T) {
+	server := new(network.TCPServer)
+	server.Addr = freeAddr(t)
+	server.MaxMsgLen = 8192
+	server.NewAgent = func(conn *network.TCPConn) network.Agent {
+		return &echoAgent{conn}
+	}
+	server.Start()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, n := range []int{10, 64, 65, 1000, 5000} {
+		b := make([]byte, 2+n)
+		binary.BigEndian.PutUint16(b, uint16(n))
+		copy(b[2:], bytes.Repeat([]byte("x"), n))
+		if _, err := conn.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		// "re:" is prepended
+		reply := make([]byte, 2+3+n)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := server.MsgSizeStats()
+	if want := [...]uint64{2, 1, 1, 0, 1, 0, 0}; stats.In != want {
+		t.Fatalf("got inbound %v, want %v", stats.In, want)
+	}
+	if want := [...]uint64{1, 2, 1, 0, 1, 0, 0}; stats.Out != want {
+		t.Fatalf("got outbound %v, want %v", stats.Out, want)
+	}
+}
@@ -0,0 +1,95 @@
+package network_test
+
+import (
+	"github.com/name5566/leaf/network"
+	"net"
+	"testing"
+	"time"
+)
+
+func freeAddrOn(t *testing.T, nw string, host string) string {
+	ln, err := net.Listen(nw, net.JoinHostPort(host, "0"))
+	if err != nil {
+		t.Skipf("%v not available: %v", nw, err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func canDial(nw string, addr string) bool {
+	conn, err := net.DialTimeout(nw, addr, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func startTCPServer(t *testing.T, nw string, addr string) {
+	server := new(network.TCPServer)
+	server.Network = nw
+	server.Addr = addr
+	server.NewAgent = func(conn *network.TCPConn) network.Agent {
+		return &echoAgent{conn}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+}
+
+func TestTCPServer_Network(t *testing.T) {
+	t.Run("tcp4", func(t *testing.T) {
+		addr := freeAddrOn(t, "tcp4", "127.0.0.1")
+		startTCPServer(t, "tcp4", addr)
+		if !canDial("tcp4", addr) {
+			t.Fatal("IPv4 connection refused")
+		}
+	})
+
+	t.Run("tcp6", func(t *testing.T) {
+		addr := freeAddrOn(t, "tcp6", "::1")
+		startTCPServer(t, "tcp6", addr)
+		if !canDial("tcp6", addr) {
+			t.Fatal("IPv6 connection refused")
+		}
+	})
+
+	t.Run("tcp6 only", func(t *testing.T) {
+		addr := freeAddrOn(t, "tcp6", "::")
+		_, port, _ := net.SplitHostPort(addr)
+		startTCPServer(t, "tcp6", addr)
+		if !canDial("tcp6", net.JoinHostPort("::1", port)) {
+			t.Fatal("IPv6 connection refused")
+		}
+		if canDial("tcp4", net.JoinHostPort("127.0.0.1", port)) {
+			t.Fatal("IPv4 connection accepted")
+		}
+	})
+
+	t.Run("dual-stack", func(t *testing.T) {
+		addr := freeAddrOn(t, "tcp6", "::")
+		_, port, _ := net.SplitHostPort(addr)
+		startTCPServer(t, "", addr)
+		if !canDial("tcp4", net.JoinHostPort("127.0.0.1", port)) {
+			t.Fatal("IPv4 connection refused")
+		}
+		if !canDial("tcp6", net.JoinHostPort("::1", port)) {
+			t.Fatal("IPv6 connection refused")
+		}
+	})
+}
+
+func TestWSServer_Network(t *testing.T) {
+	addr := freeAddrOn(t, "tcp6", "::1")
+	server := new(network.WSServer)
+	server.Network = "tcp6"
+	server.Addr = addr
+	server.NewAgent = func(conn *network.WSConn) network.Agent {
+		return &echoAgent{conn}
+	}
+	server.Start()
+	defer server.Close()
+
+	if !canDial("tcp6", addr) {
+		t.Fatal("IPv6 connection refused")
+	}
+}
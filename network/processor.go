@@ -1,10 +1,10 @@
 package network
 
 type Processor interface {
-	// must goroutine safe
+	// must be goroutine safe
 	Route(msg interface{}, userData interface{}) error
-	// must goroutine safe
+	// must be goroutine safe
 	Unmarshal(data []byte) (interface{}, error)
-	// must goroutine safe
+	// must be goroutine safe
 	Marshal(msg interface{}) ([][]byte, error)
 }
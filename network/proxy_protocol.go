@@ -0,0 +1,211 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a load balancer completing no PROXY header within the timeout is closed
+const proxyHeaderTimeout = 10 * time.Second
+
+var (
+	// v1 is text, at most 107 bytes with the CRLF
+	proxyV1Prefix = []byte("PROXY ")
+	proxyV1MaxLen = 107
+	proxyV2Sig    = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+var errNoProxyHeader = errors.New("no PROXY header")
+
+// a connection starting with a PROXY protocol header, the address of the
+// client declared by the header is its RemoteAddr
+type proxyConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+}
+
+func newProxyConn(conn net.Conn) *proxyConn {
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// the header must be read before the connection is, the connections
+// declared LOCAL or UNKNOWN (health checks) keep the address of the socket
+func (pc *proxyConn) readHeader() error {
+	pc.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	defer pc.Conn.SetReadDeadline(time.Time{})
+
+	addr, err := readProxyHeader(pc.reader)
+	if err != nil {
+		return err
+	}
+	pc.remoteAddr = addr
+	return nil
+}
+
+func (pc *proxyConn) Read(b []byte) (int, error) {
+	return pc.reader.Read(b)
+}
+
+func (pc *proxyConn) RemoteAddr() net.Addr {
+	if pc.remoteAddr != nil {
+		return pc.remoteAddr
+	}
+	return pc.Conn.RemoteAddr()
+}
+
+func (pc *proxyConn) CloseWrite() error {
+	hc, ok := pc.Conn.(halfCloser)
+	if !ok {
+		return errors.New("half-close not supported")
+	}
+	return hc.CloseWrite()
+}
+
+func (pc *proxyConn) NetConn() net.Conn {
+	return pc.Conn
+}
+
+// the source address of a v1 or v2 header, nil when there is none
+// the v1 prefix is peeked first, so no more bytes than a v1 header are waited for
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	b, err := r.Peek(len(proxyV1Prefix))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(b, proxyV1Prefix) {
+		return readProxyV1(r)
+	}
+
+	b, err = r.Peek(len(proxyV2Sig))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(b, proxyV2Sig) {
+		return nil, errNoProxyHeader
+	}
+	return readProxyV2(r)
+}
+
+// PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyV1MaxLen {
+			return nil, errors.New("PROXY v1 header too long")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("PROXY v1 header not ended by CRLF")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("invalid PROXY v1 header %q", line)
+	}
+	var v6 bool
+	switch fields[1] {
+	case "TCP4":
+	case "TCP6":
+		v6 = true
+	default:
+		return nil, fmt.Errorf("invalid PROXY v1 protocol %v", fields[1])
+	}
+	// both addresses of the family of the protocol
+	ip := parseProxyV1IP(fields[2], v6)
+	if ip == nil || parseProxyV1IP(fields[3], v6) == nil {
+		return nil, fmt.Errorf("invalid PROXY v1 address %q", line)
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY v1 port %v", fields[4])
+	}
+	if _, err := strconv.ParseUint(fields[5], 10, 16); err != nil {
+		return nil, fmt.Errorf("invalid PROXY v1 port %v", fields[5])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// an IPv6 address is written with colons, an IPv4 one without
+func parseProxyV1IP(s string, v6 bool) net.IP {
+	if strings.Contains(s, ":") != v6 {
+		return nil
+	}
+	return net.ParseIP(s)
+}
+
+// signature, version and command, family and protocol, length, addresses
+// then TLVs (ignored)
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, len(proxyV2Sig)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	verCmd, fam := header[12], header[13]
+	body := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("invalid PROXY v2 version %v", verCmd>>4)
+	}
+	switch verCmd & 0xf {
+	case 0:
+		// LOCAL
+		return nil, nil
+	case 1:
+		// PROXY
+	default:
+		return nil, fmt.Errorf("invalid PROXY v2 command %v", verCmd&0xf)
+	}
+
+	var ipLen int
+	switch fam >> 4 {
+	case 1:
+		ipLen = net.IPv4len
+	case 2:
+		ipLen = net.IPv6len
+	default:
+		// AF_UNSPEC or AF_UNIX
+		return nil, nil
+	}
+	if len(body) < 2*ipLen+4 {
+		return nil, fmt.Errorf("PROXY v2 addresses too short: %v bytes", len(body))
+	}
+	ip := make(net.IP, ipLen)
+	copy(ip, body)
+	port := binary.BigEndian.Uint16(body[2*ipLen:])
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+type proxyListener struct {
+	net.Listener
+}
+
+func (ln proxyListener) Accept() (net.Conn, error) {
+	conn, err := ln.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return newProxyConn(conn), nil
+}
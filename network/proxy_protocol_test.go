@@ -0,0 +1,122 @@
+package network_test
+
+import (
+	"encoding/binary"
+	"github.com/name5566/leaf/network"
+	"net"
+	"testing"
+	"time"
+)
+
+func proxyV2Header(ip net.IP, port uint16) []byte {
+	b := []byte("\r\n\r\n\x00\r\nQUIT\n")
+	fam := byte(0x11)
+	if ip.To4() == nil {
+		fam = 0x21
+	} else {
+		ip = ip.To4()
+	}
+	body := append(append([]byte(nil), ip...), make(net.IP, len(ip))...)
+	body = binary.BigEndian.AppendUint16(body, port)
+	body = binary.BigEndian.AppendUint16(body, 443)
+	// a TLV, ignored
+	body = append(body, 0x04, 0, 1, 0)
+	b = append(b, 0x21, fam)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(body)))
+	return append(b, body...)
+}
+
+func TestTCPServer_ProxyProtocol(t *testing.T) {
+	addrs := make(chan net.Addr, 1)
+	server := new(network.TCPServer)
+	server.Addr = freeAddr(t)
+	server.LenMsgLen = 2
+	server.ProxyProtocol = true
+	server.NewAgent = func(conn *network.TCPConn) network.Agent {
+		addrs <- conn.RemoteAddr()
+		return &echoAgent{conn: conn}
+	}
+	server.Start()
+	defer server.Close()
+
+	echo := func(header []byte) (net.Addr, error) {
+		conn, err := net.Dial("tcp", server.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(time.Second))
+		// the message in the same segment as the header
+		if _, err := conn.Write(append(header, 0, 2, 'h', 'i')); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 7)
+		if _, err := conn.Read(buf); err != nil {
+			return nil, err
+		}
+		if string(buf[2:]) != "re:hi" {
+			t.Fatalf("got %q", buf)
+		}
+		return <-addrs, nil
+	}
+
+	cases := []struct {
+		header []byte
+		addr   string
+	}{
+		{[]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"), "192.0.2.1:56324"},
+		{[]byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"), "[2001:db8::1]:56324"},
+		{proxyV2Header(net.ParseIP("203.0.113.7"), 40000), "203.0.113.7:40000"},
+		{proxyV2Header(net.ParseIP("2001:db8::7"), 40000), "[2001:db8::7]:40000"},
+	}
+	for _, c := range cases {
+		addr, err := echo(c.header)
+		if err != nil {
+			t.Fatalf("%q: %v", c.header, err)
+		}
+		if addr.String() != c.addr {
+			t.Fatalf("%q: got %v, want %v", c.header, addr, c.addr)
+		}
+	}
+
+	// a health check of the load balancer
+	addr, err := echo([]byte("PROXY UNKNOWN\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host, _, _ := net.SplitHostPort(addr.String()); host != "127.0.0.1" {
+		t.Fatalf("got %v, want the address of the socket", addr)
+	}
+
+	// the header alone, no data after it
+	conn, err := net.Dial("tcp", server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("PROXY UNKNOWN\r\n"))
+	select {
+	case <-addrs:
+	case <-time.After(time.Second):
+		t.Fatal("PROXY UNKNOWN header not read")
+	}
+	conn.Close()
+
+	for _, header := range []string{
+		"GET / HTTP/1.1\r\n\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n",
+		"PROXY TCP4 2001:db8::1 198.51.100.1 56324 443\r\n",
+		"PROXY TCP4 192.0.2.1 2001:db8::2 56324 443\r\n",
+		"PROXY TCP6 192.0.2.1 2001:db8::2 56324 443\r\n",
+		"PROXY TCP6 2001:db8::1 198.51.100.1 56324 443\r\n",
+		"PROXY TCP6 ::ffff:192.0.2.1 198.51.100.1 56324 443\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.1 70000 443\r\n",
+		"\r\n\r\n\x00\r\nQUIT\n\x11\x11\x00\x00",
+	} {
+		if _, err := echo([]byte(header)); err == nil {
+			t.Fatalf("%q accepted", header)
+		}
+	}
+	if len(addrs) != 0 {
+		t.Fatal("agent created for a malformed header")
+	}
+}
@@ -0,0 +1,44 @@
+package network
+
+import (
+	"time"
+)
+
+// token bucket over the bytes read, one second of rate can be read at once
+// goroutine not safe, the connection is read by one goroutine
+type readLimiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newReadLimiter(bytesPerSec int) *readLimiter {
+	l := new(readLimiter)
+	l.rate = float64(bytesPerSec)
+	l.tokens = l.rate
+	l.last = time.Now()
+	return l
+}
+
+// the size of the next read
+func (l *readLimiter) limit(n int) int {
+	if max := int(l.rate); n > max {
+		return max
+	}
+	return n
+}
+
+// waits until the n bytes read fit in the rate
+func (l *readLimiter) wait(n int) {
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens < 0 {
+		time.Sleep(time.Duration(-l.tokens / l.rate * float64(time.Second)))
+	}
+}
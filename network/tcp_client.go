@@ -15,16 +15,30 @@ type TCPClient struct {
 	PendingWriteNum int
 	AutoReconnect   bool
 	NewAgent        func(*TCPConn) Agent
-	conns           ConnSet
-	wg              sync.WaitGroup
-	closeFlag       bool
+	FrameLogger     FrameLogger
+	// bounds each connection attempt, 0 means the timeout of the system
+	ConnectTimeout time.Duration
+	// the source address of the connections, e.g. "10.0.0.2:0" on a
+	// multi-homed host, empty means chosen by the system
+	LocalAddr string
+	dialer    net.Dialer
+	conns     ConnSet
+	wg        sync.WaitGroup
+	closeFlag bool
 
 	// msg parser
 	LenMsgLen    int
 	MinMsgLen    uint32
 	MaxMsgLen    uint32
 	LittleEndian bool
-	msgParser    *MsgParser
+	// see MsgParser.SetBatch
+	Batch bool
+	// see MsgParser.SetDelimiter
+	Delimited bool
+	Delimiter byte
+	// see MsgParser.SetSkipTooLong
+	SkipMsgTooLong bool
+	msgParser      *MsgParser
 }
 
 func (client *TCPClient) Start() {
@@ -59,6 +73,15 @@ func (client *TCPClient) init() {
 		log.Fatal("client is running")
 	}
 
+	client.dialer = net.Dialer{Timeout: client.ConnectTimeout}
+	if client.LocalAddr != "" {
+		addr, err := net.ResolveTCPAddr("tcp", client.LocalAddr)
+		if err != nil {
+			log.Fatal("%v", err)
+		}
+		client.dialer.LocalAddr = addr
+	}
+
 	client.conns = make(ConnSet)
 	client.closeFlag = false
 
@@ -66,12 +89,15 @@ func (client *TCPClient) init() {
 	msgParser := NewMsgParser()
 	msgParser.SetMsgLen(client.LenMsgLen, client.MinMsgLen, client.MaxMsgLen)
 	msgParser.SetByteOrder(client.LittleEndian)
+	msgParser.SetBatch(client.Batch)
+	msgParser.SetDelimiter(client.Delimited, client.Delimiter)
+	msgParser.SetSkipTooLong(client.SkipMsgTooLong)
 	client.msgParser = msgParser
 }
 
 func (client *TCPClient) dial() net.Conn {
 	for {
-		conn, err := net.Dial("tcp", client.Addr)
+		conn, err := client.dialer.Dial("tcp", client.Addr)
 		if err == nil || client.closeFlag {
 			return conn
 		}
@@ -101,6 +127,7 @@ reconnect:
 	client.Unlock()
 
 	tcpConn := newTCPConn(conn, client.PendingWriteNum, client.msgParser)
+	tcpConn.frameLogger = client.FrameLogger
 	agent := client.NewAgent(tcpConn)
 	agent.Run()
 
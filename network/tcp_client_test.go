@@ -0,0 +1,76 @@
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+type nopAgent struct{}
+
+func (nopAgent) Run()     {}
+func (nopAgent) OnClose() {}
+
+func TestTCPClient_ConnectTimeout(t *testing.T) {
+	client := &TCPClient{
+		// TEST-NET-1, never routed
+		Addr:           "192.0.2.1:3563",
+		ConnectTimeout: 100 * time.Millisecond,
+		NewAgent: func(*TCPConn) Agent {
+			return nopAgent{}
+		},
+	}
+	client.init()
+
+	start := time.Now()
+	if conn, err := client.dialer.Dial("tcp", client.Addr); err == nil {
+		conn.Close()
+		t.Skip("192.0.2.1 reachable")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("connection attempt failed after %v", d)
+	}
+}
+
+func TestTCPClient_LocalAddr(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if ln2, err := net.Listen("tcp", "127.0.0.2:0"); err != nil {
+		t.Skipf("127.0.0.2 not available: %v", err)
+	} else {
+		ln2.Close()
+	}
+
+	connected := make(chan net.Addr, 1)
+	client := &TCPClient{
+		Addr:           ln.Addr().String(),
+		ConnectTimeout: time.Second,
+		LocalAddr:      "127.0.0.2:0",
+		NewAgent: func(conn *TCPConn) Agent {
+			connected <- conn.LocalAddr()
+			return nopAgent{}
+		},
+	}
+	client.Start()
+	defer client.Close()
+
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	if ip := server.RemoteAddr().(*net.TCPAddr).IP.String(); ip != "127.0.0.2" {
+		t.Fatalf("connected from %v, want 127.0.0.2", ip)
+	}
+	select {
+	case addr := <-connected:
+		if addr.(*net.TCPAddr).IP.String() != "127.0.0.2" {
+			t.Fatalf("got local address %v", addr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("NewAgent not called")
+	}
+}
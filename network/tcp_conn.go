@@ -1,54 +1,168 @@
 package network
 
 import (
+	"bufio"
+	"crypto/tls"
+	"errors"
 	"github.com/name5566/leaf/log"
+	"io"
 	"net"
 	"sync"
+	"syscall"
+	"time"
 )
 
 type ConnSet map[net.Conn]struct{}
 
+// the writer takes a low priority message after so many high priority ones
+const maxHighPriorityBurst = 16
+
+// the high priority messages take a quarter of the pending writes at most
+func highPendingWriteNum(pendingWriteNum int) int {
+	if n := pendingWriteNum / 4; n > 0 {
+		return n
+	}
+	return 1
+}
+
 type TCPConn struct {
 	sync.Mutex
-	conn      net.Conn
-	writeChan chan []byte
-	closeFlag bool
-	msgParser *MsgParser
+	conn          net.Conn
+	writeChan     chan []byte
+	writeChanHigh chan []byte
+	closeFlag     bool
+	halfClosed    bool
+	writeDone     bool
+	closeReq      bool
+	msgParser     *MsgParser
+	frameLogger   FrameLogger
+	msgSizes      *msgSizes
+	readBuf       []byte
+	// in delimiter mode
+	reader      *bufio.Reader
+	readLimiter *readLimiter
+	// messages of the last batch not read yet
+	batch []byte
 }
 
 func newTCPConn(conn net.Conn, pendingWriteNum int, msgParser *MsgParser) *TCPConn {
 	tcpConn := new(TCPConn)
 	tcpConn.conn = conn
 	tcpConn.writeChan = make(chan []byte, pendingWriteNum)
+	tcpConn.writeChanHigh = make(chan []byte, highPendingWriteNum(pendingWriteNum))
 	tcpConn.msgParser = msgParser
 
 	go func() {
-		for b := range tcpConn.writeChan {
+		var burst int
+		var eof bool
+		for {
+			b, ok := tcpConn.next(&burst)
+			if !ok {
+				break
+			}
 			if b == nil {
+				tcpConn.flushHigh()
+				eof = true
 				break
 			}
 
-			_, err := conn.Write(b)
-			if err != nil {
+			if err := writeFull(conn, b); err != nil {
 				break
 			}
 		}
 
-		conn.Close()
+		tcpConn.Lock()
+		halfClosed := tcpConn.halfClosed
+		tcpConn.Unlock()
+		if eof && halfClosed {
+			conn.(halfCloser).CloseWrite()
+		}
+
 		tcpConn.Lock()
 		tcpConn.closeFlag = true
+		tcpConn.writeDone = true
+		closeConn := !halfClosed || tcpConn.closeReq
 		tcpConn.Unlock()
+		if closeConn {
+			conn.Close()
+		}
 	}()
 
 	return tcpConn
 }
 
+// loops on the short writes of the connections breaking the io.Writer
+// contract, an error (a timeout included) closes the connection since the
+// peer may have received part of a frame
+func writeFull(conn net.Conn, b []byte) error {
+	for len(b) > 0 {
+		n, err := conn.Write(b)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// high priority first, at most maxHighPriorityBurst in a row
+// when low priority messages are waiting
+func (tcpConn *TCPConn) next(burst *int) ([]byte, bool) {
+	if *burst < maxHighPriorityBurst {
+		select {
+		case b, ok := <-tcpConn.writeChanHigh:
+			*burst++
+			return b, ok
+		default:
+		}
+	}
+
+	select {
+	case b, ok := <-tcpConn.writeChan:
+		*burst = 0
+		return b, ok
+	default:
+	}
+
+	select {
+	case b, ok := <-tcpConn.writeChanHigh:
+		*burst++
+		return b, ok
+	case b, ok := <-tcpConn.writeChan:
+		*burst = 0
+		return b, ok
+	}
+}
+
+// the high priority messages written before Close
+func (tcpConn *TCPConn) flushHigh() {
+	for {
+		select {
+		case b, ok := <-tcpConn.writeChanHigh:
+			if !ok {
+				return
+			}
+			if err := writeFull(tcpConn.conn, b); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
 func (tcpConn *TCPConn) doDestroy() {
-	tcpConn.conn.(*net.TCPConn).SetLinger(0)
+	if conn, ok := tcpConn.conn.(*net.TCPConn); ok {
+		conn.SetLinger(0)
+	}
 	tcpConn.conn.Close()
 
 	if !tcpConn.closeFlag {
 		close(tcpConn.writeChan)
+		close(tcpConn.writeChanHigh)
 		tcpConn.closeFlag = true
 	}
 }
@@ -63,6 +177,14 @@ func (tcpConn *TCPConn) Destroy() {
 func (tcpConn *TCPConn) Close() {
 	tcpConn.Lock()
 	defer tcpConn.Unlock()
+	if tcpConn.halfClosed {
+		if tcpConn.writeDone {
+			tcpConn.conn.Close()
+		} else {
+			tcpConn.closeReq = true
+		}
+		return
+	}
 	if tcpConn.closeFlag {
 		return
 	}
@@ -71,14 +193,42 @@ func (tcpConn *TCPConn) Close() {
 	tcpConn.closeFlag = true
 }
 
+type halfCloser interface {
+	CloseWrite() error
+}
+
+// the pending messages are written before the write side is shut down,
+// the connection can still be read until EOF, call Close afterward
+func (tcpConn *TCPConn) CloseWrite() error {
+	tcpConn.Lock()
+	defer tcpConn.Unlock()
+	if _, ok := tcpConn.conn.(halfCloser); !ok {
+		return errors.New("half-close not supported")
+	}
+	if tcpConn.closeFlag {
+		return nil
+	}
+
+	tcpConn.halfClosed = true
+	tcpConn.doWrite(nil)
+	tcpConn.closeFlag = true
+	return nil
+}
+
 func (tcpConn *TCPConn) doWrite(b []byte) {
-	if len(tcpConn.writeChan) == cap(tcpConn.writeChan) {
+	tcpConn.doWriteTo(tcpConn.writeChan, b)
+}
+
+// both priorities share the budget of writeChan
+func (tcpConn *TCPConn) doWriteTo(writeChan chan []byte, b []byte) {
+	if len(writeChan) == cap(writeChan) ||
+		len(tcpConn.writeChan)+len(tcpConn.writeChanHigh) >= cap(tcpConn.writeChan) {
 		log.Debug("close conn: channel full")
 		tcpConn.doDestroy()
 		return
 	}
 
-	tcpConn.writeChan <- b
+	writeChan <- b
 }
 
 // b must not be modified by the others goroutines
@@ -93,7 +243,13 @@ func (tcpConn *TCPConn) Write(b []byte) {
 }
 
 func (tcpConn *TCPConn) Read(b []byte) (int, error) {
-	return tcpConn.conn.Read(b)
+	if tcpConn.readLimiter == nil {
+		return tcpConn.conn.Read(b)
+	}
+
+	n, err := tcpConn.conn.Read(b[:tcpConn.readLimiter.limit(len(b))])
+	tcpConn.readLimiter.wait(n)
+	return n, err
 }
 
 func (tcpConn *TCPConn) LocalAddr() net.Addr {
@@ -104,10 +260,143 @@ func (tcpConn *TCPConn) RemoteAddr() net.Addr {
 	return tcpConn.conn.RemoteAddr()
 }
 
+// the state of the handshake, false if the connection does not use TLS
+func (tcpConn *TCPConn) ConnectionState() (tls.ConnectionState, bool) {
+	if conn, ok := tcpConn.conn.(*tls.Conn); ok {
+		return conn.ConnectionState(), true
+	}
+	return tls.ConnectionState{}, false
+}
+
+// the live underlying connection, e.g. a *net.TCPConn or a *tls.Conn
+// It's dangerous to read from, write to or close it, the goroutine of the
+// connection and ReadMsg use it concurrently, and the messages framing
+// would be corrupted. Only use it for the addresses, the options or the
+// deadlines not managed by TCPConn.
+func (tcpConn *TCPConn) RawConn() net.Conn {
+	return tcpConn.conn
+}
+
+// the syscall.RawConn of the socket, under TLS too, for the socket options
+// or the file descriptor within Control, RawConn's warnings apply to Read
+// and Write
+func (tcpConn *TCPConn) SyscallConn() (syscall.RawConn, error) {
+	conn := tcpConn.conn
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if pc, ok := conn.(*proxyConn); ok {
+		conn = pc.Conn
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil, errors.New("the connection is not a socket")
+	}
+	return sc.SyscallConn()
+}
+
+// the messages queued and not written yet, of both priorities
+// goroutine safe
+func (tcpConn *TCPConn) PendingWrites() int {
+	return len(tcpConn.writeChan) + len(tcpConn.writeChanHigh)
+}
+
+// the connection is closed when more messages are queued, or more than a
+// quarter of it of high priority
+// goroutine safe
+func (tcpConn *TCPConn) PendingWriteCap() int {
+	return cap(tcpConn.writeChan)
+}
+
+func (tcpConn *TCPConn) SetReadDeadline(t time.Time) error {
+	return tcpConn.conn.SetReadDeadline(t)
+}
+
 func (tcpConn *TCPConn) ReadMsg() ([]byte, error) {
-	return tcpConn.msgParser.Read(tcpConn)
+	data, err := tcpConn.readMsg()
+	if err == nil {
+		tcpConn.msgSizes.record(FrameIn, data)
+		if tcpConn.frameLogger != nil {
+			logFrame(tcpConn.frameLogger, FrameIn, data)
+		}
+	}
+	return data, err
+}
+
+func (tcpConn *TCPConn) readMsg() ([]byte, error) {
+	p := tcpConn.msgParser
+	if !p.batch {
+		return p.Read(tcpConn)
+	}
+
+	if len(tcpConn.batch) == 0 {
+		data, err := p.Read(tcpConn)
+		if err != nil {
+			return nil, err
+		}
+		tcpConn.batch = data
+	}
+	data, rest, err := p.split(tcpConn.batch)
+	if err != nil {
+		tcpConn.batch = nil
+		return nil, err
+	}
+	tcpConn.batch = rest
+	return data, nil
 }
 
 func (tcpConn *TCPConn) WriteMsg(args ...[]byte) error {
-	return tcpConn.msgParser.Write(tcpConn, args...)
+	return tcpConn.WriteMsgPriority(false, args...)
+}
+
+// a high priority message is written before the low priority ones
+// already pending
+func (tcpConn *TCPConn) WriteMsgPriority(high bool, args ...[]byte) error {
+	msg, err := tcpConn.msgParser.pack(args...)
+	if err != nil {
+		return err
+	}
+	tcpConn.Lock()
+	if !tcpConn.closeFlag {
+		tcpConn.msgSizes.record(FrameOut, args...)
+		if high {
+			tcpConn.doWriteTo(tcpConn.writeChanHigh, msg)
+		} else {
+			tcpConn.doWrite(msg)
+		}
+	}
+	tcpConn.Unlock()
+
+	if tcpConn.frameLogger != nil {
+		logFrame(tcpConn.frameLogger, FrameOut, args...)
+	}
+	return nil
+}
+
+// msgs are written at once, in a single frame in batch mode
+// (see MsgParser.SetBatch)
+func (tcpConn *TCPConn) WriteBatch(msgs ...[]byte) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	data, err := tcpConn.msgParser.packBatch(msgs)
+	if err != nil {
+		return err
+	}
+
+	tcpConn.Lock()
+	if !tcpConn.closeFlag {
+		for _, msg := range msgs {
+			tcpConn.msgSizes.record(FrameOut, msg)
+		}
+		tcpConn.doWrite(data)
+	}
+	tcpConn.Unlock()
+
+	if tcpConn.frameLogger != nil {
+		for _, msg := range msgs {
+			logFrame(tcpConn.frameLogger, FrameOut, msg)
+		}
+	}
+	return nil
 }
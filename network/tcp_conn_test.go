@@ -0,0 +1,387 @@
+package network
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readFrames(t *testing.T, conn net.Conn, n int) []string {
+	var frames []string
+	for i := 0; i < n; i++ {
+		var l [2]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, binary.BigEndian.Uint16(l[:]))
+		if _, err := io.ReadFull(conn, data); err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, string(data))
+	}
+	return frames
+}
+
+func indexOf(frames []string, frame string) int {
+	for i, f := range frames {
+		if f == frame {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestTCPConn_WriteMsgPriority(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	// writes block until read
+	conn := newTCPConn(server, 100, NewMsgParser())
+	defer conn.Destroy()
+
+	for _, msg := range []string{"low1", "low2", "low3", "low4"} {
+		conn.WriteMsg([]byte(msg))
+	}
+	conn.WriteMsgPriority(true, []byte("high"))
+
+	frames := readFrames(t, client, 5)
+	// low1 may be written before high is queued
+	if i := indexOf(frames, "high"); i > 1 || i > indexOf(frames, "low2") {
+		t.Fatalf("high priority message not first: %v", frames)
+	}
+}
+
+func TestTCPConn_WriteMsgPriorityStarvation(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	// room for 2*maxHighPriorityBurst high priority messages
+	conn := newTCPConn(server, 200, NewMsgParser())
+	defer conn.Destroy()
+
+	conn.WriteMsg([]byte("low"))
+	for i := 0; i < 2*maxHighPriorityBurst; i++ {
+		conn.WriteMsgPriority(true, []byte("high"))
+	}
+
+	frames := readFrames(t, client, 2*maxHighPriorityBurst+1)
+	if i := indexOf(frames, "low"); i > maxHighPriorityBurst+1 {
+		t.Fatalf("low priority message starved, written at %v", i)
+	}
+}
+
+func TestTCPConn_CloseFlushesHigh(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := newTCPConn(server, 100, NewMsgParser())
+
+	conn.WriteMsg([]byte("low"))
+	conn.WriteMsgPriority(true, []byte("high"))
+	conn.Close()
+
+	frames := readFrames(t, client, 2)
+	if indexOf(frames, "low") < 0 || indexOf(frames, "high") < 0 {
+		t.Fatalf("pending messages lost: %v", frames)
+	}
+}
+
+func TestTCPConn_WriteMsgPriorityBudget(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := newTCPConn(server, 8, NewMsgParser())
+	defer conn.Destroy()
+	if n := conn.PendingWriteCap(); n != 8 {
+		t.Fatalf("got %v, want 8", n)
+	}
+
+	// nothing is read, beyond a quarter of the budget
+	for i := 0; i < 4; i++ {
+		conn.WriteMsgPriority(true, []byte("high"))
+	}
+	conn.Lock()
+	closed := conn.closeFlag
+	conn.Unlock()
+	if !closed {
+		t.Fatal("connection not closed")
+	}
+}
+
+func TestTCPConn_WriteClosed(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := newTCPConn(server, 100, NewMsgParser())
+	sizes := new(msgSizes)
+	conn.msgSizes = sizes
+	conn.Destroy()
+
+	conn.WriteMsgPriority(true, []byte("high"))
+	conn.WriteMsg([]byte("low"))
+	conn.WriteBatch([]byte("a"), []byte("b"))
+	for _, n := range sizes.stats().Out {
+		if n != 0 {
+			t.Fatalf("messages of a closed connection counted: %v", sizes.stats().Out)
+		}
+	}
+}
+
+func TestTCPConn_CloseWrite(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := newTCPConn(server, 100, NewMsgParser())
+	defer conn.Close()
+
+	conn.WriteMsg([]byte("response"))
+	if err := conn.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	conn.WriteMsg([]byte("dropped"))
+
+	// the peer reads the pending data, then EOF
+	if frames := readFrames(t, client, 1); frames[0] != "response" {
+		t.Fatalf("got %v", frames)
+	}
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("got %v, want EOF", err)
+	}
+
+	// the read side is still open
+	client.Write([]byte{0, 4, 'l', 'a', 's', 't'})
+	client.(*net.TCPConn).CloseWrite()
+	data, err := conn.ReadMsg()
+	if err != nil || string(data) != "last" {
+		t.Fatalf("got %q %v", data, err)
+	}
+	if _, err := conn.ReadMsg(); err != io.EOF {
+		t.Fatalf("got %v, want EOF", err)
+	}
+}
+
+func TestTCPConn_CloseWriteUnsupported(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := newTCPConn(server, 100, NewMsgParser())
+	defer conn.Destroy()
+
+	if err := conn.CloseWrite(); err == nil {
+		t.Fatal("half-close on a pipe succeeded")
+	}
+}
+
+func batchParser() *MsgParser {
+	p := NewMsgParser()
+	p.SetBatch(true)
+	return p
+}
+
+func TestTCPConn_WriteBatch(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := newTCPConn(server, 100, batchParser())
+	defer conn.Destroy()
+
+	conn.WriteBatch([]byte("a"), []byte("bc"), []byte("def"))
+
+	// a single frame
+	frames := readFrames(t, client, 1)
+	want := "\x00\x01a\x00\x02bc\x00\x03def"
+	if frames[0] != want {
+		t.Fatalf("got %q, want %q", frames[0], want)
+	}
+}
+
+func TestTCPConn_ReadBatch(t *testing.T) {
+	server, client := net.Pipe()
+	writer := newTCPConn(client, 100, batchParser())
+	defer writer.Destroy()
+	reader := newTCPConn(server, 100, batchParser())
+	defer reader.Destroy()
+
+	go func() {
+		writer.WriteBatch([]byte("a"), []byte("bc"), []byte("def"))
+		writer.WriteMsg([]byte("single"))
+	}()
+
+	for _, want := range []string{"a", "bc", "def", "single"} {
+		data, err := reader.ReadMsg()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Fatalf("got %q, want %q", data, want)
+		}
+	}
+
+	// a batch larger than maxMsgLen
+	big := make([]byte, 3000)
+	if err := writer.WriteBatch(big, big); err == nil {
+		t.Fatal("oversized batch accepted")
+	}
+}
+
+func TestMsgParser_SplitInvalid(t *testing.T) {
+	p := batchParser()
+	for _, data := range []string{"\x00", "\x00\x05abc", "\x00\x00"} {
+		if _, _, err := p.split([]byte(data)); err == nil {
+			t.Errorf("invalid batch %q accepted", data)
+		}
+	}
+}
+
+func TestTCPConn_RawConn(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := newTCPConn(server, 100, NewMsgParser())
+	defer conn.Close()
+
+	raw := conn.RawConn()
+	if raw != server {
+		t.Fatal("not the underlying connection")
+	}
+	if raw.RemoteAddr().String() != client.LocalAddr().String() {
+		t.Fatalf("got %v, want %v", raw.RemoteAddr(), client.LocalAddr())
+	}
+	if err := raw.(*net.TCPConn).SetNoDelay(false); err != nil {
+		t.Fatal(err)
+	}
+
+	sc, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var called bool
+	if err := sc.Control(func(fd uintptr) { called = true }); err != nil || !called {
+		t.Fatalf("Control not called: %v", err)
+	}
+
+	// the managed loops still work
+	conn.WriteMsg([]byte("after"))
+	if frames := readFrames(t, client, 1); frames[0] != "after" {
+		t.Fatalf("got %v", frames)
+	}
+}
+
+func TestTCPConn_SyscallConnPipe(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := newTCPConn(server, 100, NewMsgParser())
+	defer conn.Close()
+
+	if _, err := conn.SyscallConn(); err == nil {
+		t.Fatal("no error for a pipe")
+	}
+}
+
+// accepts a few bytes per Write without an error
+type throttledConn struct {
+	net.Conn
+}
+
+func (c throttledConn) Write(b []byte) (int, error) {
+	if len(b) > 3 {
+		b = b[:3]
+	}
+	return c.Conn.Write(b)
+}
+
+func TestTCPConn_ShortWrites(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := newTCPConn(throttledConn{server}, 100, NewMsgParser())
+	defer conn.Close()
+
+	msgs := []string{"hello", strings.Repeat("z", 1000), "bye"}
+	for _, msg := range msgs {
+		conn.WriteMsg([]byte(msg))
+	}
+	frames := readFrames(t, client, len(msgs))
+	for i, msg := range msgs {
+		if frames[i] != msg {
+			t.Fatalf("frame %v: got %.20q, want %.20q", i, frames[i], msg)
+		}
+	}
+}
+
+// fails once part of the data is written
+type timeoutConn struct {
+	net.Conn
+}
+
+func (c timeoutConn) Write(b []byte) (int, error) {
+	n, _ := c.Conn.Write(b[:1])
+	return n, os.ErrDeadlineExceeded
+}
+
+func TestTCPConn_WriteTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := newTCPConn(timeoutConn{server}, 100, NewMsgParser())
+	defer conn.Close()
+
+	conn.WriteMsg([]byte("truncated"))
+	// the connection is closed after the partial frame
+	b, err := io.ReadAll(client)
+	if err != nil || len(b) != 1 {
+		t.Fatalf("got %q %v", b, err)
+	}
+}
+
+func TestTCPConn_ReadBytesPerSec(t *testing.T) {
+	const rate = 100000
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := newTCPConn(server, 100, NewMsgParser())
+	conn.readLimiter = newReadLimiter(rate)
+	defer conn.Close()
+
+	const n, size = 50, 4000
+	go func() {
+		frame := make([]byte, 2+size)
+		binary.BigEndian.PutUint16(frame, size)
+		for i := 0; i < n; i++ {
+			if _, err := client.Write(frame); err != nil {
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if data, err := conn.ReadMsg(); err != nil || len(data) != size {
+			t.Fatalf("got %v bytes %v", len(data), err)
+		}
+	}
+	// a second of rate is read at once
+	total := n * (2 + size)
+	d := time.Since(start)
+	if want := time.Duration(float64(total-rate) / rate * float64(time.Second)); d < want*9/10 {
+		t.Fatalf("read %v bytes in %v, want %v at least", total, d, want)
+	}
+}
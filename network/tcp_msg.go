@@ -1,20 +1,45 @@
 package network
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"math"
 )
 
+// the message is discarded, the connection can still be read, see
+// MsgParser.SetSkipTooLong
+var ErrMsgTooLong = errors.New("message too long")
+
+// wraps ErrMsgTooLong, the message is not read and the connection can no
+// longer be read
+var ErrMsgTooLongClose = fmt.Errorf("%w, connection out of sync", ErrMsgTooLong)
+
 // --------------
 // | len | data |
 // --------------
+//
+// in batch mode, data is one or more messages framed the same way
+// ------------------------------------
+// | len | len | data | len | data | ...
+// ------------------------------------
+//
+// in delimiter mode
+// ---------------
+// | data | delim |
+// ---------------
 type MsgParser struct {
 	lenMsgLen    int
 	minMsgLen    uint32
 	maxMsgLen    uint32
 	littleEndian bool
+	batch        bool
+	delimited    bool
+	delim        byte
+	skipTooLong  bool
 }
 
 func NewMsgParser() *MsgParser {
@@ -61,8 +86,42 @@ func (p *MsgParser) SetByteOrder(littleEndian bool) {
 	p.littleEndian = littleEndian
 }
 
+// both peers must use the same mode, a frame including its messages
+// is at most maxMsgLen long
+// It's dangerous to call the method on reading or writing
+func (p *MsgParser) SetBatch(batch bool) {
+	p.batch = batch && !p.delimited
+}
+
+// messages end with delim instead of starting with their length, e.g.
+// '\n' for a line-based protocol, the message read does not include delim
+// and a message written must not contain it, maxMsgLen does not count it
+// batch mode is disabled
+// It's dangerous to call the method on reading or writing
+func (p *MsgParser) SetDelimiter(delimited bool, delim byte) {
+	p.delimited = delimited
+	p.delim = delim
+	if delimited {
+		p.batch = false
+	}
+}
+
+// by default a message longer than maxMsgLen is not read and
+// ErrMsgTooLongClose is returned, with skip its data is read and discarded
+// and ErrMsgTooLong is returned, so the following messages are still read,
+// a peer declaring gigabytes or never sending the delimiter is then waited
+// for until it has sent them
+// It's dangerous to call the method on reading or writing
+func (p *MsgParser) SetSkipTooLong(skip bool) {
+	p.skipTooLong = skip
+}
+
 // goroutine safe
 func (p *MsgParser) Read(conn *TCPConn) ([]byte, error) {
+	if p.delimited {
+		return p.readDelimited(conn)
+	}
+
 	var b [4]byte
 	bufMsgLen := b[:p.lenMsgLen]
 
@@ -92,13 +151,24 @@ func (p *MsgParser) Read(conn *TCPConn) ([]byte, error) {
 
 	// check len
 	if msgLen > p.maxMsgLen {
-		return nil, errors.New("message too long")
+		if !p.skipTooLong {
+			return nil, ErrMsgTooLongClose
+		}
+		if _, err := io.CopyN(io.Discard, conn, int64(msgLen)); err != nil {
+			return nil, err
+		}
+		return nil, ErrMsgTooLong
 	} else if msgLen < p.minMsgLen {
 		return nil, errors.New("message too short")
 	}
 
 	// data
-	msgData := make([]byte, msgLen)
+	var msgData []byte
+	if msgLen <= uint32(len(conn.readBuf)) {
+		msgData = conn.readBuf[:msgLen]
+	} else {
+		msgData = make([]byte, msgLen)
+	}
 	if _, err := io.ReadFull(conn, msgData); err != nil {
 		return nil, err
 	}
@@ -106,8 +176,125 @@ func (p *MsgParser) Read(conn *TCPConn) ([]byte, error) {
 	return msgData, nil
 }
 
+// the connection reads ahead into its own buffer
+func (p *MsgParser) readDelimited(conn *TCPConn) ([]byte, error) {
+	if conn.reader == nil {
+		conn.reader = bufio.NewReader(conn)
+	}
+
+	var msgData []byte
+	var tooLong bool
+	for {
+		chunk, err := conn.reader.ReadSlice(p.delim)
+		if err != nil && err != bufio.ErrBufferFull {
+			if err == io.EOF && (len(msgData) > 0 || len(chunk) > 0) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if err == nil {
+			// strip the delimiter
+			chunk = chunk[:len(chunk)-1]
+		}
+
+		// the rest of a message too long is discarded when skipping
+		if !tooLong && uint32(len(msgData)+len(chunk)) > p.maxMsgLen {
+			if !p.skipTooLong {
+				return nil, ErrMsgTooLongClose
+			}
+			tooLong = true
+			msgData = nil
+		}
+		if !tooLong {
+			if msgData == nil && len(chunk) <= len(conn.readBuf) && err == nil {
+				msgData = conn.readBuf[:0]
+			}
+			msgData = append(msgData, chunk...)
+		}
+		if err == nil {
+			break
+		}
+	}
+
+	if tooLong {
+		return nil, ErrMsgTooLong
+	} else if uint32(len(msgData)) < p.minMsgLen {
+		return nil, errors.New("message too short")
+	}
+	return msgData, nil
+}
+
 // goroutine safe
 func (p *MsgParser) Write(conn *TCPConn, args ...[]byte) error {
+	msg, err := p.pack(args...)
+	if err != nil {
+		return err
+	}
+
+	conn.Write(msg)
+
+	return nil
+}
+
+// one message, in a batch of one in batch mode
+func (p *MsgParser) pack(args ...[]byte) ([]byte, error) {
+	msg, err := p.frame(args...)
+	if err != nil || !p.batch {
+		return msg, err
+	}
+	return p.frame(msg)
+}
+
+// in batch mode one frame holding msgs, the frames of msgs otherwise
+func (p *MsgParser) packBatch(msgs [][]byte) ([]byte, error) {
+	var data []byte
+	for _, msg := range msgs {
+		m, err := p.frame(msg)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, m...)
+	}
+	if !p.batch {
+		return data, nil
+	}
+	return p.frame(data)
+}
+
+// the first message of a batch and the rest of the batch
+func (p *MsgParser) split(data []byte) ([]byte, []byte, error) {
+	if len(data) < p.lenMsgLen {
+		return nil, nil, errors.New("invalid batch")
+	}
+
+	var msgLen uint32
+	switch p.lenMsgLen {
+	case 1:
+		msgLen = uint32(data[0])
+	case 2:
+		if p.littleEndian {
+			msgLen = uint32(binary.LittleEndian.Uint16(data))
+		} else {
+			msgLen = uint32(binary.BigEndian.Uint16(data))
+		}
+	case 4:
+		if p.littleEndian {
+			msgLen = binary.LittleEndian.Uint32(data)
+		} else {
+			msgLen = binary.BigEndian.Uint32(data)
+		}
+	}
+
+	data = data[p.lenMsgLen:]
+	if msgLen > uint32(len(data)) {
+		return nil, nil, errors.New("invalid batch")
+	} else if msgLen < p.minMsgLen {
+		return nil, nil, errors.New("message too short")
+	}
+	return data[:msgLen], data[msgLen:], nil
+}
+
+func (p *MsgParser) frame(args ...[]byte) ([]byte, error) {
 	// get len
 	var msgLen uint32
 	for i := 0; i < len(args); i++ {
@@ -116,9 +303,13 @@ func (p *MsgParser) Write(conn *TCPConn, args ...[]byte) error {
 
 	// check len
 	if msgLen > p.maxMsgLen {
-		return errors.New("message too long")
+		return nil, errors.New("message too long")
 	} else if msgLen < p.minMsgLen {
-		return errors.New("message too short")
+		return nil, errors.New("message too short")
+	}
+
+	if p.delimited {
+		return p.frameDelimited(msgLen, args...)
 	}
 
 	msg := make([]byte, uint32(p.lenMsgLen)+msgLen)
@@ -148,7 +339,16 @@ func (p *MsgParser) Write(conn *TCPConn, args ...[]byte) error {
 		l += len(args[i])
 	}
 
-	conn.Write(msg)
+	return msg, nil
+}
 
-	return nil
+func (p *MsgParser) frameDelimited(msgLen uint32, args ...[]byte) ([]byte, error) {
+	msg := make([]byte, 0, msgLen+1)
+	for i := 0; i < len(args); i++ {
+		if bytes.IndexByte(args[i], p.delim) >= 0 {
+			return nil, errors.New("message contains the delimiter")
+		}
+		msg = append(msg, args[i]...)
+	}
+	return append(msg, p.delim), nil
 }
@@ -0,0 +1,176 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func benchmarkReadMsg(b *testing.B, readBufferSize int) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	p := NewMsgParser()
+	frame := make([]byte, 2+256)
+	binary.BigEndian.PutUint16(frame, 256)
+	go func() {
+		for i := 0; i < b.N; i++ {
+			if _, err := client.Write(frame); err != nil {
+				return
+			}
+		}
+		client.Close()
+	}()
+
+	tcpConn := &TCPConn{conn: server, msgParser: p}
+	if readBufferSize > 0 {
+		tcpConn.readBuf = make([]byte, readBufferSize)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tcpConn.ReadMsg(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadMsg(b *testing.B) {
+	benchmarkReadMsg(b, 0)
+}
+
+func BenchmarkReadMsg_ReadBuffer(b *testing.B) {
+	benchmarkReadMsg(b, 4096)
+}
+
+func TestMsgParser_Delimiter(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	p := NewMsgParser()
+	p.SetMsgLen(4, 1, 10000)
+	p.SetDelimiter(true, '\n')
+	p.SetSkipTooLong(true)
+	conn := newTCPConn(server, 100, p)
+	defer conn.Close()
+
+	large := strings.Repeat("x", 9000)
+	go func() {
+		// split across writes, larger than the read buffer, too long
+		for _, s := range []string{"hel", "lo\nwor", "ld\n", large + "\n", large + large + "\nlast"} {
+			if _, err := client.Write([]byte(s)); err != nil {
+				return
+			}
+		}
+		client.Write([]byte("\npartial"))
+		client.Close()
+	}()
+
+	for _, want := range []string{"hello", "world", large} {
+		data, err := conn.ReadMsg()
+		if err != nil || string(data) != want {
+			t.Fatalf("got %.20q %v, want %.20q", data, err, want)
+		}
+	}
+	if _, err := conn.ReadMsg(); err != ErrMsgTooLong {
+		t.Fatalf("got %v, want ErrMsgTooLong", err)
+	}
+	if data, err := conn.ReadMsg(); err != nil || string(data) != "last" {
+		t.Fatalf("got %q %v, want last", data, err)
+	}
+	if _, err := conn.ReadMsg(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("got %v, want ErrUnexpectedEOF", err)
+	}
+}
+
+func TestMsgParser_SetSkipTooLong(t *testing.T) {
+	for _, skipTooLong := range []bool{false, true} {
+		server, client := net.Pipe()
+		p := NewMsgParser()
+		p.SetMsgLen(2, 1, 100)
+		p.SetSkipTooLong(skipTooLong)
+		conn := newTCPConn(server, 100, p)
+
+		go func() {
+			frame := make([]byte, 2+1000)
+			binary.BigEndian.PutUint16(frame, 1000)
+			client.Write(append(frame, 0, 2, 'o', 'k'))
+		}()
+
+		_, err := conn.ReadMsg()
+		if !errors.Is(err, ErrMsgTooLong) {
+			t.Fatalf("skip %v: got %v, want ErrMsgTooLong", skipTooLong, err)
+		}
+		if !skipTooLong {
+			if err != ErrMsgTooLongClose {
+				t.Fatalf("got %v, want ErrMsgTooLongClose", err)
+			}
+		} else if data, err := conn.ReadMsg(); err != nil || string(data) != "ok" {
+			t.Fatalf("got %q %v after the skipped message", data, err)
+		}
+		conn.Close()
+		client.Close()
+	}
+}
+
+func TestMsgParser_DelimiterTooLong(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	p := NewMsgParser()
+	p.SetMsgLen(2, 1, 100)
+	p.SetDelimiter(true, '\n')
+	conn := newTCPConn(server, 100, p)
+	defer conn.Close()
+
+	// a line never ended by the delimiter
+	go client.Write([]byte(strings.Repeat("x", 5000)))
+
+	if _, err := conn.ReadMsg(); err != ErrMsgTooLongClose {
+		t.Fatalf("got %v, want ErrMsgTooLongClose", err)
+	}
+}
+
+func TestMsgParser_DelimiterWrite(t *testing.T) {
+	p := NewMsgParser()
+	p.SetDelimiter(true, 0)
+	p.SetBatch(true)
+
+	msg, err := p.pack([]byte("a"), []byte("b"))
+	if err != nil || string(msg) != "ab\x00" {
+		t.Fatalf("got %q %v", msg, err)
+	}
+	if _, err := p.pack([]byte("a\x00b")); err == nil {
+		t.Fatal("message containing the delimiter written")
+	}
+	if data, err := p.packBatch([][]byte{[]byte("a"), []byte("b")}); err != nil || string(data) != "a\x00b\x00" {
+		t.Fatalf("got %q %v", data, err)
+	}
+}
+
+func TestMsgParser_DelimiterRoundTrip(t *testing.T) {
+	a, b := net.Pipe()
+	p := NewMsgParser()
+	p.SetDelimiter(true, '\n')
+	writer := newTCPConn(a, 100, p)
+	defer writer.Close()
+	reader := newTCPConn(b, 100, p)
+	defer reader.Close()
+
+	msgs := []string{"first", strings.Repeat("y", 4000), "third"}
+	for _, msg := range msgs {
+		if err := writer.WriteMsg([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range msgs {
+		data, err := reader.ReadMsg()
+		if err != nil || string(data) != want {
+			t.Fatalf("got %.20q %v, want %.20q", data, err, want)
+		}
+	}
+}
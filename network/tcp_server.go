@@ -1,40 +1,97 @@
 package network
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"github.com/name5566/leaf/log"
 	"net"
+	"os"
 	"sync"
 	"time"
 )
 
+// Network is "tcp" (default), "tcp4" or "tcp6"
+// with "tcp", a wildcard Addr such as ":3563" or "[::]:3563" accepts both
+// IPv4 and IPv6 on dual-stack hosts, with "tcp6" it accepts IPv6 only
 type TCPServer struct {
 	Addr            string
+	Network         string
+	Listener        net.Listener
 	MaxConnNum      int
 	PendingWriteNum int
 	NewAgent        func(*TCPConn) Agent
-	ln              net.Listener
-	conns           ConnSet
-	mutexConns      sync.Mutex
-	wgLn            sync.WaitGroup
-	wgConns         sync.WaitGroup
+	FrameLogger     FrameLogger
+	// messages up to ReadBufferSize bytes are read into a buffer reused by
+	// each connection, the data returned by ReadMsg is then only valid until
+	// the next call and must be copied to be retained
+	ReadBufferSize int
+	// the bytes read from a connection per second, the reads pause beyond
+	// it and TCP flow control slows the client down, the frames are
+	// counted whatever the number of messages, 0 means no limit
+	ReadBytesPerSec int
+	// the connections start with a PROXY protocol header (v1 or v2) sent
+	// by a load balancer, RemoteAddr is the client it declares, the
+	// connections without a valid header are closed before NewAgent
+	ProxyProtocol bool
+	// called with every accepted connection before MaxConnNum is checked,
+	// the connection is closed when accept is false, otherwise it is
+	// served after delay, e.g. to pace a reconnect storm
+	// the delay holds the accept loop, the next connections wait in the
+	// listen backlog meanwhile, nil accepts at once
+	ShouldAccept func(conn net.Conn) (accept bool, delay time.Duration)
+	closeSig     chan struct{}
+	ln           net.Listener
+	rawLn        net.Listener
+	msgSizes     msgSizes
+	conns        ConnSet
+	tcpConns     map[*TCPConn]struct{}
+	mutexConns   sync.Mutex
+	wgLn         sync.WaitGroup
+	wgConns      sync.WaitGroup
 
 	// msg parser
 	LenMsgLen    int
 	MinMsgLen    uint32
 	MaxMsgLen    uint32
 	LittleEndian bool
-	msgParser    *MsgParser
+	// see MsgParser.SetBatch
+	Batch bool
+	// see MsgParser.SetDelimiter
+	Delimited bool
+	Delimiter byte
+	// see MsgParser.SetSkipTooLong
+	SkipMsgTooLong bool
+	msgParser      *MsgParser
+
+	// tls
+	CertFile string
+	KeyFile  string
+	// the clients must present a certificate signed by a CA of
+	// ClientCAFile, the others are closed before NewAgent
+	ClientCAFile string
 }
 
+// a client completing no handshake within the timeout is closed
+const tlsHandshakeTimeout = 10 * time.Second
+
 func (server *TCPServer) Start() {
 	server.init()
 	go server.run()
 }
 
 func (server *TCPServer) init() {
-	ln, err := net.Listen("tcp", server.Addr)
-	if err != nil {
-		log.Fatal("%v", err)
+	// Listener takes precedence over Addr
+	if server.Network == "" {
+		server.Network = "tcp"
+	}
+	ln := server.Listener
+	if ln == nil {
+		var err error
+		ln, err = net.Listen(server.Network, server.Addr)
+		if err != nil {
+			log.Fatal("%v", err)
+		}
 	}
 
 	if server.MaxConnNum <= 0 {
@@ -49,16 +106,78 @@ func (server *TCPServer) init() {
 		log.Fatal("NewAgent must not be nil")
 	}
 
+	server.rawLn = ln
+	if server.ProxyProtocol {
+		ln = proxyListener{ln}
+	}
+	if server.CertFile != "" || server.KeyFile != "" {
+		ln = tls.NewListener(ln, server.tlsConfig())
+	}
+
 	server.ln = ln
+	server.closeSig = make(chan struct{})
 	server.conns = make(ConnSet)
+	server.tcpConns = make(map[*TCPConn]struct{})
 
 	// msg parser
 	msgParser := NewMsgParser()
 	msgParser.SetMsgLen(server.LenMsgLen, server.MinMsgLen, server.MaxMsgLen)
 	msgParser.SetByteOrder(server.LittleEndian)
+	msgParser.SetBatch(server.Batch)
+	msgParser.SetDelimiter(server.Delimited, server.Delimiter)
+	msgParser.SetSkipTooLong(server.SkipMsgTooLong)
 	server.msgParser = msgParser
 }
 
+func (server *TCPServer) tlsConfig() *tls.Config {
+	config := &tls.Config{}
+
+	var err error
+	config.Certificates = make([]tls.Certificate, 1)
+	config.Certificates[0], err = tls.LoadX509KeyPair(server.CertFile, server.KeyFile)
+	if err != nil {
+		log.Fatal("%v", err)
+	}
+
+	if server.ClientCAFile != "" {
+		pem, err := os.ReadFile(server.ClientCAFile)
+		if err != nil {
+			log.Fatal("%v", err)
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			log.Fatal("no certificate in %v", server.ClientCAFile)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config
+}
+
+// reads the PROXY header then completes the TLS handshake
+func handshake(conn net.Conn) error {
+	netConn := conn
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		netConn = tlsConn.NetConn()
+	}
+	if pc, ok := netConn.(*proxyConn); ok {
+		if err := pc.readHeader(); err != nil {
+			return fmt.Errorf("proxy header: %w", err)
+		}
+	}
+	return tlsHandshake(conn)
+}
+
+func tlsHandshake(conn net.Conn) error {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	tlsConn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	defer tlsConn.SetDeadline(time.Time{})
+	return tlsConn.Handshake()
+}
+
 func (server *TCPServer) run() {
 	server.wgLn.Add(1)
 	defer server.wgLn.Done()
@@ -84,6 +203,10 @@ func (server *TCPServer) run() {
 		}
 		tempDelay = 0
 
+		if server.ShouldAccept != nil && !server.admit(conn) {
+			continue
+		}
+
 		server.mutexConns.Lock()
 		if len(server.conns) >= server.MaxConnNum {
 			server.mutexConns.Unlock()
@@ -91,29 +214,127 @@ func (server *TCPServer) run() {
 			log.Debug("too many connections")
 			continue
 		}
+		server.wgConns.Add(1)
 		server.conns[conn] = struct{}{}
 		server.mutexConns.Unlock()
 
-		server.wgConns.Add(1)
+		// the agents of plain connections are created in accept order
+		if _, ok := conn.(*tls.Conn); !ok && !server.ProxyProtocol {
+			tcpConn, agent := server.newAgent(conn)
+			go server.serve(conn, tcpConn, agent)
+			continue
+		}
 
-		tcpConn := newTCPConn(conn, server.PendingWriteNum, server.msgParser)
-		agent := server.NewAgent(tcpConn)
 		go func() {
-			agent.Run()
-
-			// cleanup
-			tcpConn.Close()
-			server.mutexConns.Lock()
-			delete(server.conns, conn)
-			server.mutexConns.Unlock()
-			agent.OnClose()
+			if err := handshake(conn); err != nil {
+				log.Debug("handshake error: %v", err)
+				conn.Close()
+				server.mutexConns.Lock()
+				delete(server.conns, conn)
+				server.mutexConns.Unlock()
+				server.wgConns.Done()
+				return
+			}
 
-			server.wgConns.Done()
+			tcpConn, agent := server.newAgent(conn)
+			server.serve(conn, tcpConn, agent)
 		}()
 	}
 }
 
+// false if conn is closed
+func (server *TCPServer) admit(conn net.Conn) bool {
+	accept, delay := server.ShouldAccept(conn)
+	if !accept {
+		conn.Close()
+		log.Debug("connection rejected")
+		return false
+	}
+	if delay <= 0 {
+		return true
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-server.closeSig:
+		conn.Close()
+		return false
+	}
+}
+
+func (server *TCPServer) newAgent(conn net.Conn) (*TCPConn, Agent) {
+	tcpConn := newTCPConn(conn, server.PendingWriteNum, server.msgParser)
+	tcpConn.frameLogger = server.FrameLogger
+	tcpConn.msgSizes = &server.msgSizes
+	if server.ReadBufferSize > 0 {
+		tcpConn.readBuf = make([]byte, server.ReadBufferSize)
+	}
+	if server.ReadBytesPerSec > 0 {
+		tcpConn.readLimiter = newReadLimiter(server.ReadBytesPerSec)
+	}
+	server.mutexConns.Lock()
+	if server.tcpConns != nil {
+		server.tcpConns[tcpConn] = struct{}{}
+	}
+	server.mutexConns.Unlock()
+
+	return tcpConn, server.NewAgent(tcpConn)
+}
+
+func (server *TCPServer) serve(conn net.Conn, tcpConn *TCPConn, agent Agent) {
+	agent.Run()
+
+	// cleanup
+	tcpConn.Close()
+	server.mutexConns.Lock()
+	delete(server.conns, conn)
+	delete(server.tcpConns, tcpConn)
+	server.mutexConns.Unlock()
+	agent.OnClose()
+
+	server.wgConns.Done()
+}
+
+// a duplicate of the listening socket, e.g. to hand it off to a new
+// process (exec.Cmd.ExtraFiles or a unix socket) which resumes accepting
+// with net.FileListener while this one stops, the bind is never released
+// the caller must close the file, it fails on the listeners without a file
+// descriptor such as a listener not created by the net package
+// you must call the function after calling Start
+func (server *TCPServer) File() (*os.File, error) {
+	ln, ok := server.rawLn.(interface {
+		File() (*os.File, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("listener %T has no file", server.rawLn)
+	}
+	return ln.File()
+}
+
+// the sizes of the messages read and written by the connections
+// goroutine safe
+func (server *TCPServer) MsgSizeStats() MsgSizeStats {
+	return server.msgSizes.stats()
+}
+
+// a snapshot of the connections
+// goroutine safe
+func (server *TCPServer) Conns() []*TCPConn {
+	server.mutexConns.Lock()
+	defer server.mutexConns.Unlock()
+
+	conns := make([]*TCPConn, 0, len(server.tcpConns))
+	for conn := range server.tcpConns {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
 func (server *TCPServer) Close() {
+	close(server.closeSig)
 	server.ln.Close()
 	server.wgLn.Wait()
 
@@ -122,6 +343,7 @@ func (server *TCPServer) Close() {
 		conn.Close()
 	}
 	server.conns = nil
+	server.tcpConns = nil
 	server.mutexConns.Unlock()
 	server.wgConns.Wait()
 }
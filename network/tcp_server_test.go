@@ -0,0 +1,93 @@
+package network_test
+
+import (
+	"github.com/name5566/leaf/network"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTCPServer_ShouldAccept(t *testing.T) {
+	var consulted atomic.Int32
+	server := new(network.TCPServer)
+	server.Addr = freeAddr(t)
+	server.LenMsgLen = 2
+	server.ShouldAccept = func(conn net.Conn) (bool, time.Duration) {
+		switch consulted.Add(1) {
+		case 1:
+			return false, 0
+		case 2:
+			return true, 100 * time.Millisecond
+		}
+		return true, 0
+	}
+	server.NewAgent = func(conn *network.TCPConn) network.Agent {
+		return &echoAgent{conn: conn}
+	}
+	server.Start()
+	defer server.Close()
+
+	echo := func() error {
+		conn, err := net.Dial("tcp", server.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write([]byte{0, 2, 'h', 'i'}); err != nil {
+			return err
+		}
+		buf := make([]byte, 7)
+		_, err = conn.Read(buf)
+		return err
+	}
+
+	if err := echo(); err == nil {
+		t.Fatal("rejected connection served")
+	}
+	start := time.Now()
+	if err := echo(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Fatalf("served after %v, before the delay", d)
+	}
+	if err := echo(); err != nil {
+		t.Fatal(err)
+	}
+	if n := consulted.Load(); n != 3 {
+		t.Fatalf("hook consulted %v times, want 3", n)
+	}
+}
+
+func TestTCPServer_ShouldAcceptClose(t *testing.T) {
+	delayed := make(chan struct{})
+	server := new(network.TCPServer)
+	server.Addr = freeAddr(t)
+	server.ShouldAccept = func(conn net.Conn) (bool, time.Duration) {
+		close(delayed)
+		return true, time.Hour
+	}
+	server.NewAgent = func(conn *network.TCPConn) network.Agent {
+		return &echoAgent{conn: conn}
+	}
+	server.Start()
+
+	conn, err := net.Dial("tcp", server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	<-delayed
+
+	start := time.Now()
+	server.Close()
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Close waited %v for the delay", d)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("delayed connection served after Close")
+	}
+}
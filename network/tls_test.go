@@ -0,0 +1,146 @@
+package network_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/name5566/leaf/network"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type certKey struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// signed by parent, self-signed CA if parent is nil
+func newCert(t *testing.T, cn string, parent *certKey) *certKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &certKey{cert, key, der}
+}
+
+func (c *certKey) writeFiles(t *testing.T, dir, name string) (string, string) {
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func (c *certKey) tlsCert() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestTCPServer_ClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCert(t, "ca", nil)
+	caFile, _ := ca.writeFiles(t, dir, "ca")
+	certFile, keyFile := newCert(t, "server", ca).writeFiles(t, dir, "server")
+
+	var mutex sync.Mutex
+	var identities []string
+	server := new(network.TCPServer)
+	server.Addr = freeAddr(t)
+	server.LenMsgLen = 2
+	server.CertFile = certFile
+	server.KeyFile = keyFile
+	server.ClientCAFile = caFile
+	server.NewAgent = func(conn *network.TCPConn) network.Agent {
+		state, ok := conn.ConnectionState()
+		if ok && len(state.PeerCertificates) > 0 {
+			mutex.Lock()
+			identities = append(identities, state.PeerCertificates[0].Subject.CommonName)
+			mutex.Unlock()
+		}
+		return &echoAgent{conn: conn}
+	}
+	server.Start()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	echo := func(certs ...tls.Certificate) error {
+		config := &tls.Config{RootCAs: roots}
+		// sent even if not signed by a CA accepted by the server
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if len(certs) == 0 {
+				return new(tls.Certificate), nil
+			}
+			return &certs[0], nil
+		}
+		conn, err := tls.Dial("tcp", server.Addr, config)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write([]byte{0, 2, 'h', 'i'}); err != nil {
+			return err
+		}
+		buf := make([]byte, 7)
+		_, err = conn.Read(buf)
+		return err
+	}
+
+	if err := echo(newCert(t, "game-1", ca).tlsCert()); err != nil {
+		t.Fatalf("valid client certificate rejected: %v", err)
+	}
+	if err := echo(); err == nil {
+		t.Fatal("client without certificate accepted")
+	}
+	if err := echo(newCert(t, "intruder", newCert(t, "other ca", nil)).tlsCert()); err == nil {
+		t.Fatal("untrusted client certificate accepted")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(identities) != 1 || identities[0] != "game-1" {
+		t.Fatalf("got agents for %v, want game-1 only", identities)
+	}
+}
@@ -0,0 +1,183 @@
+package network
+
+import (
+	"errors"
+	"github.com/name5566/leaf/log"
+	"net"
+	"sync"
+	"time"
+)
+
+// one datagram carries exactly one message, there is no length header
+type UDPConn struct {
+	sync.Mutex
+	conn        *net.UDPConn
+	remoteAddr  *net.UDPAddr
+	readChan    chan []byte
+	writeChan   chan []byte
+	closeChan   chan struct{}
+	maxMsgLen   uint32
+	idleTimeout time.Duration
+	closeFlag   bool
+}
+
+func newUDPConn(conn *net.UDPConn, remoteAddr *net.UDPAddr, pendingWriteNum int, maxMsgLen uint32, idleTimeout time.Duration) *UDPConn {
+	udpConn := new(UDPConn)
+	udpConn.conn = conn
+	udpConn.remoteAddr = remoteAddr
+	udpConn.readChan = make(chan []byte, pendingWriteNum)
+	udpConn.writeChan = make(chan []byte, pendingWriteNum)
+	udpConn.closeChan = make(chan struct{})
+	udpConn.maxMsgLen = maxMsgLen
+	udpConn.idleTimeout = idleTimeout
+
+	go func() {
+		for b := range udpConn.writeChan {
+			if b == nil {
+				break
+			}
+
+			_, err := conn.WriteToUDP(b, remoteAddr)
+			if err != nil {
+				log.Debug("write to %v error: %v", remoteAddr, err)
+			}
+		}
+
+		udpConn.Lock()
+		udpConn.doClose()
+		udpConn.Unlock()
+	}()
+
+	return udpConn
+}
+
+func (udpConn *UDPConn) doClose() {
+	if udpConn.closeFlag {
+		return
+	}
+
+	close(udpConn.closeChan)
+	udpConn.closeFlag = true
+}
+
+func (udpConn *UDPConn) doDestroy() {
+	if !udpConn.closeFlag {
+		close(udpConn.writeChan)
+		udpConn.doClose()
+	}
+}
+
+func (udpConn *UDPConn) Destroy() {
+	udpConn.Lock()
+	defer udpConn.Unlock()
+
+	udpConn.doDestroy()
+}
+
+// the shared socket is left open, only the session is closed
+func (udpConn *UDPConn) Close() {
+	udpConn.Lock()
+	defer udpConn.Unlock()
+	if udpConn.closeFlag {
+		return
+	}
+
+	udpConn.doWrite(nil)
+	udpConn.doClose()
+}
+
+func (udpConn *UDPConn) doWrite(b []byte) {
+	if len(udpConn.writeChan) == cap(udpConn.writeChan) {
+		log.Debug("close conn: channel full")
+		udpConn.doDestroy()
+		return
+	}
+
+	udpConn.writeChan <- b
+}
+
+// called by the server read loop, the datagram is dropped if the session is busy
+func (udpConn *UDPConn) deliver(b []byte) {
+	select {
+	case udpConn.readChan <- b:
+	default:
+		log.Debug("drop datagram from %v: channel full", udpConn.remoteAddr)
+	}
+}
+
+func (udpConn *UDPConn) LocalAddr() net.Addr {
+	return udpConn.conn.LocalAddr()
+}
+
+func (udpConn *UDPConn) RemoteAddr() net.Addr {
+	return udpConn.remoteAddr
+}
+
+// goroutine safe
+func (udpConn *UDPConn) PendingWrites() int {
+	return len(udpConn.writeChan)
+}
+
+// goroutine safe
+func (udpConn *UDPConn) PendingWriteCap() int {
+	return cap(udpConn.writeChan)
+}
+
+// goroutine not safe
+func (udpConn *UDPConn) ReadMsg() ([]byte, error) {
+	var timeout <-chan time.Time
+	if udpConn.idleTimeout > 0 {
+		t := time.NewTimer(udpConn.idleTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case b := <-udpConn.readChan:
+		return b, nil
+	case <-udpConn.closeChan:
+		return nil, errors.New("use of closed udp session")
+	case <-timeout:
+		return nil, errors.New("udp session idle timeout")
+	}
+}
+
+// args must not be modified by the others goroutines
+func (udpConn *UDPConn) WriteMsg(args ...[]byte) error {
+	udpConn.Lock()
+	defer udpConn.Unlock()
+	if udpConn.closeFlag {
+		return nil
+	}
+
+	// get len
+	var msgLen uint32
+	for i := 0; i < len(args); i++ {
+		msgLen += uint32(len(args[i]))
+	}
+
+	// check len
+	if msgLen > udpConn.maxMsgLen {
+		return errors.New("message too long")
+	} else if msgLen < 1 {
+		return errors.New("message too short")
+	}
+
+	// don't copy
+	if len(args) == 1 {
+		udpConn.doWrite(args[0])
+		return nil
+	}
+
+	// merge the args
+	msg := make([]byte, msgLen)
+	l := 0
+	for i := 0; i < len(args); i++ {
+		copy(msg[l:], args[i])
+		l += len(args[i])
+	}
+
+	udpConn.doWrite(msg)
+
+	return nil
+}
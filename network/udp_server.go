@@ -0,0 +1,153 @@
+package network
+
+import (
+	"github.com/name5566/leaf/log"
+	"net"
+	"sync"
+	"time"
+)
+
+// every remote address is a session with its own agent,
+// the session ends when no datagram arrives within IdleTimeout
+type UDPServer struct {
+	Addr            string
+	MaxConnNum      int
+	PendingWriteNum int
+	MaxMsgLen       uint32
+	IdleTimeout     time.Duration
+	NewAgent        func(*UDPConn) Agent
+	conn            *net.UDPConn
+	conns           map[string]*UDPConn
+	mutexConns      sync.Mutex
+	wgLn            sync.WaitGroup
+	wgConns         sync.WaitGroup
+}
+
+func (server *UDPServer) Start() {
+	server.init()
+	go server.run()
+}
+
+func (server *UDPServer) init() {
+	addr, err := net.ResolveUDPAddr("udp", server.Addr)
+	if err != nil {
+		log.Fatal("%v", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		log.Fatal("%v", err)
+	}
+
+	if server.MaxConnNum <= 0 {
+		server.MaxConnNum = 100
+		log.Release("invalid MaxConnNum, reset to %v", server.MaxConnNum)
+	}
+	if server.PendingWriteNum <= 0 {
+		server.PendingWriteNum = 100
+		log.Release("invalid PendingWriteNum, reset to %v", server.PendingWriteNum)
+	}
+	if server.MaxMsgLen <= 0 {
+		server.MaxMsgLen = 4096
+		log.Release("invalid MaxMsgLen, reset to %v", server.MaxMsgLen)
+	}
+	if server.IdleTimeout <= 0 {
+		server.IdleTimeout = 30 * time.Second
+		log.Release("invalid IdleTimeout, reset to %v", server.IdleTimeout)
+	}
+	if server.NewAgent == nil {
+		log.Fatal("NewAgent must not be nil")
+	}
+
+	server.conn = conn
+	server.conns = make(map[string]*UDPConn)
+}
+
+func (server *UDPServer) run() {
+	server.wgLn.Add(1)
+	defer server.wgLn.Done()
+
+	buf := make([]byte, server.MaxMsgLen+1)
+	for {
+		n, addr, err := server.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		if n == 0 {
+			continue
+		}
+		if uint32(n) > server.MaxMsgLen {
+			log.Debug("drop datagram from %v: message too long", addr)
+			continue
+		}
+
+		b := make([]byte, n)
+		copy(b, buf[:n])
+
+		udpConn, isNew := server.session(addr)
+		if udpConn == nil {
+			continue
+		}
+		udpConn.deliver(b)
+		if isNew {
+			server.serve(udpConn)
+		}
+	}
+}
+
+func (server *UDPServer) session(addr *net.UDPAddr) (*UDPConn, bool) {
+	key := addr.String()
+
+	server.mutexConns.Lock()
+	defer server.mutexConns.Unlock()
+	if server.conns == nil {
+		return nil, false
+	}
+	if udpConn, ok := server.conns[key]; ok {
+		return udpConn, false
+	}
+	if len(server.conns) >= server.MaxConnNum {
+		log.Debug("too many connections")
+		return nil, false
+	}
+
+	udpConn := newUDPConn(server.conn, addr, server.PendingWriteNum, server.MaxMsgLen, server.IdleTimeout)
+	server.conns[key] = udpConn
+	server.wgConns.Add(1)
+	return udpConn, true
+}
+
+func (server *UDPServer) serve(udpConn *UDPConn) {
+	agent := server.NewAgent(udpConn)
+	go func() {
+		agent.Run()
+
+		// cleanup
+		udpConn.Close()
+		server.mutexConns.Lock()
+		delete(server.conns, udpConn.remoteAddr.String())
+		server.mutexConns.Unlock()
+		agent.OnClose()
+
+		server.wgConns.Done()
+	}()
+}
+
+func (server *UDPServer) Close() {
+	server.conn.Close()
+	server.wgLn.Wait()
+
+	server.mutexConns.Lock()
+	for _, udpConn := range server.conns {
+		udpConn.Close()
+	}
+	server.conns = nil
+	server.mutexConns.Unlock()
+	server.wgConns.Wait()
+}
+
+func (server *UDPServer) LocalAddr() net.Addr {
+	return server.conn.LocalAddr()
+}
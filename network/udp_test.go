@@ -0,0 +1,108 @@
+package network_test
+
+import (
+	"github.com/name5566/leaf/network"
+	"github.com/name5566/leaf/network/json"
+	"net"
+	"testing"
+	"time"
+)
+
+type Hello struct {
+	Name string
+}
+
+type udpAgent struct {
+	conn      network.Conn
+	processor network.Processor
+}
+
+func (a *udpAgent) Run() {
+	for {
+		data, err := a.conn.ReadMsg()
+		if err != nil {
+			return
+		}
+		msg, err := a.processor.Unmarshal(data)
+		if err != nil {
+			continue
+		}
+		a.processor.Route(msg, a)
+	}
+}
+
+func (a *udpAgent) OnClose() {}
+
+func TestUDPServer(t *testing.T) {
+	processor := json.NewProcessor()
+	processor.Register(&Hello{})
+
+	received := make(chan string, 10)
+	processor.SetHandler(&Hello{}, func(args []interface{}) {
+		msg := args[0].(*Hello)
+		a := args[1].(*udpAgent)
+		received <- msg.Name
+
+		data, err := processor.Marshal(msg)
+		if err == nil {
+			a.conn.WriteMsg(data...)
+		}
+	})
+
+	closed := make(chan struct{}, 10)
+	server := new(network.UDPServer)
+	server.Addr = "127.0.0.1:0"
+	server.IdleTimeout = 100 * time.Millisecond
+	server.NewAgent = func(conn *network.UDPConn) network.Agent {
+		return &closeAgent{&udpAgent{conn: conn, processor: processor}, closed}
+	}
+	server.Start()
+	defer server.Close()
+
+	client, err := net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for _, name := range []string{"a", "b"} {
+		if _, err := client.Write([]byte(`{"Hello": {"Name": "` + name + `"}}`)); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case got := <-received:
+			if got != name {
+				t.Fatalf("got %v, want %v", got, name)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("message not dispatched")
+		}
+
+		buf := make([]byte, 4096)
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := client.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := processor.Unmarshal(buf[:n])
+		if err != nil || msg.(*Hello).Name != name {
+			t.Fatalf("unexpected reply %q: %v", buf[:n], err)
+		}
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("session not closed after idle timeout")
+	}
+}
+
+type closeAgent struct {
+	*udpAgent
+	closed chan struct{}
+}
+
+func (a *closeAgent) OnClose() {
+	a.closed <- struct{}{}
+}
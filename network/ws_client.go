@@ -17,6 +17,7 @@ type WSClient struct {
 	HandshakeTimeout time.Duration
 	AutoReconnect    bool
 	NewAgent         func(*WSConn) Agent
+	FrameLogger      FrameLogger
 	dialer           websocket.Dialer
 	conns            WebsocketConnSet
 	wg               sync.WaitGroup
@@ -103,6 +104,7 @@ reconnect:
 	client.Unlock()
 
 	wsConn := newWSConn(conn, client.PendingWriteNum, client.MaxMsgLen)
+	wsConn.frameLogger = client.FrameLogger
 	agent := client.NewAgent(wsConn)
 	agent.Run()
 
@@ -0,0 +1,107 @@
+package network_test
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/name5566/leaf/network"
+	"testing"
+	"time"
+)
+
+type closeStatus struct {
+	code   int
+	reason string
+}
+
+// closes the connection with the status of the first message, "kick"
+type wsCloseAgent struct {
+	conn   *network.WSConn
+	closed chan closeStatus
+}
+
+func (a *wsCloseAgent) Run() {
+	for {
+		data, err := a.conn.ReadMsg()
+		if err != nil {
+			return
+		}
+		if string(data) == "kick" {
+			a.conn.CloseWithStatus(4001, "kicked")
+		}
+	}
+}
+
+func (a *wsCloseAgent) OnClose() {
+	code, reason := a.conn.CloseStatus()
+	a.closed <- closeStatus{code, reason}
+}
+
+func startCloseServer(t *testing.T) (*network.WSServer, chan closeStatus) {
+	closed := make(chan closeStatus, 1)
+	server := new(network.WSServer)
+	server.Addr = freeAddr(t)
+	server.NewAgent = func(conn *network.WSConn) network.Agent {
+		return &wsCloseAgent{conn, closed}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, closed
+}
+
+func waitClose(t *testing.T, closed chan closeStatus) closeStatus {
+	select {
+	case s := <-closed:
+		return s
+	case <-time.After(time.Second):
+		t.Fatal("agent not closed")
+	}
+	return closeStatus{}
+}
+
+func TestWSConn_ClientClose(t *testing.T) {
+	server, closed := startCloseServer(t)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+server.Addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	msg := websocket.FormatCloseMessage(4000, "bye")
+	if err := conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if s := waitClose(t, closed); s.code != 4000 || s.reason != "bye" {
+		t.Fatalf("unexpected close status %v", s)
+	}
+
+	// abrupt drop
+	conn2, _, err := websocket.DefaultDialer.Dial("ws://"+server.Addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn2.Close()
+	if s := waitClose(t, closed); s.code != websocket.CloseAbnormalClosure {
+		t.Fatalf("unexpected close status %v", s)
+	}
+}
+
+func TestWSConn_ServerClose(t *testing.T) {
+	server, closed := startCloseServer(t)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+server.Addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte("kick")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = conn.ReadMessage()
+	ce, ok := err.(*websocket.CloseError)
+	if !ok || ce.Code != 4001 || ce.Text != "kicked" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	waitClose(t, closed)
+}
@@ -1,21 +1,30 @@
 package network
 
 import (
+	"crypto/tls"
 	"errors"
 	"github.com/gorilla/websocket"
 	"github.com/name5566/leaf/log"
 	"net"
 	"sync"
+	"time"
 )
 
 type WebsocketConnSet map[*websocket.Conn]struct{}
 
 type WSConn struct {
 	sync.Mutex
-	conn      *websocket.Conn
-	writeChan chan []byte
-	maxMsgLen uint32
-	closeFlag bool
+	conn        *websocket.Conn
+	writeChan   chan []byte
+	maxMsgLen   uint32
+	closeFlag   bool
+	frameLogger FrameLogger
+	msgSizes    *msgSizes
+	closeCode   int
+	closeReason string
+	// received from the peer
+	peerCloseCode   int
+	peerCloseReason string
 }
 
 func newWSConn(conn *websocket.Conn, pendingWriteNum int, maxMsgLen uint32) *WSConn {
@@ -23,10 +32,15 @@ func newWSConn(conn *websocket.Conn, pendingWriteNum int, maxMsgLen uint32) *WSC
 	wsConn.conn = conn
 	wsConn.writeChan = make(chan []byte, pendingWriteNum)
 	wsConn.maxMsgLen = maxMsgLen
+	wsConn.closeCode = websocket.CloseNormalClosure
 
 	go func() {
 		for b := range wsConn.writeChan {
 			if b == nil {
+				wsConn.Lock()
+				msg := websocket.FormatCloseMessage(wsConn.closeCode, wsConn.closeReason)
+				wsConn.Unlock()
+				conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
 				break
 			}
 
@@ -46,7 +60,9 @@ func newWSConn(conn *websocket.Conn, pendingWriteNum int, maxMsgLen uint32) *WSC
 }
 
 func (wsConn *WSConn) doDestroy() {
-	wsConn.conn.UnderlyingConn().(*net.TCPConn).SetLinger(0)
+	if tcpConn, ok := wsConn.conn.UnderlyingConn().(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
 	wsConn.conn.Close()
 
 	if !wsConn.closeFlag {
@@ -62,6 +78,8 @@ func (wsConn *WSConn) Destroy() {
 	wsConn.doDestroy()
 }
 
+// a close frame with the code set by SetCloseStatus is sent after
+// the pending messages, websocket.CloseNormalClosure by default
 func (wsConn *WSConn) Close() {
 	wsConn.Lock()
 	defer wsConn.Unlock()
@@ -73,6 +91,28 @@ func (wsConn *WSConn) Close() {
 	wsConn.closeFlag = true
 }
 
+// sets the code and reason of the close frame sent by Close
+func (wsConn *WSConn) SetCloseStatus(code int, reason string) {
+	wsConn.Lock()
+	defer wsConn.Unlock()
+	wsConn.closeCode = code
+	wsConn.closeReason = reason
+}
+
+func (wsConn *WSConn) CloseWithStatus(code int, reason string) {
+	wsConn.SetCloseStatus(code, reason)
+	wsConn.Close()
+}
+
+// the close code and reason sent by the peer, valid once ReadMsg failed
+// code is websocket.CloseAbnormalClosure if the connection was dropped
+// without a close frame, 0 if ReadMsg has not failed yet
+func (wsConn *WSConn) CloseStatus() (code int, reason string) {
+	wsConn.Lock()
+	defer wsConn.Unlock()
+	return wsConn.peerCloseCode, wsConn.peerCloseReason
+}
+
 func (wsConn *WSConn) doWrite(b []byte) {
 	if len(wsConn.writeChan) == cap(wsConn.writeChan) {
 		log.Debug("close conn: channel full")
@@ -91,9 +131,53 @@ func (wsConn *WSConn) RemoteAddr() net.Addr {
 	return wsConn.conn.RemoteAddr()
 }
 
+// the state of the handshake, false if the connection does not use TLS
+func (wsConn *WSConn) ConnectionState() (tls.ConnectionState, bool) {
+	if conn, ok := wsConn.conn.UnderlyingConn().(*tls.Conn); ok {
+		return conn.ConnectionState(), true
+	}
+	return tls.ConnectionState{}, false
+}
+
+// goroutine safe
+func (wsConn *WSConn) PendingWrites() int {
+	return len(wsConn.writeChan)
+}
+
+// goroutine safe
+func (wsConn *WSConn) PendingWriteCap() int {
+	return cap(wsConn.writeChan)
+}
+
+// the connection is unusable after a read timeout
+func (wsConn *WSConn) SetReadDeadline(t time.Time) error {
+	return wsConn.conn.SetReadDeadline(t)
+}
+
+// returns ErrMsgTooLongClose for a message longer than MaxMsgLen, the
+// connection cannot be read afterwards
 // goroutine not safe
 func (wsConn *WSConn) ReadMsg() ([]byte, error) {
 	_, b, err := wsConn.conn.ReadMessage()
+	if err == websocket.ErrReadLimit {
+		return nil, ErrMsgTooLongClose
+	}
+	if err != nil {
+		code, reason := websocket.CloseAbnormalClosure, ""
+		if ce, ok := err.(*websocket.CloseError); ok {
+			code, reason = ce.Code, ce.Text
+		}
+		wsConn.Lock()
+		if wsConn.peerCloseCode == 0 {
+			wsConn.peerCloseCode, wsConn.peerCloseReason = code, reason
+		}
+		wsConn.Unlock()
+	} else {
+		wsConn.msgSizes.record(FrameIn, b)
+		if wsConn.frameLogger != nil {
+			logFrame(wsConn.frameLogger, FrameIn, b)
+		}
+	}
 	return b, err
 }
 
@@ -118,6 +202,11 @@ func (wsConn *WSConn) WriteMsg(args ...[]byte) error {
 		return errors.New("message too short")
 	}
 
+	wsConn.msgSizes.record(FrameOut, args...)
+	if wsConn.frameLogger != nil {
+		logFrame(wsConn.frameLogger, FrameOut, args...)
+	}
+
 	// don't copy
 	if len(args) == 1 {
 		wsConn.doWrite(args[0])
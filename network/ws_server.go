@@ -10,8 +10,10 @@ import (
 	"time"
 )
 
+// Network is "tcp" (default), "tcp4" or "tcp6", see TCPServer
 type WSServer struct {
 	Addr            string
+	Network         string
 	MaxConnNum      int
 	PendingWriteNum int
 	MaxMsgLen       uint32
@@ -19,6 +21,9 @@ type WSServer struct {
 	CertFile        string
 	KeyFile         string
 	NewAgent        func(*WSConn) Agent
+	FrameLogger     FrameLogger
+	CloseCode       int
+	CloseReason     string
 	ln              net.Listener
 	handler         *WSHandler
 }
@@ -28,8 +33,13 @@ type WSHandler struct {
 	pendingWriteNum int
 	maxMsgLen       uint32
 	newAgent        func(*WSConn) Agent
+	frameLogger     FrameLogger
+	msgSizes        msgSizes
+	closeCode       int
+	closeReason     string
 	upgrader        websocket.Upgrader
 	conns           WebsocketConnSet
+	wsConns         map[*WSConn]struct{}
 	mutexConns      sync.Mutex
 	wg              sync.WaitGroup
 }
@@ -61,10 +71,14 @@ func (handler *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		log.Debug("too many connections")
 		return
 	}
+	wsConn := newWSConn(conn, handler.pendingWriteNum, handler.maxMsgLen)
+	wsConn.frameLogger = handler.frameLogger
+	wsConn.msgSizes = &handler.msgSizes
+	wsConn.SetCloseStatus(handler.closeCode, handler.closeReason)
 	handler.conns[conn] = struct{}{}
+	handler.wsConns[wsConn] = struct{}{}
 	handler.mutexConns.Unlock()
 
-	wsConn := newWSConn(conn, handler.pendingWriteNum, handler.maxMsgLen)
 	agent := handler.newAgent(wsConn)
 	agent.Run()
 
@@ -72,12 +86,16 @@ func (handler *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	wsConn.Close()
 	handler.mutexConns.Lock()
 	delete(handler.conns, conn)
+	delete(handler.wsConns, wsConn)
 	handler.mutexConns.Unlock()
 	agent.OnClose()
 }
 
 func (server *WSServer) Start() {
-	ln, err := net.Listen("tcp", server.Addr)
+	if server.Network == "" {
+		server.Network = "tcp"
+	}
+	ln, err := net.Listen(server.Network, server.Addr)
 	if err != nil {
 		log.Fatal("%v", err)
 	}
@@ -98,6 +116,9 @@ func (server *WSServer) Start() {
 		server.HTTPTimeout = 10 * time.Second
 		log.Release("invalid HTTPTimeout, reset to %v", server.HTTPTimeout)
 	}
+	if server.CloseCode <= 0 {
+		server.CloseCode = websocket.CloseNormalClosure
+	}
 	if server.NewAgent == nil {
 		log.Fatal("NewAgent must not be nil")
 	}
@@ -122,7 +143,11 @@ func (server *WSServer) Start() {
 		pendingWriteNum: server.PendingWriteNum,
 		maxMsgLen:       server.MaxMsgLen,
 		newAgent:        server.NewAgent,
+		frameLogger:     server.FrameLogger,
+		closeCode:       server.CloseCode,
+		closeReason:     server.CloseReason,
 		conns:           make(WebsocketConnSet),
+		wsConns:         make(map[*WSConn]struct{}),
 		upgrader: websocket.Upgrader{
 			HandshakeTimeout: server.HTTPTimeout,
 			CheckOrigin:      func(_ *http.Request) bool { return true },
@@ -140,15 +165,48 @@ func (server *WSServer) Start() {
 	go httpServer.Serve(ln)
 }
 
+// the sizes of the messages read and written by the connections
+// you must call the function after calling Start
+// goroutine safe
+func (server *WSServer) MsgSizeStats() MsgSizeStats {
+	return server.handler.msgSizes.stats()
+}
+
+// a snapshot of the connections
+// goroutine safe
+func (server *WSServer) Conns() []*WSConn {
+	server.handler.mutexConns.Lock()
+	defer server.handler.mutexConns.Unlock()
+
+	conns := make([]*WSConn, 0, len(server.handler.wsConns))
+	for conn := range server.handler.wsConns {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
 func (server *WSServer) Close() {
 	server.ln.Close()
 
 	server.handler.mutexConns.Lock()
-	for conn := range server.handler.conns {
-		conn.Close()
-	}
+	conns := server.handler.conns
 	server.handler.conns = nil
+	server.handler.wsConns = nil
 	server.handler.mutexConns.Unlock()
 
+	// the peers not reading do not delay one another
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown")
+	deadline := time.Now().Add(time.Second)
+	var wg sync.WaitGroup
+	for conn := range conns {
+		wg.Add(1)
+		go func(conn *websocket.Conn) {
+			defer wg.Done()
+			conn.WriteControl(websocket.CloseMessage, msg, deadline)
+			conn.Close()
+		}(conn)
+	}
+	wg.Wait()
+
 	server.handler.wg.Wait()
 }
@@ -0,0 +1,88 @@
+package profiler
+
+import (
+	"context"
+	"github.com/name5566/leaf/conf"
+	"github.com/name5566/leaf/log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// serves net/http/pprof, disabled unless Addr or conf.PprofAddr is set
+type Module struct {
+	// defaults to conf.PprofAddr, an empty host means loopback
+	Addr string
+	// allows binding to a non-loopback interface
+	AllowPublic bool
+	httpServer  *http.Server
+}
+
+func (m *Module) OnInit() {
+	if m.Addr == "" {
+		m.Addr = conf.PprofAddr
+	}
+	if m.Addr == "" {
+		return
+	}
+	if conf.PprofAllowPublic {
+		m.AllowPublic = true
+	}
+
+	host, port, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		log.Error("invalid pprof addr %v: %v", m.Addr, err)
+		return
+	}
+	if host == "" {
+		host = "127.0.0.1"
+		m.Addr = net.JoinHostPort(host, port)
+	}
+	if !m.AllowPublic && !isLoopback(host) {
+		log.Error("refuse to serve pprof on public addr %v", m.Addr)
+		return
+	}
+
+	ln, err := net.Listen("tcp", m.Addr)
+	if err != nil {
+		log.Error("%v", err)
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	m.httpServer = &http.Server{Handler: mux}
+	go m.httpServer.Serve(ln)
+	log.Release("pprof listening on %v", ln.Addr())
+}
+
+func (m *Module) Run(closeSig chan bool) {
+	<-closeSig
+}
+
+func (m *Module) OnDestroy() {
+	if m.httpServer == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.httpServer.Shutdown(ctx); err != nil {
+		m.httpServer.Close()
+	}
+	m.httpServer = nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
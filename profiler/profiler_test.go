@@ -0,0 +1,60 @@
+package profiler
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestModule(t *testing.T) {
+	m := &Module{Addr: freeAddr(t)}
+	m.OnInit()
+
+	resp, err := http.Get("http://" + m.Addr + "/debug/pprof/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %v", resp.StatusCode)
+	}
+
+	m.OnDestroy()
+	if _, err := http.Get("http://" + m.Addr + "/debug/pprof/"); err == nil {
+		t.Fatal("pprof still served after destroy")
+	}
+}
+
+func TestModule_Public(t *testing.T) {
+	m := &Module{Addr: "0.0.0.0:0"}
+	m.OnInit()
+	if m.httpServer != nil {
+		m.OnDestroy()
+		t.Fatal("public addr accepted")
+	}
+
+	m = &Module{Addr: "0.0.0.0:0", AllowPublic: true}
+	m.OnInit()
+	if m.httpServer == nil {
+		t.Fatal("public addr refused")
+	}
+	m.OnDestroy()
+}
+
+func TestModule_Disabled(t *testing.T) {
+	m := new(Module)
+	m.OnInit()
+	if m.httpServer != nil {
+		t.Fatal("pprof served without addr")
+	}
+	m.OnDestroy()
+}
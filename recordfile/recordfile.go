@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 )
 
 var Comma = '\t'
@@ -19,6 +22,8 @@ type RecordFile struct {
 	Comma      rune
 	Comment    rune
 	typeRecord reflect.Type
+	enums      map[int]map[string]int64
+	jsonFields map[int]bool
 	records    []interface{}
 	indexes    []Index
 }
@@ -29,9 +34,21 @@ func New(st interface{}) (*RecordFile, error) {
 		return nil, errors.New("st must be a struct")
 	}
 
+	var enums map[int]map[string]int64
+	var jsonFields map[int]bool
+
 	for i := 0; i < typeRecord.NumField(); i++ {
 		f := typeRecord.Field(i)
 
+		// `recordfile:"json"`, the cell is JSON whatever the type of the field
+		if f.Tag.Get("recordfile") == "json" {
+			if jsonFields == nil {
+				jsonFields = make(map[int]bool)
+			}
+			jsonFields[i] = true
+			continue
+		}
+
 		kind := f.Type.Kind()
 		switch kind {
 		case reflect.Bool:
@@ -65,14 +82,61 @@ func New(st interface{}) (*RecordFile, error) {
 					kind, i, f.Name)
 			}
 		}
+
+		if opt, ok := tag.Lookup("recordfile"); ok {
+			enum, err := parseEnum(opt)
+			if err != nil {
+				return nil, fmt.Errorf("field %v %v: %v", i, f.Name, err)
+			}
+			switch kind {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			default:
+				return nil, fmt.Errorf("enum field %v %v must be an int", i, f.Name)
+			}
+			for name, v := range enum {
+				if reflect.Zero(f.Type).OverflowInt(v) {
+					return nil, fmt.Errorf("enum %v overflows field %v %v", name, i, f.Name)
+				}
+			}
+			if enums == nil {
+				enums = make(map[int]map[string]int64)
+			}
+			enums[i] = enum
+		}
 	}
 
 	rf := new(RecordFile)
 	rf.typeRecord = typeRecord
+	rf.enums = enums
+	rf.jsonFields = jsonFields
 
 	return rf, nil
 }
 
+// `recordfile:"enum=FIRE:1,WATER:2"`
+func parseEnum(opt string) (map[string]int64, error) {
+	if !strings.HasPrefix(opt, "enum=") {
+		return nil, fmt.Errorf("invalid tag: %v", opt)
+	}
+
+	enum := make(map[string]int64)
+	for _, pair := range strings.Split(strings.TrimPrefix(opt, "enum="), ",") {
+		name, value, ok := strings.Cut(pair, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid enum: %v", pair)
+		}
+		v, err := strconv.ParseInt(value, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid enum: %v", pair)
+		}
+		if _, ok := enum[name]; ok {
+			return nil, fmt.Errorf("duplicate enum: %v", name)
+		}
+		enum[name] = v
+	}
+	return enum, nil
+}
+
 func (rf *RecordFile) Read(name string) error {
 	file, err := os.Open(name)
 	if err != nil {
@@ -80,6 +144,32 @@ func (rf *RecordFile) Read(name string) error {
 	}
 	defer file.Close()
 
+	return rf.read(file)
+}
+
+func (rf *RecordFile) ReadFS(fsys fs.FS, name string) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return rf.read(file)
+}
+
+func ReadFromFS(fsys fs.FS, name string, st interface{}) (*RecordFile, error) {
+	rf, err := New(st)
+	if err != nil {
+		return nil, err
+	}
+	err = rf.ReadFS(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RecordFile) read(file io.Reader) error {
 	if rf.Comma == 0 {
 		rf.Comma = Comma
 	}
@@ -134,7 +224,15 @@ func (rf *RecordFile) Read(name string) error {
 			var err error
 
 			kind := f.Type.Kind()
-			if kind == reflect.Bool {
+			if rf.jsonFields[i] {
+				err = json.Unmarshal([]byte(strField), field.Addr().Interface())
+			} else if enum, ok := rf.enums[i]; ok {
+				if v, ok := enum[strField]; ok {
+					field.SetInt(v)
+				} else {
+					err = fmt.Errorf("unknown enum value %q", strField)
+				}
+			} else if kind == reflect.Bool {
 				var v bool
 				v, err = strconv.ParseBool(strField)
 				if err == nil {
@@ -0,0 +1,149 @@
+package recordfile_test
+
+import (
+	"github.com/name5566/leaf/recordfile"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+type fsRecord struct {
+	IndexInt int
+	IndexStr string
+	Number   int32
+	Str      string
+	Arr1     [2]int
+	Arr2     [3][2]int
+	Arr3     []int
+	St       struct {
+		Name string
+		Num  int
+	}
+	M map[string]int
+}
+
+func TestReadFromFS(t *testing.T) {
+	data, err := os.ReadFile("test.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{"data/test.txt": {Data: data}}
+
+	rf, err := recordfile.ReadFromFS(fsys, "data/test.txt", fsRecord{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	disk, err := recordfile.New(fsRecord{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := disk.Read("test.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if rf.NumRecord() != 3 || rf.NumRecord() != disk.NumRecord() {
+		t.Fatalf("got %v records, want %v", rf.NumRecord(), disk.NumRecord())
+	}
+	for i := 0; i < rf.NumRecord(); i++ {
+		if !reflect.DeepEqual(rf.Record(i), disk.Record(i)) {
+			t.Errorf("record %v: got %+v, want %+v", i, rf.Record(i), disk.Record(i))
+		}
+	}
+
+	if _, err := recordfile.ReadFromFS(fsys, "missing.txt", fsRecord{}); err == nil {
+		t.Fatal("missing file not reported")
+	}
+}
+
+type enumRecord struct {
+	ID      int
+	Element int8 `recordfile:"enum=FIRE:1,WATER:2"`
+	Name    string
+}
+
+func TestRecordFile_Enum(t *testing.T) {
+	fsys := fstest.MapFS{
+		"valid.txt":   {Data: []byte("ID\tElement\tName\n1\tFIRE\tsalamander\n2\tWATER\tundine\n")},
+		"invalid.txt": {Data: []byte("ID\tElement\tName\n1\tFIRE\tsalamander\n2\tEARTH\tgnome\n")},
+	}
+
+	rf, err := recordfile.ReadFromFS(fsys, "valid.txt", enumRecord{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int8{1, 2} {
+		r := rf.Record(i).(*enumRecord)
+		if r.Element != want {
+			t.Errorf("record %v: got element %v, want %v", r.ID, r.Element, want)
+		}
+	}
+
+	_, err = recordfile.ReadFromFS(fsys, "invalid.txt", enumRecord{})
+	if err == nil || !strings.Contains(err.Error(), "row=2, col=1") ||
+		!strings.Contains(err.Error(), `"EARTH"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, st := range []interface{}{
+		struct {
+			E string `recordfile:"enum=FIRE:1"`
+		}{},
+		struct {
+			E int `recordfile:"enum=FIRE"`
+		}{},
+		struct {
+			E int `recordfile:"enum=FIRE:1,FIRE:2"`
+		}{},
+		struct {
+			E int8 `recordfile:"enum=FIRE:1000"`
+		}{},
+	} {
+		if _, err := recordfile.New(st); err == nil {
+			t.Errorf("invalid enum %T accepted", st)
+		}
+	}
+}
+
+type dropRecord struct {
+	ID    int
+	Items []int `recordfile:"json"`
+	Boss  *struct {
+		Name string
+		HP   int
+	} `recordfile:"json"`
+	Extra interface{} `recordfile:"json"`
+}
+
+func TestRecordFile_JSON(t *testing.T) {
+	fsys := fstest.MapFS{
+		"valid.txt": {Data: []byte("ID\tItems\tBoss\tExtra\n" +
+			"1\t[101, 102]\t\"{\"\"Name\"\": \"\"orc\"\", \"\"HP\"\": 500}\"\t\"{\"\"weight\"\": 2}\"\n" +
+			"2\t[]\tnull\t\"\"\"none\"\"\"\n")},
+		"invalid.txt": {Data: []byte("ID\tItems\tBoss\tExtra\n" +
+			"1\t[101, 102]\tnull\t1\n" +
+			"2\t[101,\tnull\t1\n")},
+	}
+
+	rf, err := recordfile.ReadFromFS(fsys, "valid.txt", dropRecord{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rf.Record(0).(*dropRecord)
+	if !reflect.DeepEqual(r.Items, []int{101, 102}) || r.Boss == nil ||
+		r.Boss.Name != "orc" || r.Boss.HP != 500 ||
+		!reflect.DeepEqual(r.Extra, map[string]interface{}{"weight": 2.0}) {
+		t.Fatalf("unexpected record %+v", r)
+	}
+	r = rf.Record(1).(*dropRecord)
+	if len(r.Items) != 0 || r.Boss != nil || r.Extra != "none" {
+		t.Fatalf("unexpected record %+v", r)
+	}
+
+	_, err = recordfile.ReadFromFS(fsys, "invalid.txt", dropRecord{})
+	if err == nil || !strings.Contains(err.Error(), "row=2, col=1") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
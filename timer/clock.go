@@ -0,0 +1,103 @@
+package timer
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Stopper
+}
+
+type Stopper interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Stopper {
+	return time.AfterFunc(d, f)
+}
+
+// a Clock which only moves on Advance, for tests
+// goroutine safe
+type MockClock struct {
+	sync.Mutex
+	now    time.Time
+	timers []*mockTimer
+}
+
+type mockTimer struct {
+	clock *MockClock
+	when  time.Time
+	f     func()
+}
+
+func NewMockClock(now time.Time) *MockClock {
+	c := new(MockClock)
+	c.now = now
+	return c
+}
+
+func (c *MockClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *MockClock) AfterFunc(d time.Duration, f func()) Stopper {
+	c.Lock()
+	defer c.Unlock()
+
+	t := &mockTimer{clock: c, when: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *mockTimer) Stop() bool {
+	c := t.clock
+	c.Lock()
+	defer c.Unlock()
+
+	for i, _t := range c.timers {
+		if _t == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// moves the clock forward and fires the expired timers in order, on the
+// calling goroutine. A dispatcher timer blocks when its ChanTimer is full
+func (c *MockClock) Advance(d time.Duration) {
+	c.Lock()
+	end := c.now.Add(d)
+	c.Unlock()
+
+	for {
+		c.Lock()
+		sort.SliceStable(c.timers, func(i, j int) bool {
+			return c.timers[i].when.Before(c.timers[j].when)
+		})
+		if len(c.timers) == 0 || c.timers[0].when.After(end) {
+			c.now = end
+			c.Unlock()
+			return
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		c.Unlock()
+
+		t.f()
+	}
+}
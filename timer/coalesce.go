@@ -0,0 +1,61 @@
+package timer
+
+import (
+	"sort"
+	"time"
+)
+
+// the timers expiring within window of the first one are sent to ChanTimer
+// together as a single Timer, so a callback is delayed by at most window
+// the callbacks of a batch are called in the order of their expiry, a
+// panicking one does not prevent the others
+// window 0 (default) sends each timer on its own
+// you must call the function before calling AfterFunc
+func (disp *Dispatcher) SetCoalesce(window time.Duration) {
+	disp.coalesce = window
+}
+
+// called on the goroutine of the clock
+func (disp *Dispatcher) coalesceTimer(t *Timer) {
+	disp.mutexBatch.Lock()
+	defer disp.mutexBatch.Unlock()
+
+	disp.batch = append(disp.batch, t)
+	if len(disp.batch) == 1 {
+		disp.flushTimer = disp.clock.AfterFunc(disp.coalesce, disp.flush)
+	}
+}
+
+func (disp *Dispatcher) flush() {
+	disp.mutexBatch.Lock()
+	batch := disp.batch
+	disp.batch = nil
+	disp.flushTimer = nil
+	disp.mutexBatch.Unlock()
+
+	sort.SliceStable(batch, func(i, j int) bool {
+		return batch[i].when.Before(batch[j].when)
+	})
+
+	t := new(Timer)
+	t.cb = func() {
+		for _, _t := range batch {
+			_t.Cb()
+		}
+	}
+	select {
+	case disp.ChanTimer <- t:
+	case <-disp.closed:
+	}
+}
+
+func (disp *Dispatcher) stopFlush() {
+	disp.mutexBatch.Lock()
+	defer disp.mutexBatch.Unlock()
+
+	if disp.flushTimer != nil {
+		disp.flushTimer.Stop()
+		disp.flushTimer = nil
+	}
+	disp.batch = nil
+}
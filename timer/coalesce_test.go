@@ -0,0 +1,78 @@
+package timer_test
+
+import (
+	"github.com/name5566/leaf/timer"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_SetCoalesce(t *testing.T) {
+	clock := timer.NewMockClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	disp := timer.NewDispatcherWithClock(10, clock)
+	disp.SetCoalesce(10 * time.Millisecond)
+
+	var fired []int
+	// created in reverse order of expiry
+	for i := 99; i >= 0; i-- {
+		i := i
+		disp.AfterFunc(time.Second+time.Duration(i)*50*time.Microsecond, func() {
+			fired = append(fired, i)
+		})
+	}
+	stopped := disp.AfterFunc(time.Second, func() { fired = append(fired, -1) })
+	disp.AfterFunc(time.Second, func() { panic("bad callback") })
+	late := false
+	disp.AfterFunc(time.Second+20*time.Millisecond, func() { late = true })
+
+	clock.Advance(time.Second + 5*time.Millisecond)
+	if len(disp.ChanTimer) != 0 {
+		t.Fatal("batch sent before the window")
+	}
+	// expired, waiting for the batch
+	stopped.Stop()
+
+	clock.Advance(5 * time.Millisecond)
+	if n := len(disp.ChanTimer); n != 1 {
+		t.Fatalf("%v timers sent, want 1 batch", n)
+	}
+	(<-disp.ChanTimer).Cb()
+	if len(fired) != 100 {
+		t.Fatalf("%v callbacks called, want 100", len(fired))
+	}
+	for i, v := range fired {
+		if v != i {
+			t.Fatalf("got %v at %v, want the order of expiry", v, i)
+		}
+	}
+	if late {
+		t.Fatal("timer after the window in the batch")
+	}
+
+	clock.Advance(30 * time.Millisecond)
+	if n := len(disp.ChanTimer); n != 1 {
+		t.Fatalf("%v timers sent, want 1 batch", n)
+	}
+	(<-disp.ChanTimer).Cb()
+	if !late {
+		t.Fatal("timer after the window not fired")
+	}
+}
+
+func TestDispatcher_SetCoalesceClose(t *testing.T) {
+	clock := timer.NewMockClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	disp := timer.NewDispatcherWithClock(10, clock)
+	disp.SetCoalesce(10 * time.Millisecond)
+
+	fired := false
+	disp.AfterFunc(time.Second, func() { fired = true })
+	clock.Advance(time.Second)
+	disp.Close()
+
+	clock.Advance(time.Second)
+	for len(disp.ChanTimer) > 0 {
+		(<-disp.ChanTimer).Cb()
+	}
+	if fired {
+		t.Fatal("batched timer fired after Close")
+	}
+}
@@ -0,0 +1,64 @@
+package timer_test
+
+import (
+	"github.com/name5566/leaf/timer"
+	"testing"
+	"time"
+)
+
+// the offsets from start at which the timers fire, with a minute resolution
+func fireOffsets(seed int64, n int, d, jitter time.Duration) []time.Duration {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := timer.NewMockClock(start)
+	disp := timer.NewDispatcherWithClock(n, clock)
+	disp.SetJitterSeed(seed)
+
+	for i := 0; i < n; i++ {
+		disp.AfterFuncJitter(d, jitter, func() {})
+	}
+
+	var offsets []time.Duration
+	for len(offsets) < n && clock.Now().Sub(start) <= d+jitter {
+		clock.Advance(time.Minute)
+		for len(disp.ChanTimer) > 0 {
+			(<-disp.ChanTimer).Cb()
+			offsets = append(offsets, clock.Now().Sub(start))
+		}
+	}
+	return offsets
+}
+
+func TestDispatcher_AfterFuncJitter(t *testing.T) {
+	const n = 100
+	d, jitter := time.Hour, 10*time.Minute
+
+	offsets := fireOffsets(1, n, d, jitter)
+	if len(offsets) != n {
+		t.Fatalf("%v timers fired, want %v", len(offsets), n)
+	}
+
+	minutes := make(map[time.Duration]int)
+	for _, o := range offsets {
+		// the timer fires within the minute advanced
+		if o < d || o > d+jitter {
+			t.Fatalf("timer fired at %v, out of [%v, %v]", o, d, d+jitter)
+		}
+		minutes[o]++
+	}
+	if len(minutes) < 8 {
+		t.Fatalf("fires not spread: %v", minutes)
+	}
+	for m, count := range minutes {
+		if count > n/4 {
+			t.Fatalf("%v timers fired at %v", count, m)
+		}
+	}
+
+	// reproducible
+	again := fireOffsets(1, n, d, jitter)
+	for i := range offsets {
+		if offsets[i] != again[i] {
+			t.Fatalf("fire times differ with the same seed")
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package timer
+
+import (
+	"fmt"
+	"time"
+)
+
+// The next occurrence keeps the wall clock time in the location of t.
+// A time skipped by a DST transition is moved forward
+// (02:30 becomes 03:30 when clocks jump from 02:00 to 03:00),
+// a time repeated by a DST transition fires once.
+// goroutine safe
+func NextWeekly(t time.Time, weekday time.Weekday, hour, min int) time.Time {
+	days := (int(weekday) - int(t.Weekday()) + 7) % 7
+	for ; ; days += 7 {
+		next := clock(t.Year(), t.Month(), t.Day()+days, hour, min, t.Location())
+		if next.After(t) {
+			return next
+		}
+	}
+}
+
+// Same DST policy as NextWeekly. The day is clamped to the last day of
+// shorter months, day 31 fires on Feb 28 (or 29), Apr 30 and so on.
+// goroutine safe
+func NextMonthly(t time.Time, day, hour, min int) time.Time {
+	for months := 0; ; months++ {
+		// the first day of the month avoids normalization by time.Date
+		first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+		d := day
+		if last := daysIn(first.Year(), first.Month()); d > last {
+			d = last
+		}
+		next := clock(first.Year(), first.Month(), d, hour, min, t.Location())
+		if next.After(t) {
+			return next
+		}
+	}
+}
+
+func clock(year int, month time.Month, day, hour, min int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, min, 0, 0, loc)
+	if t.Hour() != hour || t.Minute() != min {
+		// skipped by DST, time.Date may normalize it backwards
+		t = time.Date(year, month, day, 0, 0, 0, 0, loc).
+			Add(time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute)
+	}
+	return t
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func checkClock(hour, min int) {
+	if hour < 0 || hour > 23 {
+		panic(fmt.Sprintf("invalid hour %v", hour))
+	}
+	if min < 0 || min > 59 {
+		panic(fmt.Sprintf("invalid minute %v", min))
+	}
+}
+
+func (disp *Dispatcher) WeeklyFunc(weekday time.Weekday, hour, min int, cb func()) *Cron {
+	if weekday < time.Sunday || weekday > time.Saturday {
+		panic(fmt.Sprintf("invalid weekday %v", int(weekday)))
+	}
+	checkClock(hour, min)
+
+	return disp.scheduleFunc(func(t time.Time) time.Time {
+		return NextWeekly(t, weekday, hour, min)
+	}, 0, cb)
+}
+
+func (disp *Dispatcher) MonthlyFunc(day, hour, min int, cb func()) *Cron {
+	if day < 1 || day > 31 {
+		panic(fmt.Sprintf("invalid day %v", day))
+	}
+	checkClock(hour, min)
+
+	return disp.scheduleFunc(func(t time.Time) time.Time {
+		return NextMonthly(t, day, hour, min)
+	}, 0, cb)
+}
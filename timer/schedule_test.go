@@ -0,0 +1,67 @@
+package timer_test
+
+import (
+	"github.com/name5566/leaf/timer"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestNextWeekly(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		now     time.Time
+		weekday time.Weekday
+		hour    int
+		min     int
+		want    time.Time
+	}{
+		// every Saturday 20:00
+		{time.Date(2024, 3, 6, 12, 0, 0, 0, loc), time.Saturday, 20, 0, time.Date(2024, 3, 9, 20, 0, 0, 0, loc)},
+		// the wall clock is kept across the DST transition on Mar 10
+		{time.Date(2024, 3, 9, 20, 0, 0, 0, loc), time.Saturday, 20, 0, time.Date(2024, 3, 16, 20, 0, 0, 0, loc)},
+		// 02:30 does not exist on Mar 10
+		{time.Date(2024, 3, 9, 12, 0, 0, 0, loc), time.Sunday, 2, 30, time.Date(2024, 3, 10, 3, 30, 0, 0, loc)},
+		// later on the same day
+		{time.Date(2024, 3, 6, 12, 0, 0, 0, loc), time.Wednesday, 12, 1, time.Date(2024, 3, 6, 12, 1, 0, 0, loc)},
+	}
+	for _, c := range cases {
+		got := timer.NextWeekly(c.now, c.weekday, c.hour, c.min)
+		if !got.Equal(c.want) {
+			t.Errorf("NextWeekly(%v, %v, %v, %v) = %v, want %v",
+				c.now, c.weekday, c.hour, c.min, got, c.want)
+		}
+	}
+
+	d := timer.NextWeekly(time.Date(2024, 3, 9, 20, 0, 0, 0, loc), time.Saturday, 20, 0).
+		Sub(time.Date(2024, 3, 9, 20, 0, 0, 0, loc))
+	if d != 7*24*time.Hour-time.Hour {
+		t.Errorf("got %v across DST, want %v", d, 7*24*time.Hour-time.Hour)
+	}
+}
+
+func TestNextMonthly(t *testing.T) {
+	cases := []struct {
+		now  time.Time
+		day  int
+		want time.Time
+	}{
+		// 1st of each month
+		{time.Date(2023, 1, 15, 0, 0, 0, 0, time.UTC), 1, time.Date(2023, 2, 1, 8, 0, 0, 0, time.UTC)},
+		// day 31 is clamped in short months
+		{time.Date(2023, 1, 31, 9, 0, 0, 0, time.UTC), 31, time.Date(2023, 2, 28, 8, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), 31, time.Date(2024, 2, 29, 8, 0, 0, 0, time.UTC)},
+		{time.Date(2023, 2, 28, 9, 0, 0, 0, time.UTC), 31, time.Date(2023, 3, 31, 8, 0, 0, 0, time.UTC)},
+		{time.Date(2023, 12, 31, 9, 0, 0, 0, time.UTC), 31, time.Date(2024, 1, 31, 8, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		got := timer.NextMonthly(c.now, c.day, 8, 0)
+		if !got.Equal(c.want) {
+			t.Errorf("NextMonthly(%v, %v) = %v, want %v", c.now, c.day, got, c.want)
+		}
+	}
+}
@@ -3,40 +3,113 @@ package timer
 import (
 	"github.com/name5566/leaf/conf"
 	"github.com/name5566/leaf/log"
+	"math/rand"
 	"runtime"
+	"sync"
 	"time"
 )
 
 // one dispatcher per goroutine (goroutine not safe)
 type Dispatcher struct {
 	ChanTimer chan *Timer
+	clock     Clock
+	rand      *rand.Rand
+	onPanic   func(r interface{}, stack []byte)
+	// the timers not called nor stopped yet
+	timers map[*Timer]struct{}
+	closed chan struct{}
+	// see SetCoalesce
+	coalesce   time.Duration
+	mutexBatch sync.Mutex
+	batch      []*Timer
+	flushTimer Stopper
 }
 
 func NewDispatcher(l int) *Dispatcher {
+	return NewDispatcherWithClock(l, realClock{})
+}
+
+func NewDispatcherWithClock(l int, clock Clock) *Dispatcher {
 	disp := new(Dispatcher)
 	disp.ChanTimer = make(chan *Timer, l)
+	disp.clock = clock
+	disp.timers = make(map[*Timer]struct{})
+	disp.closed = make(chan struct{})
 	return disp
 }
 
+// stops the pending timers, no callback is called after Close returns,
+// the timers created afterward never fire
+func (disp *Dispatcher) Close() {
+	select {
+	case <-disp.closed:
+		return
+	default:
+	}
+	close(disp.closed)
+	disp.stopFlush()
+
+	for t := range disp.timers {
+		t.Stop()
+	}
+}
+
+func (disp *Dispatcher) isClosed() bool {
+	select {
+	case <-disp.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+type stopped struct{}
+
+func (stopped) Stop() bool {
+	return false
+}
+
+// f is called on the goroutine of the dispatcher with the value recovered
+// from a panicking callback instead of logging it, stack is nil if
+// conf.LenStackBuf is 0, the timers already started get f too
+func (disp *Dispatcher) SetPanicHandler(f func(r interface{}, stack []byte)) {
+	disp.onPanic = f
+}
+
 // Timer
 type Timer struct {
-	t  *time.Timer
-	cb func()
+	t    Stopper
+	cb   func()
+	disp *Dispatcher
+	// the expiry, to order a coalesced batch
+	when time.Time
 }
 
 func (t *Timer) Stop() {
 	t.t.Stop()
 	t.cb = nil
+	if t.disp != nil {
+		delete(t.disp.timers, t)
+	}
 }
 
 func (t *Timer) Cb() {
+	if t.disp != nil {
+		delete(t.disp.timers, t)
+	}
 	defer func() {
 		t.cb = nil
 		if r := recover(); r != nil {
-			if conf.LenStackBuf > 0 {
-				buf := make([]byte, conf.LenStackBuf)
+			var stack []byte
+			if n := conf.Current().LenStackBuf; n > 0 {
+				buf := make([]byte, n)
 				l := runtime.Stack(buf, false)
-				log.Error("%v: %s", r, buf[:l])
+				stack = buf[:l]
+			}
+			if t.disp != nil && t.disp.onPanic != nil {
+				t.disp.onPanic(r, stack)
+			} else if stack != nil {
+				log.Error("%v: %s", r, stack)
 			} else {
 				log.Error("%v", r)
 			}
@@ -50,13 +123,59 @@ func (t *Timer) Cb() {
 
 func (disp *Dispatcher) AfterFunc(d time.Duration, cb func()) *Timer {
 	t := new(Timer)
+	if disp.isClosed() {
+		t.t = stopped{}
+		return t
+	}
+
 	t.cb = cb
-	t.t = time.AfterFunc(d, func() {
-		disp.ChanTimer <- t
+	t.disp = disp
+	disp.timers[t] = struct{}{}
+	t.when = disp.clock.Now().Add(d)
+	t.t = disp.clock.AfterFunc(d, func() {
+		if disp.coalesce > 0 {
+			disp.coalesceTimer(t)
+			return
+		}
+		select {
+		case disp.ChanTimer <- t:
+		case <-disp.closed:
+		}
 	})
 	return t
 }
 
+// cb is called at t, at once if t is not after now
+// t is an instant, its location does not matter
+func (disp *Dispatcher) AtFunc(t time.Time, cb func()) *Timer {
+	d := t.Sub(disp.clock.Now())
+	if d < 0 {
+		d = 0
+	}
+	return disp.AfterFunc(d, cb)
+}
+
+// makes the jitter of the timers reproducible
+func (disp *Dispatcher) SetJitterSeed(seed int64) {
+	disp.rand = rand.New(rand.NewSource(seed))
+}
+
+// a random duration in [0, jitter)
+func (disp *Dispatcher) jitter(jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	if disp.rand == nil {
+		disp.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return time.Duration(disp.rand.Int63n(int64(jitter)))
+}
+
+// cb is called after d plus a random duration less than jitter
+func (disp *Dispatcher) AfterFuncJitter(d time.Duration, jitter time.Duration, cb func()) *Timer {
+	return disp.AfterFunc(d+disp.jitter(jitter), cb)
+}
+
 // Cron
 type Cron struct {
 	t *Timer
@@ -69,10 +188,21 @@ func (c *Cron) Stop() {
 }
 
 func (disp *Dispatcher) CronFunc(cronExpr *CronExpr, _cb func()) *Cron {
+	return disp.scheduleFunc(cronExpr.Next, 0, _cb)
+}
+
+// every occurrence is delayed by a random duration less than jitter,
+// jitter must be shorter than the interval between occurrences
+func (disp *Dispatcher) CronFuncJitter(cronExpr *CronExpr, jitter time.Duration, _cb func()) *Cron {
+	return disp.scheduleFunc(cronExpr.Next, jitter, _cb)
+}
+
+// next returns the zero time when there is no next occurrence
+func (disp *Dispatcher) scheduleFunc(next func(time.Time) time.Time, jitter time.Duration, _cb func()) *Cron {
 	c := new(Cron)
 
-	now := time.Now()
-	nextTime := cronExpr.Next(now)
+	now := disp.clock.Now()
+	nextTime := next(now)
 	if nextTime.IsZero() {
 		return c
 	}
@@ -82,14 +212,14 @@ func (disp *Dispatcher) CronFunc(cronExpr *CronExpr, _cb func()) *Cron {
 	cb = func() {
 		defer _cb()
 
-		now := time.Now()
-		nextTime := cronExpr.Next(now)
+		now := disp.clock.Now()
+		nextTime := next(now)
 		if nextTime.IsZero() {
 			return
 		}
-		c.t = disp.AfterFunc(nextTime.Sub(now), cb)
+		c.t = disp.AfterFuncJitter(nextTime.Sub(now), jitter, cb)
 	}
 
-	c.t = disp.AfterFunc(nextTime.Sub(now), cb)
+	c.t = disp.AfterFuncJitter(nextTime.Sub(now), jitter, cb)
 	return c
 }
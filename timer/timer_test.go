@@ -0,0 +1,118 @@
+package timer_test
+
+import (
+	"github.com/name5566/leaf/conf"
+	"github.com/name5566/leaf/timer"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_SetPanicHandler(t *testing.T) {
+	clock := timer.NewMockClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	disp := timer.NewDispatcherWithClock(10, clock)
+
+	fired := false
+	// the handler set when the timer fires is called
+	disp.AfterFunc(time.Second, func() { panic("bad callback") })
+	disp.AfterFunc(2*time.Second, func() { fired = true })
+
+	var recovered interface{}
+	var stack []byte
+	disp.SetPanicHandler(func(r interface{}, s []byte) {
+		recovered, stack = r, s
+	})
+
+	clock.Advance(2 * time.Second)
+	for len(disp.ChanTimer) > 0 {
+		(<-disp.ChanTimer).Cb()
+	}
+
+	if recovered != "bad callback" || conf.LenStackBuf > 0 && len(stack) == 0 {
+		t.Fatalf("panic not handled: %v %q", recovered, stack)
+	}
+	if !fired {
+		t.Fatal("timer after the panicking one not fired")
+	}
+}
+
+func TestDispatcher_AtFunc(t *testing.T) {
+	clock := timer.NewMockClock(time.Date(2025, 12, 24, 23, 59, 0, 0, time.UTC))
+	disp := timer.NewDispatcherWithClock(10, clock)
+
+	var fired []string
+	// the same instant in another location
+	shanghai := time.FixedZone("CST", 8*3600)
+	disp.AtFunc(time.Date(2025, 12, 25, 8, 0, 0, 0, shanghai), func() {
+		fired = append(fired, "christmas")
+	})
+	disp.AtFunc(time.Date(2025, 12, 24, 0, 0, 0, 0, time.UTC), func() {
+		fired = append(fired, "past")
+	})
+
+	clock.Advance(0)
+	for len(disp.ChanTimer) > 0 {
+		(<-disp.ChanTimer).Cb()
+	}
+	if len(fired) != 1 || fired[0] != "past" {
+		t.Fatalf("got %v, want the past timer only", fired)
+	}
+
+	clock.Advance(59 * time.Second)
+	if len(disp.ChanTimer) > 0 {
+		t.Fatal("timer fired early")
+	}
+	clock.Advance(time.Second)
+	for len(disp.ChanTimer) > 0 {
+		(<-disp.ChanTimer).Cb()
+	}
+	if len(fired) != 2 || fired[1] != "christmas" {
+		t.Fatalf("got %v", fired)
+	}
+}
+
+func TestDispatcher_AtFuncRealClock(t *testing.T) {
+	disp := timer.NewDispatcher(10)
+
+	start := time.Now()
+	disp.AtFunc(start.Add(30*time.Millisecond), nil)
+	(<-disp.ChanTimer).Cb()
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Fatalf("fired after %v", d)
+	}
+}
+
+func TestDispatcher_Close(t *testing.T) {
+	clock := timer.NewMockClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	disp := timer.NewDispatcherWithClock(10, clock)
+
+	var fired []string
+	disp.AfterFunc(time.Second, func() { fired = append(fired, "queued") })
+	disp.AfterFunc(time.Minute, func() { fired = append(fired, "pending") })
+	disp.CronFunc(mustCron(t, "* * * * * *"), func() { fired = append(fired, "cron") })
+	stopped := disp.AfterFunc(time.Minute, func() { fired = append(fired, "stopped") })
+	stopped.Stop()
+
+	// fired but not called yet
+	clock.Advance(time.Second)
+	disp.Close()
+	after := disp.AfterFunc(0, func() { fired = append(fired, "after") })
+	after.Stop()
+	disp.AfterFunc(time.Second, func() { fired = append(fired, "after") })
+
+	clock.Advance(time.Hour)
+	for len(disp.ChanTimer) > 0 {
+		(<-disp.ChanTimer).Cb()
+	}
+	if len(fired) != 0 {
+		t.Fatalf("got %v after Close", fired)
+	}
+	disp.Close()
+}
+
+func mustCron(t *testing.T, expr string) *timer.CronExpr {
+	cronExpr, err := timer.NewCronExpr(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cronExpr
+}
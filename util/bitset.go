@@ -0,0 +1,95 @@
+package util
+
+import (
+	"math/bits"
+)
+
+// the zero value is an empty set, it grows as needed
+// goroutine not safe
+type BitSet struct {
+	words []uint64
+}
+
+func (b *BitSet) grow(n int) {
+	if n > len(b.words) {
+		words := make([]uint64, n, n+n/4)
+		copy(words, b.words)
+		b.words = words
+	}
+}
+
+func (b *BitSet) Set(i uint) {
+	w := int(i / 64)
+	b.grow(w + 1)
+	b.words[w] |= 1 << (i % 64)
+}
+
+func (b *BitSet) Clear(i uint) {
+	w := int(i / 64)
+	if w < len(b.words) {
+		b.words[w] &^= 1 << (i % 64)
+	}
+}
+
+func (b *BitSet) Test(i uint) bool {
+	w := int(i / 64)
+	return w < len(b.words) && b.words[w]&(1<<(i%64)) != 0
+}
+
+func (b *BitSet) Count() int {
+	n := 0
+	for _, w := range b.words {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// b = b | o
+func (b *BitSet) Union(o *BitSet) {
+	b.grow(len(o.words))
+	for i, w := range o.words {
+		b.words[i] |= w
+	}
+}
+
+// b = b & o
+func (b *BitSet) Intersect(o *BitSet) {
+	for i := range b.words {
+		if i < len(o.words) {
+			b.words[i] &= o.words[i]
+		} else {
+			b.words[i] = 0
+		}
+	}
+}
+
+// b = b &^ o
+func (b *BitSet) Difference(o *BitSet) {
+	for i := 0; i < len(b.words) && i < len(o.words); i++ {
+		b.words[i] &^= o.words[i]
+	}
+}
+
+// bit i is stored in byte i/8 at bit i%8, trailing zero bytes are omitted
+func (b *BitSet) Bytes() []byte {
+	data := make([]byte, len(b.words)*8)
+	for i, w := range b.words {
+		for j := 0; j < 8; j++ {
+			data[i*8+j] = byte(w >> (8 * j))
+		}
+	}
+
+	l := len(data)
+	for l > 0 && data[l-1] == 0 {
+		l--
+	}
+	return data[:l]
+}
+
+// replaces the content of b with data encoded by Bytes
+func (b *BitSet) FromBytes(data []byte) {
+	b.words = make([]uint64, (len(data)+7)/8)
+	for i, v := range data {
+		b.words[i/8] |= uint64(v) << (8 * (i % 8))
+	}
+}
@@ -0,0 +1,83 @@
+package util_test
+
+import (
+	"bytes"
+	"github.com/name5566/leaf/util"
+	"testing"
+)
+
+func TestBitSet(t *testing.T) {
+	var b util.BitSet
+	indices := []uint{0, 1, 63, 64, 1000, 4095}
+	for _, i := range indices {
+		b.Set(i)
+	}
+	for _, i := range indices {
+		if !b.Test(i) {
+			t.Errorf("bit %v not set", i)
+		}
+	}
+	if b.Test(2) || b.Test(4096) || b.Test(100000) {
+		t.Error("unexpected bit set")
+	}
+	if b.Count() != len(indices) {
+		t.Errorf("got count %v, want %v", b.Count(), len(indices))
+	}
+
+	b.Clear(1000)
+	b.Clear(100000)
+	if b.Test(1000) || b.Count() != len(indices)-1 {
+		t.Error("clear failed")
+	}
+}
+
+func bitSet(indices ...uint) *util.BitSet {
+	b := new(util.BitSet)
+	for _, i := range indices {
+		b.Set(i)
+	}
+	return b
+}
+
+func TestBitSet_Operations(t *testing.T) {
+	equal := func(b *util.BitSet, indices ...uint) bool {
+		return bytes.Equal(b.Bytes(), bitSet(indices...).Bytes())
+	}
+
+	b := bitSet(1, 2, 3)
+	b.Union(bitSet(3, 200))
+	if !equal(b, 1, 2, 3, 200) {
+		t.Errorf("union: got %v", b.Bytes())
+	}
+
+	b = bitSet(1, 2, 300)
+	b.Intersect(bitSet(2, 3))
+	if !equal(b, 2) {
+		t.Errorf("intersect: got %v", b.Bytes())
+	}
+
+	b = bitSet(1, 2, 300)
+	b.Difference(bitSet(2, 3))
+	if !equal(b, 1, 300) {
+		t.Errorf("difference: got %v", b.Bytes())
+	}
+}
+
+func TestBitSet_Bytes(t *testing.T) {
+	b := bitSet(0, 9, 63, 64, 2047)
+	data := b.Bytes()
+	if len(data) != 256 || data[0] != 1 || data[1] != 2 {
+		t.Fatalf("unexpected bytes: %v", data[:2])
+	}
+
+	var c util.BitSet
+	c.FromBytes(data)
+	if !bytes.Equal(c.Bytes(), data) || c.Count() != 5 || !c.Test(2047) {
+		t.Fatal("round trip failed")
+	}
+
+	var empty util.BitSet
+	if len(empty.Bytes()) != 0 {
+		t.Fatal("empty set not empty")
+	}
+}
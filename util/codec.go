@@ -0,0 +1,74 @@
+package util
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"sync"
+)
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// goroutine safe
+func GetBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// goroutine safe
+// b must not be used after the call
+func PutBuffer(b *bytes.Buffer) {
+	b.Reset()
+	bufferPool.Put(b)
+}
+
+// appends the JSON encoding of v to dst, the output is the same as json.Marshal
+// dst.Bytes() is only valid until dst is modified or reused
+func MarshalInto(dst *bytes.Buffer, v interface{}) error {
+	l := dst.Len()
+	err := json.NewEncoder(dst).Encode(v)
+	if err != nil {
+		dst.Truncate(l)
+		return err
+	}
+
+	// Encode terminates each value with a newline
+	dst.Truncate(dst.Len() - 1)
+	return nil
+}
+
+// appends the gob encoding of v to dst
+// dst.Bytes() is only valid until dst is modified or reused
+func GobMarshalInto(dst *bytes.Buffer, v interface{}) error {
+	l := dst.Len()
+	err := gob.NewEncoder(dst).Encode(v)
+	if err != nil {
+		dst.Truncate(l)
+	}
+	return err
+}
+
+// the buffer comes from the pool and must be returned by PutBuffer
+func MarshalPooled(v interface{}) (*bytes.Buffer, error) {
+	b := GetBuffer()
+	err := MarshalInto(b, v)
+	if err != nil {
+		PutBuffer(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+// the buffer comes from the pool and must be returned by PutBuffer
+func GobMarshalPooled(v interface{}) (*bytes.Buffer, error) {
+	b := GetBuffer()
+	err := GobMarshalInto(b, v)
+	if err != nil {
+		PutBuffer(b)
+		return nil, err
+	}
+	return b, nil
+}
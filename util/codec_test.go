@@ -0,0 +1,122 @@
+package util_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"github.com/name5566/leaf/util"
+	"reflect"
+	"testing"
+)
+
+type codecMsg struct {
+	ID    int
+	Name  string
+	Items []int
+	Attrs map[string]string
+}
+
+var testMsg = codecMsg{
+	ID:    1,
+	Name:  "<leaf>",
+	Items: []int{1, 2, 3},
+	Attrs: map[string]string{"k": "v"},
+}
+
+func TestMarshalInto(t *testing.T) {
+	want, err := json.Marshal(&testMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	for i := 0; i < 2; i++ {
+		b.Reset()
+		if err := util.MarshalInto(&b, &testMsg); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b.Bytes(), want) {
+			t.Fatalf("got %s, want %s", b.Bytes(), want)
+		}
+
+		var got codecMsg
+		if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, testMsg) {
+			t.Fatalf("got %+v, want %+v", got, testMsg)
+		}
+	}
+
+	// nothing is appended on error
+	b.Reset()
+	b.WriteString("prefix")
+	if err := util.MarshalInto(&b, func() {}); err == nil {
+		t.Fatal("expected error")
+	}
+	if b.String() != "prefix" {
+		t.Fatalf("got %q", b.String())
+	}
+}
+
+func TestGobMarshalInto(t *testing.T) {
+	var b bytes.Buffer
+	if err := util.GobMarshalInto(&b, &testMsg); err != nil {
+		t.Fatal(err)
+	}
+
+	var got codecMsg
+	if err := gob.NewDecoder(&b).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, testMsg) {
+		t.Fatalf("got %+v, want %+v", got, testMsg)
+	}
+}
+
+func TestMarshalPooled(t *testing.T) {
+	b, err := util.MarshalPooled(&testMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer util.PutBuffer(b)
+
+	var got codecMsg
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, testMsg) {
+		t.Fatalf("got %+v, want %+v", got, testMsg)
+	}
+}
+
+func BenchmarkJSONMarshal(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(&testMsg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalInto(b *testing.B) {
+	b.ReportAllocs()
+	var buf bytes.Buffer
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := util.MarshalInto(&buf, &testMsg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalPooled(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, err := util.MarshalPooled(&testMsg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		util.PutBuffer(buf)
+	}
+}
@@ -0,0 +1,146 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cfg is a pointer to a struct, its fields are set from the tags
+//
+//	Port    int           `env:"PORT" default:"8080"`
+//	Token   string        `env:"TOKEN" required:"true"`
+//	Timeout time.Duration `env:"TIMEOUT" default:"5s"`
+//	Peers   []string      `env:"PEERS"`
+//
+// the environment variable takes precedence over the default, a slice is
+// comma separated and nested structs are loaded the same way
+// a required field still zero after loading is an error, all the errors
+// are returned together
+func LoadConfig(cfg interface{}) error {
+	return loadConfig(cfg, nil)
+}
+
+// like LoadConfig, the JSON file is decoded into cfg over the defaults,
+// the environment variables take precedence over the file
+func LoadConfigFile(cfg interface{}, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return loadConfig(cfg, data)
+}
+
+func loadConfig(cfg interface{}, file []byte) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config %T is not a pointer to a struct", cfg)
+	}
+
+	var errs []error
+	walkConfig(v.Elem(), "", func(f reflect.Value, name string, tag reflect.StructTag) {
+		if def, ok := tag.Lookup("default"); ok {
+			if err := setConfigField(f, def); err != nil {
+				errs = append(errs, fmt.Errorf("field %v: default: %w", name, err))
+			}
+		}
+	})
+	if file != nil {
+		if err := json.Unmarshal(file, cfg); err != nil {
+			return err
+		}
+	}
+	walkConfig(v.Elem(), "", func(f reflect.Value, name string, tag reflect.StructTag) {
+		if env := tag.Get("env"); env != "" {
+			if s, ok := os.LookupEnv(env); ok {
+				if err := setConfigField(f, s); err != nil {
+					errs = append(errs, fmt.Errorf("field %v: env %v: %w", name, env, err))
+				}
+			}
+		}
+		if tag.Get("required") == "true" && f.IsZero() {
+			errs = append(errs, fmt.Errorf("field %v: required", name))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// f is called with the exported fields which are not nested structs
+func walkConfig(v reflect.Value, prefix string, f func(field reflect.Value, name string, tag reflect.StructTag)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		field := v.Field(i)
+		name := prefix + sf.Name
+		if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(time.Time{}) {
+			walkConfig(field, name+".", f)
+			continue
+		}
+		f(field, name, sf.Tag)
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setConfigField(f reflect.Value, s string) error {
+	if f.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		x, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(x)
+	case reflect.Slice:
+		parts := strings.Split(s, ",")
+		if s == "" {
+			parts = nil
+		}
+		slice := reflect.MakeSlice(f.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setConfigField(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		f.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %v", f.Type())
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package util_test
+
+import (
+	"github.com/name5566/leaf/util"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type serverConfig struct {
+	Port    int           `env:"TEST_PORT" default:"8080"`
+	Host    string        `env:"TEST_HOST" default:"localhost"`
+	Debug   bool          `env:"TEST_DEBUG"`
+	Timeout time.Duration `env:"TEST_TIMEOUT" default:"5s"`
+	Peers   []string      `env:"TEST_PEERS"`
+	DB      struct {
+		URL      string `env:"TEST_DB_URL" required:"true"`
+		PoolSize uint8  `env:"TEST_DB_POOL" default:"4"`
+	}
+	Token string `env:"TEST_TOKEN" required:"true"`
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("TEST_PORT", "9000")
+	t.Setenv("TEST_DEBUG", "true")
+	t.Setenv("TEST_PEERS", "a:1, b:2")
+	t.Setenv("TEST_DB_URL", "mongodb://db")
+	t.Setenv("TEST_TOKEN", "secret")
+
+	var cfg serverConfig
+	if err := util.LoadConfig(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 9000 || cfg.Host != "localhost" || !cfg.Debug || cfg.Timeout != 5*time.Second ||
+		!reflect.DeepEqual(cfg.Peers, []string{"a:1", "b:2"}) ||
+		cfg.DB.URL != "mongodb://db" || cfg.DB.PoolSize != 4 || cfg.Token != "secret" {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	t.Setenv("TEST_PORT", "http")
+	t.Setenv("TEST_DB_POOL", "1000")
+
+	var cfg serverConfig
+	err := util.LoadConfig(&cfg)
+	if err == nil {
+		t.Fatal("no error")
+	}
+	for _, want := range []string{
+		"field Port: env TEST_PORT",
+		"field DB.PoolSize: env TEST_DB_POOL",
+		"field DB.URL: required",
+		"field Token: required",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("%q not in %q", want, err)
+		}
+	}
+
+	if err := util.LoadConfig(cfg); err == nil {
+		t.Fatal("struct not rejected")
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.json")
+	data := `{"Host": "0.0.0.0", "Port": 7000, "DB": {"URL": "mongodb://file"}, "Token": "file"}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_TOKEN", "env")
+
+	var cfg serverConfig
+	if err := util.LoadConfigFile(&cfg, path); err != nil {
+		t.Fatal(err)
+	}
+	// default < file < env
+	if cfg.Host != "0.0.0.0" || cfg.Port != 7000 || cfg.Timeout != 5*time.Second ||
+		cfg.DB.URL != "mongodb://file" || cfg.Token != "env" {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+}
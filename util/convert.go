@@ -0,0 +1,164 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+func convertError(v interface{}, to string) error {
+	return fmt.Errorf("cannot convert %v (%T) to %v", v, v, to)
+}
+
+// floats must be integral, strings are parsed
+func ToInt64(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), nil
+	case int8:
+		return int64(n), nil
+	case int16:
+		return int64(n), nil
+	case int32:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case uint:
+		return uintToInt64(uint64(n), v)
+	case uint8:
+		return int64(n), nil
+	case uint16:
+		return int64(n), nil
+	case uint32:
+		return int64(n), nil
+	case uint64:
+		return uintToInt64(n, v)
+	case float32:
+		return floatToInt64(float64(n), v)
+	case float64:
+		return floatToInt64(n, v)
+	case json.Number:
+		return ToInt64(string(n))
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		if err != nil {
+			return 0, convertError(v, "int64")
+		}
+		return i, nil
+	}
+	return 0, convertError(v, "int64")
+}
+
+func uintToInt64(n uint64, v interface{}) (int64, error) {
+	if n > math.MaxInt64 {
+		return 0, convertError(v, "int64")
+	}
+	return int64(n), nil
+}
+
+func floatToInt64(f float64, v interface{}) (int64, error) {
+	// float64(math.MaxInt64) rounds up to 2^63
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, convertError(v, "int64")
+	}
+	return int64(f), nil
+}
+
+func ToInt(v interface{}) (int, error) {
+	i, err := ToInt64(v)
+	if err != nil {
+		return 0, err
+	}
+	if i < math.MinInt || i > math.MaxInt {
+		return 0, convertError(v, "int")
+	}
+	return int(i), nil
+}
+
+// strings are parsed
+func ToFloat64(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float32:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case int8:
+		return float64(n), nil
+	case int16:
+		return float64(n), nil
+	case int32:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case uint:
+		return float64(n), nil
+	case uint8:
+		return float64(n), nil
+	case uint16:
+		return float64(n), nil
+	case uint32:
+		return float64(n), nil
+	case uint64:
+		return float64(n), nil
+	case json.Number:
+		return ToFloat64(string(n))
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return 0, convertError(v, "float64")
+		}
+		return f, nil
+	}
+	return 0, convertError(v, "float64")
+}
+
+// numbers and booleans are formatted
+func ToString(v interface{}) (string, error) {
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case []byte:
+		return string(s), nil
+	case json.Number:
+		return string(s), nil
+	case bool:
+		return strconv.FormatBool(s), nil
+	case int, int8, int16, int32, int64, uint8, uint16, uint32:
+		i, _ := ToInt64(v)
+		return strconv.FormatInt(i, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(s), 10), nil
+	case uint64:
+		return strconv.FormatUint(s, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(s), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(s, 'g', -1, 64), nil
+	}
+	return "", convertError(v, "string")
+}
+
+// integers are true if not 0, strings are parsed
+func ToBool(v interface{}) (bool, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case string:
+		r, err := strconv.ParseBool(b)
+		if err != nil {
+			return false, convertError(v, "bool")
+		}
+		return r, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		i, err := ToInt64(v)
+		if err != nil {
+			// uint64 above math.MaxInt64
+			return true, nil
+		}
+		return i != 0, nil
+	}
+	return false, convertError(v, "bool")
+}
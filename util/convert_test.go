@@ -0,0 +1,110 @@
+package util_test
+
+import (
+	"encoding/json"
+	"github.com/name5566/leaf/util"
+	"math"
+	"testing"
+)
+
+func TestToInt64(t *testing.T) {
+	for _, v := range []interface{}{
+		int(42), int8(42), int16(42), int32(42), int64(42),
+		uint(42), uint8(42), uint16(42), uint32(42), uint64(42),
+		float32(42), float64(42), json.Number("42"), "42",
+	} {
+		i, err := util.ToInt64(v)
+		if err != nil || i != 42 {
+			t.Errorf("ToInt64(%#v) = %v, %v", v, i, err)
+		}
+	}
+
+	for _, v := range []interface{}{
+		nil, true, 4.2, "4.2", uint64(math.MaxUint64), math.Inf(1), []int{42},
+	} {
+		if i, err := util.ToInt64(v); err == nil {
+			t.Errorf("ToInt64(%#v) = %v, want an error", v, i)
+		}
+	}
+
+	if i, err := util.ToInt(float64(7)); err != nil || i != 7 {
+		t.Errorf("ToInt(7.0) = %v, %v", i, err)
+	}
+}
+
+func TestToFloat64(t *testing.T) {
+	for _, v := range []interface{}{
+		int(2), int8(2), int16(2), int32(2), int64(2),
+		uint(2), uint8(2), uint16(2), uint32(2), uint64(2),
+		float32(2), float64(2), json.Number("2"), "2",
+	} {
+		f, err := util.ToFloat64(v)
+		if err != nil || f != 2 {
+			t.Errorf("ToFloat64(%#v) = %v, %v", v, f, err)
+		}
+	}
+
+	for _, v := range []interface{}{nil, false, "two", struct{}{}} {
+		if f, err := util.ToFloat64(v); err == nil {
+			t.Errorf("ToFloat64(%#v) = %v, want an error", v, f)
+		}
+	}
+}
+
+func TestToString(t *testing.T) {
+	cases := []struct {
+		v    interface{}
+		want string
+	}{
+		{"leaf", "leaf"},
+		{[]byte("leaf"), "leaf"},
+		{json.Number("1.5"), "1.5"},
+		{true, "true"},
+		{int(-3), "-3"},
+		{int8(-3), "-3"},
+		{int64(-3), "-3"},
+		{uint8(3), "3"},
+		{uint(3), "3"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{float32(1.5), "1.5"},
+		{float64(1.5), "1.5"},
+	}
+	for _, c := range cases {
+		s, err := util.ToString(c.v)
+		if err != nil || s != c.want {
+			t.Errorf("ToString(%#v) = %q, %v, want %q", c.v, s, err, c.want)
+		}
+	}
+
+	if s, err := util.ToString(map[string]int{}); err == nil {
+		t.Errorf("ToString(map) = %q, want an error", s)
+	}
+}
+
+func TestToBool(t *testing.T) {
+	cases := []struct {
+		v    interface{}
+		want bool
+	}{
+		{true, true},
+		{false, false},
+		{"true", true},
+		{"0", false},
+		{int(1), true},
+		{int64(0), false},
+		{uint8(2), true},
+		{uint64(math.MaxUint64), true},
+	}
+	for _, c := range cases {
+		b, err := util.ToBool(c.v)
+		if err != nil || b != c.want {
+			t.Errorf("ToBool(%#v) = %v, %v, want %v", c.v, b, err, c.want)
+		}
+	}
+
+	for _, v := range []interface{}{nil, 1.0, "yes"} {
+		if b, err := util.ToBool(v); err == nil {
+			t.Errorf("ToBool(%#v) = %v, want an error", v, b)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// the returned function calls f once no call happened for d
+// f is called in its own goroutine
+// goroutine safe
+func Debounce(d time.Duration, f func()) func() {
+	var (
+		mutex sync.Mutex
+		t     *time.Timer
+		gen   uint64
+	)
+
+	return func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if t != nil {
+			t.Stop()
+		}
+		gen++
+		g := gen
+		t = time.AfterFunc(d, func() {
+			mutex.Lock()
+			if g != gen {
+				mutex.Unlock()
+				return
+			}
+			t = nil
+			mutex.Unlock()
+			f()
+		})
+	}
+}
+
+// the returned function calls f at most once per d, the first call is
+// forwarded immediately on the calling goroutine and the calls made during
+// the following d are collapsed into a single call at the end of it
+// goroutine safe
+func Throttle(d time.Duration, f func()) func() {
+	var (
+		mutex   sync.Mutex
+		last    time.Time
+		pending bool
+	)
+
+	return func() {
+		mutex.Lock()
+		if pending {
+			mutex.Unlock()
+			return
+		}
+
+		elapsed := time.Since(last)
+		if elapsed >= d {
+			last = time.Now()
+			mutex.Unlock()
+			f()
+			return
+		}
+
+		pending = true
+		time.AfterFunc(d-elapsed, func() {
+			mutex.Lock()
+			pending = false
+			last = time.Now()
+			mutex.Unlock()
+			f()
+		})
+		mutex.Unlock()
+	}
+}
@@ -0,0 +1,70 @@
+package util_test
+
+import (
+	"github.com/name5566/leaf/util"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func burst(n int, interval time.Duration, trigger func()) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			trigger()
+		}()
+		time.Sleep(interval)
+	}
+	wg.Wait()
+}
+
+func TestDebounce(t *testing.T) {
+	var n int32
+	trigger := util.Debounce(50*time.Millisecond, func() {
+		atomic.AddInt32(&n, 1)
+	})
+
+	burst(20, 5*time.Millisecond, trigger)
+	if got := atomic.LoadInt32(&n); got != 0 {
+		t.Fatalf("called %v times during the burst", got)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if got := atomic.LoadInt32(&n); got != 1 {
+		t.Fatalf("called %v times, want 1", got)
+	}
+
+	burst(5, 0, trigger)
+	time.Sleep(150 * time.Millisecond)
+	if got := atomic.LoadInt32(&n); got != 2 {
+		t.Fatalf("called %v times, want 2", got)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	var n int32
+	trigger := util.Throttle(50*time.Millisecond, func() {
+		atomic.AddInt32(&n, 1)
+	})
+
+	trigger()
+	if got := atomic.LoadInt32(&n); got != 1 {
+		t.Fatalf("first call not forwarded")
+	}
+
+	burst(20, 0, trigger)
+	if got := atomic.LoadInt32(&n); got != 1 {
+		t.Fatalf("called %v times during the burst", got)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if got := atomic.LoadInt32(&n); got != 2 {
+		t.Fatalf("called %v times, want 2", got)
+	}
+
+	trigger()
+	if got := atomic.LoadInt32(&n); got != 3 {
+		t.Fatalf("called %v times after the quiet period, want 3", got)
+	}
+}
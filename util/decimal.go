@@ -0,0 +1,221 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+var ErrDecimalOverflow = errors.New("decimal overflow")
+
+const MaxDecimalScale = 18
+
+// fixed-point number for currency, units / 10^scale, e.g. 1234 with
+// scale 2 is 12.34
+// the zero value is 0 with scale 0
+type Decimal struct {
+	units int64
+	scale int
+}
+
+var pow10 = func() [MaxDecimalScale + 1]int64 {
+	var p [MaxDecimalScale + 1]int64
+	p[0] = 1
+	for i := 1; i < len(p); i++ {
+		p[i] = p[i-1] * 10
+	}
+	return p
+}()
+
+func NewDecimal(units int64, scale int) Decimal {
+	if scale < 0 || scale > MaxDecimalScale {
+		panic(fmt.Sprintf("invalid decimal scale %v", scale))
+	}
+	return Decimal{units, scale}
+}
+
+// "12.34" with scale 2, more fraction digits than scale is an error
+func ParseDecimal(s string, scale int) (Decimal, error) {
+	if scale < 0 || scale > MaxDecimalScale {
+		return Decimal{}, fmt.Errorf("invalid decimal scale %v", scale)
+	}
+
+	str := s
+	neg := strings.HasPrefix(str, "-")
+	if neg || strings.HasPrefix(str, "+") {
+		str = str[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(str, ".")
+	if intPart == "" && fracPart == "" || len(fracPart) > scale ||
+		strings.ContainsAny(intPart+fracPart, "+-_") {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	digits := intPart + fracPart + strings.Repeat("0", scale-len(fracPart))
+	units, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return Decimal{}, ErrDecimalOverflow
+		}
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	if neg {
+		units = -units
+	}
+	return Decimal{units, scale}, nil
+}
+
+func (d Decimal) Units() int64 {
+	return d.units
+}
+
+func (d Decimal) Scale() int {
+	return d.scale
+}
+
+// returns ErrDecimalOverflow if d does not fit in the new scale,
+// a smaller scale truncates toward zero
+func (d Decimal) Rescale(scale int) (Decimal, error) {
+	if scale < 0 || scale > MaxDecimalScale {
+		return Decimal{}, fmt.Errorf("invalid decimal scale %v", scale)
+	}
+	if scale <= d.scale {
+		return Decimal{d.units / pow10[d.scale-scale], scale}, nil
+	}
+	units, err := mul64(d.units, pow10[scale-d.scale])
+	if err != nil {
+		return Decimal{}, err
+	}
+	return Decimal{units, scale}, nil
+}
+
+// the operands are aligned to the larger scale
+func align(a, b Decimal) (Decimal, Decimal, error) {
+	var err error
+	if a.scale < b.scale {
+		a, err = a.Rescale(b.scale)
+	} else if b.scale < a.scale {
+		b, err = b.Rescale(a.scale)
+	}
+	return a, b, err
+}
+
+func (d Decimal) Add(o Decimal) (Decimal, error) {
+	d, o, err := align(d, o)
+	if err != nil {
+		return Decimal{}, err
+	}
+	units := d.units + o.units
+	if (units > d.units) != (o.units > 0) {
+		return Decimal{}, ErrDecimalOverflow
+	}
+	return Decimal{units, d.scale}, nil
+}
+
+func (d Decimal) Sub(o Decimal) (Decimal, error) {
+	if o.units == math.MinInt64 {
+		return Decimal{}, ErrDecimalOverflow
+	}
+	return d.Add(Decimal{-o.units, o.scale})
+}
+
+func (d Decimal) Mul(n int64) (Decimal, error) {
+	units, err := mul64(d.units, n)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return Decimal{units, d.scale}, nil
+}
+
+func mul64(a, b int64) (int64, error) {
+	if a == 0 || b == 0 {
+		return 0, nil
+	}
+	neg := (a < 0) != (b < 0)
+	hi, lo := bits.Mul64(abs64(a), abs64(b))
+	if hi != 0 || lo > math.MaxInt64+1 || lo == math.MaxInt64+1 && !neg {
+		return 0, ErrDecimalOverflow
+	}
+	if neg {
+		return int64(-lo), nil
+	}
+	return int64(lo), nil
+}
+
+func abs64(a int64) uint64 {
+	if a < 0 {
+		return uint64(-a)
+	}
+	return uint64(a)
+}
+
+// -1, 0 or +1, 1.5 and 1.50 are equal
+func (d Decimal) Cmp(o Decimal) int {
+	a, b := d, o
+	if a.scale != b.scale {
+		// compare the integer parts first, the aligned fractions then fit
+		ai, bi := a.units/pow10[a.scale], b.units/pow10[b.scale]
+		if ai != bi {
+			return cmp64(ai, bi)
+		}
+		a = Decimal{a.units - ai*pow10[a.scale], a.scale}
+		b = Decimal{b.units - bi*pow10[b.scale], b.scale}
+		a, b, _ = align(a, b)
+	}
+	return cmp64(a.units, b.units)
+}
+
+func cmp64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (d Decimal) IsZero() bool {
+	return d.units == 0
+}
+
+func (d Decimal) String() string {
+	u := abs64(d.units)
+	s := strconv.FormatUint(u, 10)
+	if d.scale > 0 {
+		if len(s) <= d.scale {
+			s = strings.Repeat("0", d.scale-len(s)+1) + s
+		}
+		s = s[:len(s)-d.scale] + "." + s[len(s)-d.scale:]
+	}
+	if d.units < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// a JSON number with the digits of the scale, e.g. 1.50
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// accepts a number or a string, the scale is the number of
+// fraction digits
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if strings.ContainsAny(s, "eE") {
+		return fmt.Errorf("invalid decimal %q", s)
+	}
+	scale := 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		scale = len(s) - i - 1
+	}
+	v, err := ParseDecimal(s, scale)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
@@ -0,0 +1,135 @@
+package util_test
+
+import (
+	"encoding/json"
+	"github.com/name5566/leaf/util"
+	"math"
+	"testing"
+)
+
+func mustDecimal(t *testing.T, s string, scale int) util.Decimal {
+	d, err := util.ParseDecimal(s, scale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestDecimal_Arithmetic(t *testing.T) {
+	price := mustDecimal(t, "0.10", 2)
+	total := util.NewDecimal(0, 2)
+	for i := 0; i < 10; i++ {
+		var err error
+		total, err = total.Add(price)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if total.String() != "1.00" {
+		t.Fatalf("got %v, want 1.00", total)
+	}
+
+	d, err := total.Sub(mustDecimal(t, "1.5", 1))
+	if err != nil || d.String() != "-0.50" {
+		t.Fatalf("got %v %v, want -0.50", d, err)
+	}
+	d, err = price.Mul(-3)
+	if err != nil || d.String() != "-0.30" {
+		t.Fatalf("got %v %v, want -0.30", d, err)
+	}
+	if s := util.NewDecimal(5, 3).String(); s != "0.005" {
+		t.Fatalf("got %v", s)
+	}
+	if s := util.NewDecimal(-12, 0).String(); s != "-12" {
+		t.Fatalf("got %v", s)
+	}
+
+	for _, s := range []string{"", "-", "1.234", "1.2.3", "abc", "1e2", "--1"} {
+		if _, err := util.ParseDecimal(s, 2); err == nil {
+			t.Errorf("invalid decimal %q accepted", s)
+		}
+	}
+}
+
+func TestDecimal_Cmp(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.5", "1.50", 0},
+		{"1.49", "1.5", -1},
+		{"-0.5", "0.30", -1},
+		{"2", "1.99", 1},
+		{"-1.01", "-1.1", 1},
+	}
+	for _, c := range cases {
+		a, b := mustDecimal(t, c.a, 2), mustDecimal(t, c.b, 2)
+		if got := a.Cmp(b); got != c.want {
+			t.Errorf("%v cmp %v: got %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+
+	// no overflow when aligning very different scales
+	big := util.NewDecimal(math.MaxInt64, 0)
+	small := util.NewDecimal(1, 18)
+	if big.Cmp(small) != 1 || small.Cmp(big) != -1 {
+		t.Fatal("unexpected order")
+	}
+}
+
+func TestDecimal_Overflow(t *testing.T) {
+	max := util.NewDecimal(math.MaxInt64, 2)
+	min := util.NewDecimal(math.MinInt64, 2)
+	one := util.NewDecimal(1, 2)
+
+	if _, err := max.Add(one); err != util.ErrDecimalOverflow {
+		t.Fatalf("got %v, want overflow", err)
+	}
+	if _, err := min.Sub(one); err != util.ErrDecimalOverflow {
+		t.Fatalf("got %v, want overflow", err)
+	}
+	if _, err := one.Sub(min); err != util.ErrDecimalOverflow {
+		t.Fatalf("got %v, want overflow", err)
+	}
+	if _, err := max.Mul(2); err != util.ErrDecimalOverflow {
+		t.Fatalf("got %v, want overflow", err)
+	}
+	if d, err := util.NewDecimal(math.MinInt64/2, 0).Mul(2); err != nil || d.Units() != math.MinInt64 {
+		t.Fatalf("got %v %v", d, err)
+	}
+	if _, err := max.Add(util.NewDecimal(1, 3)); err != util.ErrDecimalOverflow {
+		t.Fatalf("got %v, want overflow when rescaling", err)
+	}
+	if _, err := util.ParseDecimal("99999999999999999999", 2); err != util.ErrDecimalOverflow {
+		t.Fatalf("got %v, want overflow", err)
+	}
+}
+
+func TestDecimal_JSON(t *testing.T) {
+	type item struct {
+		Price util.Decimal
+	}
+
+	data, err := json.Marshal(item{mustDecimal(t, "12.50", 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"Price":12.50}` {
+		t.Fatalf("got %s", data)
+	}
+
+	var got item
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Price.Units() != 1250 || got.Price.Scale() != 2 {
+		t.Fatalf("got %v units %v scale %v", got.Price, got.Price.Units(), got.Price.Scale())
+	}
+
+	if err := json.Unmarshal([]byte(`{"Price":"-0.05"}`), &got); err != nil || got.Price.String() != "-0.05" {
+		t.Fatalf("got %v %v", got.Price, err)
+	}
+	if err := json.Unmarshal([]byte(`{"Price":1e3}`), &got); err == nil {
+		t.Fatal("exponent accepted")
+	}
+}
@@ -74,3 +74,66 @@ func DeepClone(v interface{}) interface{} {
 	deepCopy(dst, reflect.ValueOf(v))
 	return dst.Interface()
 }
+
+// out is a deep copy of base with the fields set in patch overlaid,
+// base and out are pointers to the same struct type, patch is a struct
+// (or a pointer to it) whose fields are matched by name
+// a zero patch field is unset, a pointer patch field for a non-pointer
+// field is set when not nil, e.g. to set a zero value
+// the nested structs are merged field by field
+func Merge(base, patch, out interface{}) {
+	typeBase := reflect.TypeOf(base)
+	typeOut := reflect.TypeOf(out)
+	if typeBase != typeOut {
+		panic("Merge: " + typeBase.String() + " != " + typeOut.String())
+	}
+	if typeBase.Kind() != reflect.Ptr || typeBase.Elem().Kind() != reflect.Struct {
+		panic("Merge: pass struct arguments by address")
+	}
+
+	valueOut := reflect.ValueOf(out).Elem()
+	valueBase := reflect.ValueOf(base).Elem()
+	valuePatch := reflect.Indirect(reflect.ValueOf(patch))
+	if !valueOut.IsValid() || !valueBase.IsValid() || valuePatch.Kind() != reflect.Struct {
+		panic("Merge: invalid arguments")
+	}
+
+	deepCopy(valueOut, valueBase)
+	merge(valueOut, valuePatch)
+}
+
+func merge(dst, patch reflect.Value) {
+	typePatch := patch.Type()
+	for i := 0; i < patch.NumField(); i++ {
+		f := typePatch.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("deepcopy") == "-" {
+			continue
+		}
+		field := dst.FieldByName(f.Name)
+		if !field.IsValid() || !field.CanSet() {
+			panic("Merge: field " + f.Name + " not in " + dst.Type().String())
+		}
+		mergeField(field, patch.Field(i))
+	}
+}
+
+func mergeField(dst, patch reflect.Value) {
+	set := false
+	if patch.Kind() == reflect.Ptr && dst.Kind() != reflect.Ptr {
+		if patch.IsNil() {
+			return
+		}
+		patch = patch.Elem()
+		set = true
+	}
+	if dst.Kind() == reflect.Struct && patch.Kind() == reflect.Struct {
+		merge(dst, patch)
+		return
+	}
+	if patch.Type() != dst.Type() {
+		panic("Merge: " + patch.Type().String() + " != " + dst.Type().String())
+	}
+	if set || !patch.IsZero() {
+		deepCopy(dst, patch)
+	}
+}
@@ -0,0 +1,68 @@
+package util_test
+
+import (
+	"github.com/name5566/leaf/util"
+	"reflect"
+	"testing"
+)
+
+type serverConf struct {
+	Name    string
+	MaxConn int
+	Debug   bool
+	Tags    []string
+	Limits  struct {
+		Rate  int
+		Burst int
+	}
+}
+
+type serverConfPatch struct {
+	MaxConn *int
+	Debug   *bool
+	Tags    []string
+	Limits  struct {
+		Burst int
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := serverConf{Name: "game", MaxConn: 100, Debug: true, Tags: []string{"a"}}
+	base.Limits.Rate = 10
+	base.Limits.Burst = 20
+
+	zero := 0
+	debug := false
+	patch := serverConfPatch{MaxConn: &zero, Debug: &debug, Tags: []string{"b", "c"}}
+	patch.Limits.Burst = 50
+
+	var out serverConf
+	util.Merge(&base, &patch, &out)
+
+	want := serverConf{Name: "game", MaxConn: 0, Debug: false, Tags: []string{"b", "c"}}
+	want.Limits.Rate = 10
+	want.Limits.Burst = 50
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("got %+v, want %+v", out, want)
+	}
+
+	// deep copies
+	patch.Tags[0] = "x"
+	out.Tags[1] = "y"
+	if base.Tags[0] != "a" || out.Tags[0] != "b" || patch.Tags[1] != "c" {
+		t.Fatal("merged values shared")
+	}
+
+	// a patch of the same type sets its non-zero fields
+	util.Merge(&base, serverConf{Name: "gate"}, &out)
+	if out.Name != "gate" || out.MaxConn != 100 || !out.Debug || out.Limits.Burst != 20 {
+		t.Fatalf("got %+v", out)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("unknown field merged")
+		}
+	}()
+	util.Merge(&base, struct{ Port int }{1}, &out)
+}
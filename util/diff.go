@@ -0,0 +1,144 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type DiffKind int
+
+const (
+	Added DiffKind = iota
+	Removed
+	Modified
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	}
+	return "unknown"
+}
+
+type FieldDiff struct {
+	Name string
+	Old  interface{}
+	New  interface{}
+}
+
+type RecordDiff struct {
+	Kind   DiffKind
+	Key    interface{}
+	Fields []FieldDiff
+}
+
+func (d RecordDiff) String() string {
+	if d.Kind != Modified {
+		return fmt.Sprintf("%v %v", d.Kind, d.Key)
+	}
+
+	fields := make([]string, len(d.Fields))
+	for i, f := range d.Fields {
+		fields[i] = fmt.Sprintf("%v %v -> %v", f.Name, f.Old, f.New)
+	}
+	return fmt.Sprintf("%v %v: %v", d.Kind, d.Key, strings.Join(fields, ", "))
+}
+
+// oldRecords and newRecords are slices of structs or pointers to structs of
+// the same type, records are matched by the field named key, fields tagged
+// `diff:"-"` are ignored
+// added and modified records are in the order of newRecords,
+// removed records follow in the order of oldRecords
+func DiffRecords(oldRecords, newRecords interface{}, key string) ([]RecordDiff, error) {
+	vOld := reflect.ValueOf(oldRecords)
+	vNew := reflect.ValueOf(newRecords)
+	if vOld.Kind() != reflect.Slice || vNew.Kind() != reflect.Slice {
+		return nil, errors.New("slices of records required")
+	}
+	if vOld.Type() != vNew.Type() {
+		return nil, fmt.Errorf("records type mismatch: %v and %v", vOld.Type(), vNew.Type())
+	}
+	st := vOld.Type().Elem()
+	if st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%v is not a struct", st)
+	}
+	keyField, ok := st.FieldByName(key)
+	if !ok || len(keyField.Index) != 1 {
+		return nil, fmt.Errorf("%v has no field %v", st, key)
+	}
+	if !keyField.Type.Comparable() {
+		return nil, fmt.Errorf("field %v is not comparable", key)
+	}
+
+	var fields []int
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("diff") == "-" {
+			continue
+		}
+		fields = append(fields, i)
+	}
+
+	index := func(v reflect.Value) (map[interface{}]reflect.Value, []interface{}, error) {
+		m := make(map[interface{}]reflect.Value)
+		keys := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			r := reflect.Indirect(v.Index(i))
+			if !r.IsValid() {
+				return nil, nil, fmt.Errorf("record %v is nil", i)
+			}
+			k := r.Field(keyField.Index[0]).Interface()
+			if _, ok := m[k]; ok {
+				return nil, nil, fmt.Errorf("duplicate key %v", k)
+			}
+			m[k] = r
+			keys = append(keys, k)
+		}
+		return m, keys, nil
+	}
+	mOld, keysOld, err := index(vOld)
+	if err != nil {
+		return nil, err
+	}
+	mNew, keysNew, err := index(vNew)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []RecordDiff
+	for _, k := range keysNew {
+		rNew := mNew[k]
+		rOld, ok := mOld[k]
+		if !ok {
+			diffs = append(diffs, RecordDiff{Kind: Added, Key: k})
+			continue
+		}
+
+		var fieldDiffs []FieldDiff
+		for _, i := range fields {
+			o, n := rOld.Field(i).Interface(), rNew.Field(i).Interface()
+			if !reflect.DeepEqual(o, n) {
+				fieldDiffs = append(fieldDiffs, FieldDiff{st.Field(i).Name, o, n})
+			}
+		}
+		if len(fieldDiffs) > 0 {
+			diffs = append(diffs, RecordDiff{Kind: Modified, Key: k, Fields: fieldDiffs})
+		}
+	}
+	for _, k := range keysOld {
+		if _, ok := mNew[k]; !ok {
+			diffs = append(diffs, RecordDiff{Kind: Removed, Key: k})
+		}
+	}
+	return diffs, nil
+}
@@ -0,0 +1,66 @@
+package util_test
+
+import (
+	"github.com/name5566/leaf/util"
+	"testing"
+)
+
+type monster struct {
+	ID       int
+	Name     string
+	HP       int
+	Drops    []int
+	Comment  string `diff:"-"`
+	internal int
+}
+
+func TestDiffRecords(t *testing.T) {
+	oldRecords := []*monster{
+		{ID: 100, Name: "slime", HP: 10, Drops: []int{1}},
+		{ID: 101, Name: "orc", HP: 100, Drops: []int{1, 2}},
+		{ID: 102, Name: "bat", HP: 5},
+	}
+	newRecords := []*monster{
+		{ID: 100, Name: "slime", HP: 10, Drops: []int{1}, Comment: "tweaked", internal: 1},
+		{ID: 101, Name: "orc", HP: 120, Drops: []int{1, 3}},
+		{ID: 103, Name: "dragon", HP: 5000},
+	}
+
+	diffs, err := util.DiffRecords(oldRecords, newRecords, "ID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"modified 101: HP 100 -> 120, Drops [1 2] -> [1 3]",
+		"added 103",
+		"removed 102",
+	}
+	if len(diffs) != len(want) {
+		t.Fatalf("got %v, want %v", diffs, want)
+	}
+	for i := range want {
+		if diffs[i].String() != want[i] {
+			t.Errorf("got %q, want %q", diffs[i], want[i])
+		}
+	}
+	if f := diffs[0].Fields[0]; f.Name != "HP" || f.Old != 100 || f.New != 120 {
+		t.Errorf("unexpected field diff %+v", f)
+	}
+
+	// structs
+	same, err := util.DiffRecords([]monster{{ID: 1, HP: 1}}, []monster{{ID: 1, HP: 1}}, "ID")
+	if err != nil || len(same) != 0 {
+		t.Fatalf("unexpected diff %v %v", same, err)
+	}
+
+	if _, err := util.DiffRecords(oldRecords, newRecords, "Key"); err == nil {
+		t.Fatal("unknown key accepted")
+	}
+	if _, err := util.DiffRecords(oldRecords, []monster{}, "ID"); err == nil {
+		t.Fatal("type mismatch accepted")
+	}
+	dup := []*monster{{ID: 1}, {ID: 1}}
+	if _, err := util.DiffRecords(dup, dup, "ID"); err == nil {
+		t.Fatal("duplicate key accepted")
+	}
+}
@@ -90,3 +90,21 @@ func ExampleDeepClone() {
 	// 2
 	// 3
 }
+
+func ExampleNewCounter() {
+	c := util.NewCounter("example.logins")
+	c.Inc()
+	c.Add(2)
+
+	g := util.NewGauge("example.online")
+	g.Set(10)
+	g.Dec()
+
+	snapshot := util.Metrics.Snapshot()
+	fmt.Println(snapshot["example.logins"])
+	fmt.Println(snapshot["example.online"])
+
+	// Output:
+	// 3
+	// 9
+}
@@ -0,0 +1,105 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// expired entries are removed lazily, by Sweep or by the sweeper
+// goroutine safe
+type ExpiringSet[T comparable] struct {
+	ttl       time.Duration
+	mutex     sync.Mutex
+	entries   map[T]time.Time
+	closeSig  chan struct{}
+	closeOnce sync.Once
+}
+
+// ttl is the time to live of the entries added by Add
+func NewExpiringSet[T comparable](ttl time.Duration) *ExpiringSet[T] {
+	s := new(ExpiringSet[T])
+	s.ttl = ttl
+	s.entries = make(map[T]time.Time)
+	s.closeSig = make(chan struct{})
+	return s
+}
+
+// returns false if v is already present and not expired
+func (s *ExpiringSet[T]) Add(v T) bool {
+	return s.AddTTL(v, s.ttl)
+}
+
+func (s *ExpiringSet[T]) AddTTL(v T, ttl time.Duration) bool {
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if deadline, ok := s.entries[v]; ok && now.Before(deadline) {
+		return false
+	}
+	s.entries[v] = now.Add(ttl)
+	return true
+}
+
+func (s *ExpiringSet[T]) Contains(v T) bool {
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	deadline, ok := s.entries[v]
+	if ok && !now.Before(deadline) {
+		delete(s.entries, v)
+		return false
+	}
+	return ok
+}
+
+func (s *ExpiringSet[T]) Remove(v T) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries, v)
+}
+
+// expired entries not swept yet are counted
+func (s *ExpiringSet[T]) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.entries)
+}
+
+// removes the expired entries
+func (s *ExpiringSet[T]) Sweep() {
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for v, deadline := range s.entries {
+		if !now.Before(deadline) {
+			delete(s.entries, v)
+		}
+	}
+}
+
+// calls Sweep every interval until Close is called
+// you must call the function at most once
+func (s *ExpiringSet[T]) StartSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.Sweep()
+			case <-s.closeSig:
+				return
+			}
+		}
+	}()
+}
+
+// stops the sweeper
+func (s *ExpiringSet[T]) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closeSig)
+	})
+}
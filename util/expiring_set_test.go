@@ -0,0 +1,78 @@
+package util_test
+
+import (
+	"github.com/name5566/leaf/util"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExpiringSet(t *testing.T) {
+	s := util.NewExpiringSet[string](50 * time.Millisecond)
+
+	if !s.Add("req-1") {
+		t.Fatal("first Add returned false")
+	}
+	if s.Add("req-1") {
+		t.Fatal("duplicate accepted within the ttl")
+	}
+	if !s.AddTTL("req-2", time.Hour) || !s.Contains("req-2") {
+		t.Fatal("req-2 not added")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if s.Contains("req-1") {
+		t.Fatal("req-1 not expired")
+	}
+	if !s.Add("req-1") {
+		t.Fatal("Add returned false after expiry")
+	}
+	if !s.Contains("req-2") {
+		t.Fatal("req-2 expired")
+	}
+
+	s.Remove("req-2")
+	if s.Contains("req-2") {
+		t.Fatal("req-2 not removed")
+	}
+}
+
+func TestExpiringSet_Sweeper(t *testing.T) {
+	s := util.NewExpiringSet[int](10 * time.Millisecond)
+	s.StartSweeper(5 * time.Millisecond)
+	defer s.Close()
+
+	for i := 0; i < 100; i++ {
+		s.Add(i)
+	}
+	for i := 0; i < 100 && s.Len() > 0; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := s.Len(); n != 0 {
+		t.Fatalf("%v entries not swept", n)
+	}
+}
+
+func TestExpiringSet_Concurrent(t *testing.T) {
+	s := util.NewExpiringSet[int](time.Hour)
+
+	var added int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if s.Add(j) {
+					atomic.AddInt32(&added, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if added != 100 {
+		t.Fatalf("%v ids added, want 100", added)
+	}
+}
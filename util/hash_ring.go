@@ -0,0 +1,124 @@
+package util
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// consistent hashing, a node of weight w owns w * replicas virtual nodes
+// goroutine safe
+type HashRing struct {
+	replicas int
+	mutex    sync.RWMutex
+	weights  map[string]int
+	hashes   []uint64
+	owners   map[uint64]string
+}
+
+func NewHashRing(replicas int) *HashRing {
+	if replicas <= 0 {
+		replicas = 100
+	}
+
+	r := new(HashRing)
+	r.replicas = replicas
+	r.weights = make(map[string]int)
+	r.owners = make(map[uint64]string)
+	return r
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// mix the bits, fnv alone clusters similar keys
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+func vnode(node string, i int) string {
+	return node + "#" + strconv.Itoa(i)
+}
+
+// adding a node again changes its weight
+func (r *HashRing) Add(node string, weight int) {
+	if weight <= 0 {
+		weight = 1
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.remove(node)
+	r.weights[node] = weight
+	for i := 0; i < weight*r.replicas; i++ {
+		h := hashKey(vnode(node, i))
+		if _, ok := r.owners[h]; ok {
+			continue
+		}
+		r.owners[h] = node
+		r.hashes = append(r.hashes, h)
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+func (r *HashRing) Remove(node string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.remove(node)
+}
+
+func (r *HashRing) remove(node string) {
+	weight, ok := r.weights[node]
+	if !ok {
+		return
+	}
+	delete(r.weights, node)
+	for i := 0; i < weight*r.replicas; i++ {
+		h := hashKey(vnode(node, i))
+		if r.owners[h] == node {
+			delete(r.owners, h)
+		}
+	}
+
+	hashes := r.hashes[:0]
+	for _, h := range r.hashes {
+		if _, ok := r.owners[h]; ok {
+			hashes = append(hashes, h)
+		}
+	}
+	r.hashes = hashes
+}
+
+// returns "" if the ring is empty
+func (r *HashRing) Get(key string) string {
+	h := hashKey(key)
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]]
+}
+
+func (r *HashRing) Nodes() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	nodes := make([]string, 0, len(r.weights))
+	for node := range r.weights {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
@@ -0,0 +1,90 @@
+package util_test
+
+import (
+	"fmt"
+	"github.com/name5566/leaf/util"
+	"testing"
+)
+
+const ringKeys = 10000
+
+func ringAssign(r *util.HashRing) map[string]string {
+	m := make(map[string]string)
+	for i := 0; i < ringKeys; i++ {
+		key := fmt.Sprintf("player%v", i)
+		m[key] = r.Get(key)
+	}
+	return m
+}
+
+func ringCount(m map[string]string) map[string]int {
+	c := make(map[string]int)
+	for _, node := range m {
+		c[node]++
+	}
+	return c
+}
+
+func TestHashRing_Balance(t *testing.T) {
+	r := util.NewHashRing(100)
+	if r.Get("player") != "" {
+		t.Fatal("empty ring returned a node")
+	}
+	r.Add("a", 1)
+	r.Add("b", 1)
+	r.Add("c", 1)
+	r.Add("d", 2)
+
+	c := ringCount(ringAssign(r))
+	unit := ringKeys / 5
+	for node, n := range c {
+		want := unit
+		if node == "d" {
+			want = 2 * unit
+		}
+		if n < want*4/5 || n > want*6/5 {
+			t.Errorf("node %v owns %v keys, want about %v", node, n, want)
+		}
+	}
+}
+
+func TestHashRing_Remap(t *testing.T) {
+	r := util.NewHashRing(100)
+	r.Add("a", 1)
+	r.Add("b", 1)
+	r.Add("c", 1)
+	before := ringAssign(r)
+
+	// only keys moving to the new node are remapped
+	r.Add("d", 1)
+	after := ringAssign(r)
+	moved := 0
+	for key, node := range after {
+		if node != before[key] {
+			if node != "d" {
+				t.Fatalf("key %v moved from %v to %v", key, before[key], node)
+			}
+			moved++
+		}
+	}
+	if moved < ringKeys/4*4/5 || moved > ringKeys/4*6/5 {
+		t.Errorf("%v keys moved, want about %v", moved, ringKeys/4)
+	}
+
+	// only the keys of the removed node are remapped
+	r.Remove("b")
+	removed := ringAssign(r)
+	for key, node := range removed {
+		if after[key] != "b" && node != after[key] {
+			t.Fatalf("key %v moved from %v to %v", key, after[key], node)
+		}
+		if node == "b" {
+			t.Fatalf("key %v still on the removed node", key)
+		}
+	}
+
+	r.Remove("b")
+	if nodes := r.Nodes(); fmt.Sprint(nodes) != "[a c d]" {
+		t.Fatalf("unexpected nodes %v", nodes)
+	}
+}
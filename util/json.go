@@ -0,0 +1,92 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// canonical JSON, object keys (including struct fields) sorted,
+// no insignificant whitespace and no HTML escaping
+func MarshalStable(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var generic interface{}
+	if err := d.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := writeStable(buf, generic); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeStable(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeString(buf, k); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeStable(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeStable(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case string:
+		return writeString(buf, v)
+	case json.Number:
+		buf.WriteString(v.String())
+	case bool:
+		if v {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+	case nil:
+		buf.WriteString("null")
+	default:
+		panic("bug")
+	}
+	return nil
+}
+
+func writeString(buf *bytes.Buffer, s string) error {
+	e := json.NewEncoder(buf)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(s); err != nil {
+		return err
+	}
+	// Encode appends a newline
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
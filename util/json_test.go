@@ -0,0 +1,56 @@
+package util_test
+
+import (
+	"github.com/name5566/leaf/util"
+	"testing"
+)
+
+type stableState struct {
+	Zone    string
+	Players map[string]int
+	Items   []map[string]interface{}
+}
+
+func TestMarshalStable(t *testing.T) {
+	a := map[string]interface{}{}
+	b := map[string]interface{}{}
+	keys := []string{"gold", "level", "name", "<tag>", "bag"}
+	for i := range keys {
+		a[keys[i]] = i
+		b[keys[len(keys)-1-i]] = len(keys) - 1 - i
+	}
+	a["nested"] = map[string]interface{}{"y": []interface{}{1, "x", nil}, "x": true}
+	b["nested"] = map[string]interface{}{"x": true, "y": []interface{}{1, "x", nil}}
+
+	da, err := util.MarshalStable(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := util.MarshalStable(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"<tag>":3,"bag":4,"gold":0,"level":1,"name":2,"nested":{"x":true,"y":[1,"x",null]}}`
+	if string(da) != want || string(db) != want {
+		t.Fatalf("got %s and %s, want %s", da, db, want)
+	}
+
+	s := stableState{
+		Zone:    "z1",
+		Players: map[string]int{"b": 2, "a": 1},
+		Items:   []map[string]interface{}{{"id": 10, "count": 1.5}},
+	}
+	for i := 0; i < 10; i++ {
+		data, err := util.MarshalStable(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `{"Items":[{"count":1.5,"id":10}],"Players":{"a":1,"b":2},"Zone":"z1"}`; string(data) != want {
+			t.Fatalf("got %s, want %s", data, want)
+		}
+	}
+
+	if _, err := util.MarshalStable(func() {}); err == nil {
+		t.Fatal("function marshaled")
+	}
+}
@@ -0,0 +1,104 @@
+package util
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+type Counter struct {
+	name  string
+	value atomic.Int64
+}
+
+type Gauge struct {
+	name  string
+	value atomic.Int64
+}
+
+type MetricsRegistry struct {
+	metrics sync.Map
+}
+
+var Metrics = new(MetricsRegistry)
+
+// goroutine safe
+// returns the counter already registered under name if any
+func NewCounter(name string) *Counter {
+	m, _ := Metrics.metrics.LoadOrStore(name, &Counter{name: name})
+	c, ok := m.(*Counter)
+	if !ok {
+		panic(fmt.Sprintf("metric %v: already registered as gauge", name))
+	}
+	return c
+}
+
+// goroutine safe
+// returns the gauge already registered under name if any
+func NewGauge(name string) *Gauge {
+	m, _ := Metrics.metrics.LoadOrStore(name, &Gauge{name: name})
+	g, ok := m.(*Gauge)
+	if !ok {
+		panic(fmt.Sprintf("metric %v: already registered as counter", name))
+	}
+	return g
+}
+
+func (c *Counter) Name() string {
+	return c.name
+}
+
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// n must not be negative
+func (c *Counter) Add(n int64) {
+	if n < 0 {
+		panic("counter cannot decrease")
+	}
+	c.value.Add(n)
+}
+
+func (c *Counter) Value() int64 {
+	return c.value.Load()
+}
+
+func (g *Gauge) Name() string {
+	return g.name
+}
+
+func (g *Gauge) Inc() {
+	g.value.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.value.Add(-1)
+}
+
+func (g *Gauge) Add(n int64) {
+	g.value.Add(n)
+}
+
+func (g *Gauge) Set(n int64) {
+	g.value.Store(n)
+}
+
+func (g *Gauge) Value() int64 {
+	return g.value.Load()
+}
+
+// goroutine safe
+func (r *MetricsRegistry) Snapshot() map[string]int64 {
+	snapshot := make(map[string]int64)
+	r.metrics.Range(func(k, v interface{}) bool {
+		switch m := v.(type) {
+		case *Counter:
+			snapshot[m.name] = m.Value()
+		case *Gauge:
+			snapshot[m.name] = m.Value()
+		}
+		return true
+	})
+	return snapshot
+}
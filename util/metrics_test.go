@@ -0,0 +1,41 @@
+package util_test
+
+import (
+	"github.com/name5566/leaf/util"
+	"sync"
+	"testing"
+)
+
+func TestMetrics_Concurrent(t *testing.T) {
+	c := util.NewCounter("test.requests")
+	g := util.NewGauge("test.online")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Inc()
+				util.NewCounter("test.requests").Add(2)
+				g.Inc()
+				g.Dec()
+			}
+		}()
+	}
+	wg.Wait()
+	g.Add(5)
+
+	snapshot := util.Metrics.Snapshot()
+	if snapshot["test.requests"] != 30000 {
+		t.Errorf("counter: got %v, want 30000", snapshot["test.requests"])
+	}
+	if snapshot["test.online"] != 5 {
+		t.Errorf("gauge: got %v, want 5", snapshot["test.online"])
+	}
+
+	g.Set(-1)
+	if g.Value() != -1 {
+		t.Errorf("gauge: got %v, want -1", g.Value())
+	}
+}
@@ -0,0 +1,105 @@
+package util
+
+import (
+	"errors"
+)
+
+var ErrNone = errors.New("option is none")
+
+// a value or none, the zero value is none
+type Option[T any] struct {
+	value T
+	some  bool
+}
+
+func Some[T any](v T) Option[T] {
+	return Option[T]{v, true}
+}
+
+func None[T any]() Option[T] {
+	return Option[T]{}
+}
+
+// the result of a (v, ok) lookup
+func OptionOf[T any](v T, ok bool) Option[T] {
+	if !ok {
+		return None[T]()
+	}
+	return Some(v)
+}
+
+func (o Option[T]) IsSome() bool {
+	return o.some
+}
+
+func (o Option[T]) IsNone() bool {
+	return !o.some
+}
+
+// panics if o is none
+func (o Option[T]) Unwrap() T {
+	if !o.some {
+		panic(ErrNone)
+	}
+	return o.value
+}
+
+func (o Option[T]) UnwrapOr(v T) T {
+	if !o.some {
+		return v
+	}
+	return o.value
+}
+
+func (o Option[T]) Get() (T, bool) {
+	return o.value, o.some
+}
+
+// a value or an error, the zero value is ok with the zero value of T
+type Result[T any] struct {
+	value T
+	err   error
+}
+
+func Ok[T any](v T) Result[T] {
+	return Result[T]{value: v}
+}
+
+func Err[T any](err error) Result[T] {
+	return Result[T]{err: err}
+}
+
+// the result of a (v, err) call
+func ResultOf[T any](v T, err error) Result[T] {
+	if err != nil {
+		return Err[T](err)
+	}
+	return Ok(v)
+}
+
+func (r Result[T]) IsOk() bool {
+	return r.err == nil
+}
+
+func (r Result[T]) Err() error {
+	return r.err
+}
+
+// panics with the error if r is not ok
+func (r Result[T]) Unwrap() T {
+	if r.err != nil {
+		panic(r.err)
+	}
+	return r.value
+}
+
+func (r Result[T]) UnwrapOr(v T) T {
+	if r.err != nil {
+		return v
+	}
+	return r.value
+}
+
+func (r Result[T]) Get() (T, error) {
+	return r.value, r.err
+}
@@ -0,0 +1,68 @@
+package util_test
+
+import (
+	"errors"
+	"github.com/name5566/leaf/util"
+	"strconv"
+	"testing"
+)
+
+func TestOption(t *testing.T) {
+	var zero util.Option[int]
+	if zero.IsSome() || !zero.IsNone() || zero.UnwrapOr(7) != 7 {
+		t.Fatal("zero option not none")
+	}
+	if v, ok := zero.Get(); v != 0 || ok {
+		t.Fatalf("got %v %v", v, ok)
+	}
+
+	o := util.Some(0)
+	if !o.IsSome() || o.Unwrap() != 0 || o.UnwrapOr(7) != 0 {
+		t.Fatal("some zero value not some")
+	}
+
+	m := map[string]int{"a": 1}
+	v, ok := m["a"]
+	if util.OptionOf(v, ok).Unwrap() != 1 {
+		t.Fatal("unexpected value")
+	}
+	v, ok = m["b"]
+	if util.OptionOf(v, ok).IsSome() {
+		t.Fatal("missing key is some")
+	}
+
+	defer func() {
+		if r := recover(); r != util.ErrNone {
+			t.Fatalf("got %v, want ErrNone", r)
+		}
+	}()
+	util.None[string]().Unwrap()
+}
+
+func TestResult(t *testing.T) {
+	var zero util.Result[string]
+	if !zero.IsOk() || zero.Err() != nil || zero.Unwrap() != "" {
+		t.Fatal("zero result not ok")
+	}
+
+	r := util.ResultOf(strconv.Atoi("42"))
+	if !r.IsOk() || r.Unwrap() != 42 {
+		t.Fatalf("got %v", r.Err())
+	}
+
+	r = util.ResultOf(strconv.Atoi("x"))
+	if r.IsOk() || r.Err() == nil || r.UnwrapOr(-1) != -1 {
+		t.Fatal("failed result ok")
+	}
+	if _, err := r.Get(); !errors.Is(err, strconv.ErrSyntax) {
+		t.Fatalf("got %v", err)
+	}
+
+	errBad := errors.New("bad")
+	defer func() {
+		if r := recover(); r != errBad {
+			t.Fatalf("got %v, want the error", r)
+		}
+	}()
+	util.Err[int](errBad).Unwrap()
+}
@@ -0,0 +1,115 @@
+package util
+
+import (
+	"container/heap"
+)
+
+// the element with the highest priority (less than the others) comes first
+// one PriorityQueue per goroutine (goroutine not safe)
+type PriorityQueue[T any] struct {
+	h pqHeap[T]
+}
+
+// a handle on an element of a PriorityQueue, to update it
+type PQItem[T any] struct {
+	value T
+	// -1 once popped
+	index int
+}
+
+func (item *PQItem[T]) Value() T {
+	return item.value
+}
+
+type pqHeap[T any] struct {
+	items []*PQItem[T]
+	less  func(a, b T) bool
+}
+
+func (h *pqHeap[T]) Len() int {
+	return len(h.items)
+}
+
+func (h *pqHeap[T]) Less(i, j int) bool {
+	return h.less(h.items[i].value, h.items[j].value)
+}
+
+func (h *pqHeap[T]) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *pqHeap[T]) Push(x interface{}) {
+	item := x.(*PQItem[T])
+	item.index = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *pqHeap[T]) Pop() interface{} {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items[n-1] = nil
+	h.items = h.items[:n-1]
+	item.index = -1
+	return item
+}
+
+// less reports whether a has a higher priority than b
+func NewPriorityQueue[T any](less func(a, b T) bool) *PriorityQueue[T] {
+	pq := new(PriorityQueue[T])
+	pq.h.less = less
+	return pq
+}
+
+func (pq *PriorityQueue[T]) Push(v T) *PQItem[T] {
+	item := &PQItem[T]{value: v}
+	heap.Push(&pq.h, item)
+	return item
+}
+
+// removes the element with the highest priority, false if empty
+func (pq *PriorityQueue[T]) Pop() (T, bool) {
+	if len(pq.h.items) == 0 {
+		var zero T
+		return zero, false
+	}
+	return heap.Pop(&pq.h).(*PQItem[T]).value, true
+}
+
+// the element with the highest priority, false if empty
+func (pq *PriorityQueue[T]) Peek() (T, bool) {
+	if len(pq.h.items) == 0 {
+		var zero T
+		return zero, false
+	}
+	return pq.h.items[0].value, true
+}
+
+func (pq *PriorityQueue[T]) Len() int {
+	return len(pq.h.items)
+}
+
+// replaces the element of item and moves it to its new priority,
+// returns false if item is no longer in the queue
+func (pq *PriorityQueue[T]) Update(item *PQItem[T], v T) bool {
+	if !pq.contains(item) {
+		return false
+	}
+	item.value = v
+	heap.Fix(&pq.h, item.index)
+	return true
+}
+
+// returns false if item is no longer in the queue
+func (pq *PriorityQueue[T]) Remove(item *PQItem[T]) bool {
+	if !pq.contains(item) {
+		return false
+	}
+	heap.Remove(&pq.h, item.index)
+	return true
+}
+
+func (pq *PriorityQueue[T]) contains(item *PQItem[T]) bool {
+	return item.index >= 0 && item.index < len(pq.h.items) && pq.h.items[item.index] == item
+}
@@ -0,0 +1,126 @@
+package util_test
+
+import (
+	"github.com/name5566/leaf/util"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func popAll(pq *util.PriorityQueue[int]) []int {
+	var s []int
+	for {
+		v, ok := pq.Pop()
+		if !ok {
+			return s
+		}
+		s = append(s, v)
+	}
+}
+
+func TestPriorityQueue(t *testing.T) {
+	pq := util.NewPriorityQueue(func(a, b int) bool { return a < b })
+	if _, ok := pq.Peek(); ok {
+		t.Fatal("peek of an empty queue")
+	}
+	if _, ok := pq.Pop(); ok {
+		t.Fatal("pop of an empty queue")
+	}
+
+	for _, v := range []int{5, 1, 4, 1, 3} {
+		pq.Push(v)
+	}
+	if v, _ := pq.Peek(); v != 1 || pq.Len() != 5 {
+		t.Fatalf("peek %v, len %v", v, pq.Len())
+	}
+	if got := popAll(pq); !sort.IntsAreSorted(got) || len(got) != 5 {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestPriorityQueue_Update(t *testing.T) {
+	pq := util.NewPriorityQueue(func(a, b int) bool { return a > b })
+	items := make([]*util.PQItem[int], 5)
+	for i := range items {
+		items[i] = pq.Push(i * 10)
+	}
+
+	pq.Update(items[0], 100)
+	pq.Update(items[4], -1)
+	if !pq.Remove(items[2]) {
+		t.Fatal("item not removed")
+	}
+	if v, _ := pq.Peek(); v != 100 || items[0].Value() != 100 {
+		t.Fatalf("peek %v after update", v)
+	}
+	got := popAll(pq)
+	want := []int{100, 30, 10, -1}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+
+	if pq.Update(items[0], 1) || pq.Remove(items[2]) {
+		t.Fatal("popped item updated")
+	}
+	if pq.Len() != 0 {
+		t.Fatalf("len %v after updating a popped item", pq.Len())
+	}
+}
+
+func TestPriorityQueue_Mixed(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	pq := util.NewPriorityQueue(func(a, b int) bool { return a < b })
+	var items []*util.PQItem[int]
+	var ref []int
+	for i := 0; i < 1000; i++ {
+		switch r.Intn(3) {
+		case 0:
+			v := r.Intn(100)
+			items = append(items, pq.Push(v))
+			ref = append(ref, v)
+		case 1:
+			v, ok := pq.Pop()
+			if ok != (len(ref) > 0) {
+				t.Fatalf("pop ok %v with %v elements", ok, len(ref))
+			}
+			if !ok {
+				continue
+			}
+			sort.Ints(ref)
+			if v != ref[0] {
+				t.Fatalf("popped %v, want %v", v, ref[0])
+			}
+			ref = ref[1:]
+		case 2:
+			if len(items) == 0 {
+				continue
+			}
+			item := items[r.Intn(len(items))]
+			old := item.Value()
+			v := r.Intn(100)
+			if pq.Update(item, v) {
+				for j := range ref {
+					if ref[j] == old {
+						ref[j] = v
+						break
+					}
+				}
+			}
+		}
+		if pq.Len() != len(ref) {
+			t.Fatalf("len %v, want %v", pq.Len(), len(ref))
+		}
+	}
+	sort.Ints(ref)
+	got := popAll(pq)
+	for i := range ref {
+		if got[i] != ref[i] {
+			t.Fatalf("got %v, want %v", got, ref)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package util
 
 import (
+	"math"
 	"math/rand"
+	"sort"
 	"time"
 )
 
@@ -89,3 +91,84 @@ func RandIntervalN(b1, b2 int32, n uint32) []int32 {
 
 	return r
 }
+
+// the source of the random functions, nil is the global source of math/rand
+func randIntn(r *rand.Rand, n int) int {
+	if r == nil {
+		return rand.Intn(n)
+	}
+	return r.Intn(n)
+}
+
+func randFloat64(r *rand.Rand) float64 {
+	if r == nil {
+		return rand.Float64()
+	}
+	return r.Float64()
+}
+
+// Fisher-Yates shuffle in place, the order is reproducible from the seed
+// of r, nil r is the global source
+func Shuffle[T any](s []T, r *rand.Rand) {
+	for i := len(s) - 1; i > 0; i-- {
+		j := randIntn(r, i+1)
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+// k distinct elements of pop in a random order, all of them shuffled if k
+// is larger than pop, pop is not modified
+// nil r is the global source
+func SampleWithoutReplacement[T any](pop []T, k int, r *rand.Rand) []T {
+	if k > len(pop) {
+		k = len(pop)
+	}
+	if k <= 0 {
+		return nil
+	}
+
+	// partial Fisher-Yates on a copy
+	s := append([]T(nil), pop...)
+	for i := 0; i < k; i++ {
+		j := i + randIntn(r, len(s)-i)
+		s[i], s[j] = s[j], s[i]
+	}
+	return s[:k:k]
+}
+
+// k distinct elements of pop, an element is taken with a probability
+// proportional to its weight among the elements left (Efraimidis-Spirakis),
+// the elements of weight 0 are never taken so fewer than k may be returned
+// nil r is the global source
+func WeightedSampleWithoutReplacement[T any](pop []T, weights []float64, k int, r *rand.Rand) []T {
+	if len(weights) != len(pop) {
+		panic("weights and population lengths differ")
+	}
+
+	type keyed struct {
+		key float64
+		i   int
+	}
+	keys := make([]keyed, 0, len(pop))
+	for i, w := range weights {
+		if w > 0 {
+			// the largest u^(1/w) are taken, compared by log(u)/w
+			keys = append(keys, keyed{math.Log(randFloat64(r)) / w, i})
+		}
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		return keys[a].key > keys[b].key
+	})
+
+	if k > len(keys) {
+		k = len(keys)
+	}
+	if k <= 0 {
+		return nil
+	}
+	s := make([]T, k)
+	for i := range s {
+		s[i] = pop[keys[i].i]
+	}
+	return s
+}
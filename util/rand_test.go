@@ -0,0 +1,104 @@
+package util_test
+
+import (
+	"fmt"
+	"github.com/name5566/leaf/util"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestShuffle_Seed(t *testing.T) {
+	a := []int{1, 2, 3, 4, 5, 6, 7, 8}
+	b := append([]int(nil), a...)
+	util.Shuffle(a, rand.New(rand.NewSource(42)))
+	util.Shuffle(b, rand.New(rand.NewSource(42)))
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("got %v and %v with the same seed", a, b)
+	}
+
+	s := util.SampleWithoutReplacement([]string{"a", "b", "c", "d"}, 2, rand.New(rand.NewSource(7)))
+	s2 := util.SampleWithoutReplacement([]string{"a", "b", "c", "d"}, 2, rand.New(rand.NewSource(7)))
+	if !reflect.DeepEqual(s, s2) {
+		t.Fatalf("got %v and %v with the same seed", s, s2)
+	}
+
+	util.Shuffle([]int{}, nil)
+}
+
+// within 5% of the expected count
+func checkFair(t *testing.T, counts map[string]int, n int, want float64) {
+	for k, c := range counts {
+		if d := float64(c) - want; d > want*0.05 || d < -want*0.05 {
+			t.Fatalf("%v: %v of %v, want about %v", k, c, n, want)
+		}
+	}
+}
+
+func TestShuffle_Fair(t *testing.T) {
+	const n = 60000
+	r := rand.New(rand.NewSource(1))
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		s := []int{0, 1, 2}
+		util.Shuffle(s, r)
+		counts[fmt.Sprint(s)]++
+	}
+	if len(counts) != 6 {
+		t.Fatalf("got %v permutations, want 6", len(counts))
+	}
+	checkFair(t, counts, n, n/6)
+}
+
+func TestSampleWithoutReplacement(t *testing.T) {
+	pop := []int{0, 1, 2, 3, 4}
+	if s := util.SampleWithoutReplacement(pop, 10, nil); len(s) != 5 {
+		t.Fatalf("got %v, want the whole population", s)
+	}
+	if s := util.SampleWithoutReplacement([]int{}, 2, nil); len(s) != 0 {
+		t.Fatalf("got %v from an empty population", s)
+	}
+
+	const n = 50000
+	r := rand.New(rand.NewSource(1))
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		s := util.SampleWithoutReplacement(pop, 2, r)
+		if len(s) != 2 || s[0] == s[1] {
+			t.Fatalf("invalid sample %v", s)
+		}
+		for _, v := range s {
+			counts[fmt.Sprint(v)]++
+		}
+	}
+	if !reflect.DeepEqual(pop, []int{0, 1, 2, 3, 4}) {
+		t.Fatalf("population modified: %v", pop)
+	}
+	checkFair(t, counts, n, n*2/5)
+}
+
+func TestWeightedSampleWithoutReplacement(t *testing.T) {
+	pop := []string{"common", "rare", "never"}
+	weights := []float64{3, 1, 0}
+	if s := util.WeightedSampleWithoutReplacement(pop, weights, 3, nil); len(s) != 2 {
+		t.Fatalf("got %v, want the elements of positive weight", s)
+	}
+
+	const n = 40000
+	r := rand.New(rand.NewSource(1))
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[util.WeightedSampleWithoutReplacement(pop, weights, 1, r)[0]]++
+	}
+	checkFair(t, map[string]int{"common": counts["common"]}, n, n*3/4)
+	checkFair(t, map[string]int{"rare": counts["rare"]}, n, n/4)
+	if counts["never"] != 0 {
+		t.Fatal("element of weight 0 taken")
+	}
+
+	a := util.WeightedSampleWithoutReplacement(pop, weights, 2, rand.New(rand.NewSource(3)))
+	b := util.WeightedSampleWithoutReplacement(pop, weights, 2, rand.New(rand.NewSource(3)))
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("got %v and %v with the same seed", a, b)
+	}
+}
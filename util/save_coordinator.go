@@ -0,0 +1,129 @@
+package util
+
+import (
+	"context"
+	"github.com/name5566/leaf/log"
+	"sync"
+	"time"
+)
+
+// saves the ids marked dirty on a worker pool, at most one save per id is
+// in flight, the marks arriving meanwhile are coalesced into one more save
+// and a failed save is retried
+// goroutine safe
+type SaveCoordinator struct {
+	save   func(id string) error
+	retry  time.Duration
+	queue  *WorkerQueue
+	mutex  sync.Mutex
+	saves  map[string]*pendingSave
+	wg     sync.WaitGroup
+	closed bool
+}
+
+// the id has a save queued, running or waiting for a retry
+type pendingSave struct {
+	// changed since the last save started
+	dirty bool
+}
+
+// n workers call save, a failed save is retried after retry
+func NewSaveCoordinator(n int, retry time.Duration, save func(id string) error) *SaveCoordinator {
+	if retry <= 0 {
+		retry = time.Second
+		log.Release("invalid retry, reset to %v", retry)
+	}
+
+	c := new(SaveCoordinator)
+	c.save = save
+	c.retry = retry
+	c.queue = NewWorkerQueue(n, 0)
+	c.queue.Block = true
+	c.saves = make(map[string]*pendingSave)
+	return c
+}
+
+func (c *SaveCoordinator) MarkDirty(id string) {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		log.Error("save coordinator closed, %v not saved", id)
+		return
+	}
+	if s, ok := c.saves[id]; ok {
+		s.dirty = true
+		c.mutex.Unlock()
+		return
+	}
+	c.saves[id] = &pendingSave{dirty: true}
+	c.wg.Add(1)
+	c.mutex.Unlock()
+
+	c.submit(id)
+}
+
+func (c *SaveCoordinator) submit(id string) {
+	err := c.queue.Submit(func() {
+		c.run(id)
+	})
+	if err != nil {
+		log.Error("save %v: %v", id, err)
+		c.done(id)
+	}
+}
+
+func (c *SaveCoordinator) done(id string) {
+	c.mutex.Lock()
+	delete(c.saves, id)
+	c.mutex.Unlock()
+	c.wg.Done()
+}
+
+// the marks arriving during a save are saved by the same worker
+func (c *SaveCoordinator) run(id string) {
+	for {
+		c.mutex.Lock()
+		s := c.saves[id]
+		s.dirty = false
+		c.mutex.Unlock()
+
+		if err := c.save(id); err != nil {
+			log.Error("save %v: %v, retry in %v", id, err, c.retry)
+			time.AfterFunc(c.retry, func() {
+				c.submit(id)
+			})
+			return
+		}
+
+		c.mutex.Lock()
+		if !s.dirty {
+			delete(c.saves, id)
+			c.mutex.Unlock()
+			c.wg.Done()
+			return
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// stops accepting marks and waits until the pending saves are done or
+// ctx is done, the saves still failing are then dropped
+func (c *SaveCoordinator) Close(ctx context.Context) error {
+	c.mutex.Lock()
+	c.closed = true
+	c.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		c.queue.Shutdown(ctx)
+		return ctx.Err()
+	}
+	return c.queue.Shutdown(ctx)
+}
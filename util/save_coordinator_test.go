@@ -0,0 +1,88 @@
+package util_test
+
+import (
+	"context"
+	"errors"
+	"github.com/name5566/leaf/util"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSaveCoordinator_Coalesce(t *testing.T) {
+	var mutex sync.Mutex
+	saves := make(map[string]int)
+	inFlight := make(map[string]int)
+	var overlapped bool
+	c := util.NewSaveCoordinator(4, time.Second, func(id string) error {
+		mutex.Lock()
+		inFlight[id]++
+		if inFlight[id] > 1 {
+			overlapped = true
+		}
+		mutex.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mutex.Lock()
+		inFlight[id]--
+		saves[id]++
+		mutex.Unlock()
+		return nil
+	})
+
+	for i := 0; i < 100; i++ {
+		c.MarkDirty("a")
+		c.MarkDirty("b")
+	}
+	time.Sleep(30 * time.Millisecond)
+	c.MarkDirty("a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if overlapped {
+		t.Fatal("concurrent saves of an id")
+	}
+	// the first save, then one for the marks made during it
+	if saves["a"] < 2 || saves["a"] > 3 || saves["b"] < 1 || saves["b"] > 2 {
+		t.Fatalf("saves not coalesced: %v", saves)
+	}
+}
+
+func TestSaveCoordinator_Retry(t *testing.T) {
+	var mutex sync.Mutex
+	var calls int
+	c := util.NewSaveCoordinator(1, 10*time.Millisecond, func(id string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls++
+		if calls < 3 {
+			return errors.New("db down")
+		}
+		return nil
+	})
+
+	c.MarkDirty("a")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if calls != 3 {
+		t.Fatalf("%v calls, want 3", calls)
+	}
+
+	// closed
+	c.MarkDirty("b")
+	if calls != 3 {
+		t.Fatal("saved after Close")
+	}
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// counts the events of the last window, in buckets of window/buckets,
+// the oldest bucket expires at once so Count is approximate by up to
+// one bucket
+// goroutine safe
+type SlidingWindow struct {
+	mutex     sync.Mutex
+	bucketLen int64
+	counts    []int
+	// the bucket number of each slot, since the Unix epoch
+	stamps []int64
+}
+
+func NewSlidingWindow(window time.Duration, buckets int) *SlidingWindow {
+	if buckets <= 0 {
+		buckets = 1
+	}
+	w := new(SlidingWindow)
+	w.bucketLen = int64(window) / int64(buckets)
+	if w.bucketLen <= 0 {
+		w.bucketLen = 1
+	}
+	w.counts = make([]int, buckets)
+	w.stamps = make([]int64, buckets)
+	return w
+}
+
+func (w *SlidingWindow) Incr() {
+	w.Add(1)
+}
+
+func (w *SlidingWindow) Add(n int) {
+	bucket := time.Now().UnixNano() / w.bucketLen
+	slot := int(bucket % int64(len(w.counts)))
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.stamps[slot] != bucket {
+		w.stamps[slot] = bucket
+		w.counts[slot] = 0
+	}
+	w.counts[slot] += n
+}
+
+func (w *SlidingWindow) Count() int {
+	bucket := time.Now().UnixNano() / w.bucketLen
+	oldest := bucket - int64(len(w.counts))
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	var count int
+	for i, stamp := range w.stamps {
+		if stamp > oldest {
+			count += w.counts[i]
+		}
+	}
+	return count
+}
@@ -0,0 +1,62 @@
+package util_test
+
+import (
+	"github.com/name5566/leaf/util"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSlidingWindow(t *testing.T) {
+	w := util.NewSlidingWindow(200*time.Millisecond, 4)
+
+	for i := 0; i < 3; i++ {
+		w.Incr()
+	}
+	if c := w.Count(); c != 3 {
+		t.Fatalf("got %v, want 3", c)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	w.Add(2)
+	if c := w.Count(); c != 5 {
+		t.Fatalf("got %v, want 5", c)
+	}
+
+	// the first events expire, then the others
+	time.Sleep(150 * time.Millisecond)
+	if c := w.Count(); c != 2 {
+		t.Fatalf("got %v, want 2", c)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if c := w.Count(); c != 0 {
+		t.Fatalf("got %v, want 0", c)
+	}
+}
+
+func TestSlidingWindow_Concurrent(t *testing.T) {
+	w := util.NewSlidingWindow(time.Minute, 60)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				w.Incr()
+			}
+		}()
+	}
+	wg.Wait()
+	if c := w.Count(); c != 1000 {
+		t.Fatalf("got %v, want 1000", c)
+	}
+}
+
+func BenchmarkSlidingWindow_Incr(b *testing.B) {
+	w := util.NewSlidingWindow(10*time.Second, 10)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w.Incr()
+	}
+}
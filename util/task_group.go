@@ -0,0 +1,86 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"github.com/name5566/leaf/go"
+)
+
+// f panicked, the panic itself is reported by the Go
+var ErrTaskPanic = errors.New("task panicked")
+
+// tasks run by a Go, their results are collected by the callbacks on the
+// goroutine which owns the Go, like the callbacks of g.Go
+// one TaskGroup per goroutine (goroutine not safe)
+type TaskGroup struct {
+	g       *g.Go
+	ctx     context.Context
+	cancel  context.CancelFunc
+	pending int
+	errs    []error
+	// the context of the tasks is canceled by the first error
+	cancelOnError bool
+}
+
+func NewTaskGroup(d *g.Go, cancelOnError bool) *TaskGroup {
+	tg := new(TaskGroup)
+	tg.g = d
+	tg.ctx, tg.cancel = context.WithCancel(context.Background())
+	tg.cancelOnError = cancelOnError
+	return tg
+}
+
+// f must return when ctx is done, cb (may be nil) is called with the
+// result of f on the goroutine which owns the Go
+func (tg *TaskGroup) Go(f func(ctx context.Context) error, cb func(err error)) {
+	tg.pending++
+
+	var err error
+	tg.g.Go(func() {
+		// still set if f panics, the Go recovers
+		err = ErrTaskPanic
+		err = f(tg.ctx)
+		if err != nil && tg.cancelOnError {
+			tg.cancel()
+		}
+	}, func() {
+		if err == ErrTaskPanic && tg.cancelOnError {
+			tg.cancel()
+		}
+		tg.pending--
+		if err != nil {
+			tg.errs = append(tg.errs, err)
+		}
+		if cb != nil {
+			cb(err)
+		}
+	})
+}
+
+// executes the callbacks of the Go until the tasks are done, then returns
+// the first error, the callbacks of other tasks of the Go are executed too
+// the context of the tasks is canceled when Wait returns
+func (tg *TaskGroup) Wait() error {
+	for tg.pending > 0 {
+		tg.g.Cb(<-tg.g.ChanCb)
+	}
+	tg.cancel()
+	return tg.Err()
+}
+
+// the first error in the order of the callbacks, nil if none
+func (tg *TaskGroup) Err() error {
+	if len(tg.errs) == 0 {
+		return nil
+	}
+	return tg.errs[0]
+}
+
+// the errors in the order of the callbacks
+func (tg *TaskGroup) Errors() []error {
+	return tg.errs
+}
+
+func (tg *TaskGroup) Pending() int {
+	return tg.pending
+}
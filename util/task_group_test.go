@@ -0,0 +1,93 @@
+package util_test
+
+import (
+	"context"
+	"errors"
+	"github.com/name5566/leaf/go"
+	"github.com/name5566/leaf/util"
+	"testing"
+	"time"
+)
+
+func TestTaskGroup_Errors(t *testing.T) {
+	d := g.New(10)
+	tg := util.NewTaskGroup(d, false)
+
+	errA := errors.New("a")
+	errB := errors.New("b")
+	var results []error
+	cb := func(err error) {
+		results = append(results, err)
+	}
+	tg.Go(func(ctx context.Context) error {
+		return nil
+	}, cb)
+	tg.Go(func(ctx context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		return errA
+	}, cb)
+	tg.Go(func(ctx context.Context) error {
+		time.Sleep(30 * time.Millisecond)
+		return errB
+	}, cb)
+	tg.Go(func(ctx context.Context) error {
+		panic("task")
+	}, cb)
+
+	if err := tg.Wait(); err == nil {
+		t.Fatal("no error")
+	}
+	if len(results) != 4 || tg.Pending() != 0 || !d.Idle() {
+		t.Fatalf("got %v callbacks, %v pending", len(results), tg.Pending())
+	}
+	errs := tg.Errors()
+	if len(errs) != 3 {
+		t.Fatalf("got errors %v, want 3", errs)
+	}
+	var panics int
+	for _, err := range errs {
+		if err == util.ErrTaskPanic {
+			panics++
+		}
+	}
+	if panics != 1 || errs[len(errs)-1] != errB {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+}
+
+func TestTaskGroup_CancelOnError(t *testing.T) {
+	d := g.New(10)
+	tg := util.NewTaskGroup(d, true)
+
+	errFailed := errors.New("failed")
+	tg.Go(func(ctx context.Context) error {
+		return errFailed
+	}, nil)
+	for i := 0; i < 3; i++ {
+		tg.Go(func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+				return nil
+			}
+		}, nil)
+	}
+
+	start := time.Now()
+	if err := tg.Wait(); err != errFailed {
+		t.Fatalf("got %v, want %v", err, errFailed)
+	}
+	if time.Since(start) >= time.Second {
+		t.Fatal("tasks not canceled")
+	}
+	errs := tg.Errors()
+	if len(errs) != 4 {
+		t.Fatalf("got errors %v, want 4", errs)
+	}
+	for _, err := range errs[1:] {
+		if err != context.Canceled {
+			t.Fatalf("got %v, want context.Canceled", err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"github.com/name5566/leaf/conf"
+	"github.com/name5566/leaf/log"
+	"runtime"
+	"sync"
+)
+
+var (
+	ErrQueueFull   = errors.New("worker queue full")
+	ErrQueueClosed = errors.New("worker queue closed")
+)
+
+// goroutine safe
+type WorkerQueue struct {
+	// Submit waits for room in the queue instead of returning ErrQueueFull
+	// you must set it before calling Submit
+	Block bool
+
+	jobs      chan func()
+	quit      chan struct{}
+	closeOnce sync.Once
+	mutex     sync.RWMutex
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// n workers run the jobs, at most l jobs are waiting for a worker
+func NewWorkerQueue(n int, l int) *WorkerQueue {
+	if n <= 0 {
+		n = 1
+	}
+	if l < 0 {
+		l = 0
+	}
+
+	q := new(WorkerQueue)
+	q.jobs = make(chan func(), l)
+	q.quit = make(chan struct{})
+	q.wg.Add(n)
+	for i := 0; i < n; i++ {
+		go q.work()
+	}
+	return q
+}
+
+func (q *WorkerQueue) work() {
+	defer q.wg.Done()
+	for job := range q.jobs {
+		q.exec(job)
+	}
+}
+
+func (q *WorkerQueue) exec(job func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			if n := conf.Current().LenStackBuf; n > 0 {
+				buf := make([]byte, n)
+				l := runtime.Stack(buf, false)
+				log.Error("%v: %s", r, buf[:l])
+			} else {
+				log.Error("%v", r)
+			}
+		}
+	}()
+
+	job()
+}
+
+func (q *WorkerQueue) Submit(job func()) error {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	if q.Block {
+		select {
+		case q.jobs <- job:
+			return nil
+		case <-q.quit:
+			return ErrQueueClosed
+		}
+	}
+
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// stops accepting jobs and waits until the queued ones are done
+// or ctx is done, the jobs keep running in the latter case
+func (q *WorkerQueue) Shutdown(ctx context.Context) error {
+	q.closeOnce.Do(func() {
+		// wake up the blocked Submit
+		close(q.quit)
+
+		q.mutex.Lock()
+		q.closed = true
+		close(q.jobs)
+		q.mutex.Unlock()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
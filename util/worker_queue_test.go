@@ -0,0 +1,124 @@
+package util_test
+
+import (
+	"context"
+	"github.com/name5566/leaf/util"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerQueue_Full(t *testing.T) {
+	q := util.NewWorkerQueue(1, 1)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	if err := q.Submit(func() {
+		close(started)
+		<-release
+	}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	if err := q.Submit(func() {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Submit(func() {}); err != util.ErrQueueFull {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	close(release)
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Submit(func() {}); err != util.ErrQueueClosed {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestWorkerQueue_Block(t *testing.T) {
+	q := util.NewWorkerQueue(1, 0)
+	q.Block = true
+
+	release := make(chan struct{})
+	q.Submit(func() { <-release })
+
+	errs := make(chan error)
+	go func() {
+		errs <- q.Submit(func() {})
+	}()
+	select {
+	case err := <-errs:
+		t.Fatalf("Submit did not block: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	q.Shutdown(context.Background())
+}
+
+func TestWorkerQueue_Concurrency(t *testing.T) {
+	const workers = 4
+	q := util.NewWorkerQueue(workers, 100)
+
+	var running, max int32
+	var mutex sync.Mutex
+	for i := 0; i < 40; i++ {
+		err := q.Submit(func() {
+			n := atomic.AddInt32(&running, 1)
+			mutex.Lock()
+			if n > max {
+				max = n
+			}
+			mutex.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if max != workers {
+		t.Fatalf("%v jobs ran concurrently, want %v", max, workers)
+	}
+}
+
+func TestWorkerQueue_Shutdown(t *testing.T) {
+	q := util.NewWorkerQueue(2, 100)
+
+	var done int32
+	for i := 0; i < 100; i++ {
+		q.Submit(func() {
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&done, 1)
+		})
+	}
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if done != 100 {
+		t.Fatalf("%v jobs done, want 100", done)
+	}
+
+	// a stuck job
+	q = util.NewWorkerQueue(1, 1)
+	release := make(chan struct{})
+	defer close(release)
+	if err := q.Submit(func() { <-release }); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error %v", err)
+	}
+}